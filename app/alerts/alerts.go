@@ -0,0 +1,287 @@
+// Package alerts matches new items against saved searches and sends the
+// matches to their owners by email or webhook.
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/mail"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// maxAge is how long undeliverable alerts are kept in the queue.
+	maxAge = 7 * 24 * time.Hour
+	// a failed send is retried after retryDelay, doubled after every
+	// failure up to maxRetryDelay, until maxFailures of them in a row
+	retryDelay    = time.Minute
+	maxRetryDelay = 6 * time.Hour
+	maxFailures   = 10
+)
+
+type Alerts struct {
+	Mongo  *service.Mongo
+	Sender *mail.Sender
+	Client *http.Client
+}
+
+func New(mongo *service.Mongo, sender *mail.Sender) *Alerts {
+	return &Alerts{Mongo: mongo, Sender: sender, Client: NewWebhookClient(10 * time.Second)}
+}
+
+// NewWebhookClient returns a client for posting to urls given by users. It
+// connects only to public addresses, checked when dialing so that a host
+// resolving to an internal address later on is refused too, and does not
+// follow redirects.
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: publicOnly}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// publicOnly is a dialer control refusing connections to other than public
+// addresses.
+func publicOnly(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !public(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+// public tells whether ip is reachable from the internet rather than the
+// host itself or a private network.
+func public(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// Match is an ingest handler queueing the new items every saved search finds.
+func (a *Alerts) Match(items []domain.RSS) {
+	ids := map[string][]primitive.ObjectID{}
+	for _, item := range items {
+		ids[item.Language] = append(ids[item.Language], item.Id)
+	}
+	for _, search := range a.Mongo.SavedSearches(primitive.NilObjectID) {
+		if len(ids[search.Lang]) == 0 {
+			continue
+		}
+		matches := a.Mongo.MatchItems(search.Query, search.Lang, ids[search.Lang])
+		if err := a.Mongo.QueueAlerts(search, matches); err != nil {
+			log.Println("queueing alerts failed", search.Id.Hex(), err)
+		}
+	}
+}
+
+// Dispatch sends the queued alerts of every user whose alert frequency is due.
+func (a *Alerts) Dispatch(now time.Time) {
+	for userId, items := range a.Mongo.PendingAlerts() {
+		user := a.Mongo.FindUser(userId)
+		if user == nil || user.Alerts.Interval() < 0 {
+			a.done(userId, items, time.Time{})
+			continue
+		}
+		if now.Sub(user.Alerts.LastSent) < user.Alerts.Interval() || now.Before(user.Alerts.RetryAt) {
+			continue
+		}
+		if err := a.send(user, items); err != nil {
+			a.failed(user, items, now, err)
+			continue
+		}
+		a.done(userId, items, now)
+	}
+}
+
+func (a *Alerts) done(userId primitive.ObjectID, items []domain.AlertItem, sent time.Time) {
+	if len(items) == 0 {
+		return
+	}
+	if err := a.Mongo.AlertsSent(userId, items, sent); err != nil {
+		log.Println("removing sent alerts failed", userId.Hex(), err)
+	}
+}
+
+// failed schedules a retry of a failed send, dropping the items after
+// maxFailures failures in a row.
+func (a *Alerts) failed(user *domain.User, items []domain.AlertItem, now time.Time, err error) {
+	failures := user.Alerts.Failures + 1
+	if failures >= maxFailures {
+		log.Println("sending alerts failed", failures, "times, dropping them", user.Id.Hex(), err)
+		a.done(user.Id, items, time.Time{})
+		failures = 0
+	} else {
+		log.Println("sending alerts failed", user.Id.Hex(), err)
+		a.done(user.Id, expired(items, now), time.Time{})
+	}
+	if err := a.Mongo.AlertsFailed(user.Id, failures, now.Add(backoff(failures))); err != nil {
+		log.Println("saving failed alerts failed", user.Id.Hex(), err)
+	}
+}
+
+// backoff is how long to wait after failures sends have failed in a row.
+func backoff(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := retryDelay
+	for i := 1; i < failures && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+func expired(items []domain.AlertItem, now time.Time) []domain.AlertItem {
+	var result []domain.AlertItem
+	for _, item := range items {
+		if now.Sub(item.Created) > maxAge {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func (a *Alerts) send(user *domain.User, items []domain.AlertItem) error {
+	if user.Alerts.Channel == domain.AlertWebhook {
+		return a.postWebhook(user.Alerts.WebhookURL, items)
+	}
+	if !user.EmailVerified {
+		return fmt.Errorf("email address %s is not verified", user.Email)
+	}
+	lang := user.Lang
+	if lang != "en" {
+		lang = "fi"
+	}
+	return a.Sender.Send(user.Email, "alert", lang, alertMail{
+		Name:     user.Name,
+		Searches: group(items, lang),
+		Settings: util.SiteURL + "/" + lang + "/searches",
+	})
+}
+
+// alertMail is the template data of the alert email.
+type alertMail struct {
+	Name     string
+	Searches []searchAlerts
+	Settings string
+}
+
+type searchAlerts struct {
+	Name  string
+	Link  string
+	Items []domain.AlertItem
+}
+
+// group orders the items by saved search in the order the searches first
+// appear in items.
+func group(items []domain.AlertItem, lang string) []searchAlerts {
+	var result []searchAlerts
+	index := map[primitive.ObjectID]int{}
+	for _, item := range items {
+		i, ok := index[item.SearchId]
+		if !ok {
+			i = len(result)
+			index[item.SearchId] = i
+			result = append(result, searchAlerts{
+				Name: item.SearchName,
+				Link: util.SiteURL + "/" + lang + "/search?saved=" + item.SearchId.Hex(),
+			})
+		}
+		result[i].Items = append(result[i].Items, item)
+	}
+	return result
+}
+
+// webhookPayload is the JSON body posted to alert webhooks.
+type webhookPayload struct {
+	Sent  time.Time          `json:"sent"`
+	Items []domain.AlertItem `json:"items"`
+}
+
+func (a *Alerts) postWebhook(webhookURL string, items []domain.AlertItem) error {
+	if err := checkURL(webhookURL); err != nil {
+		return err
+	}
+	body, err := json.Marshal(webhookPayload{Sent: time.Now(), Items: items})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "uutispuro-alerts")
+	resp, err := a.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// Errors of webhook urls that are valid http urls.
+var (
+	ErrUnresolved = errors.New("webhook host cannot be resolved")
+	ErrNotPublic  = errors.New("webhook host is not a public address")
+)
+
+// ValidateWebhookURL accepts absolute http and https urls of hosts with
+// public addresses only.
+func ValidateWebhookURL(webhookURL string) error {
+	if err := checkURL(webhookURL); err != nil {
+		return err
+	}
+	u, _ := url.Parse(webhookURL)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnresolved, err)
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrNotPublic, addr.IP)
+		}
+	}
+	return nil
+}
+
+// checkURL accepts absolute http and https urls.
+func checkURL(webhookURL string) error {
+	u, err := url.Parse(webhookURL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("webhook url %q is not an http url", webhookURL)
+	}
+	return nil
+}
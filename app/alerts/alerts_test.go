@@ -0,0 +1,125 @@
+package alerts
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/mail"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testItems() []domain.AlertItem {
+	euro, korko := primitive.NewObjectID(), primitive.NewObjectID()
+	return []domain.AlertItem{
+		{SearchId: euro, SearchName: "euro", Title: "Euro vahvistui", Link: "https://example.com/1", Source: "Yle"},
+		{SearchId: korko, SearchName: "korko", Title: "Korot nousevat", Link: "https://example.com/2", Source: "HS"},
+		{SearchId: euro, SearchName: "euro", Title: "Euro heikkeni", Link: "https://example.com/3", Source: "IL"},
+	}
+}
+
+// TestAlertMail tests that the alert email lists the items by saved search
+func TestAlertMail(t *testing.T) {
+	searches := group(testItems(), "fi")
+	if len(searches) != 2 || searches[0].Name != "euro" || len(searches[0].Items) != 2 || len(searches[1].Items) != 1 {
+		t.Fatalf("Unexpected grouping %+v", searches)
+	}
+	sender := mail.NewSender(&mail.FileMailer{}, "../../public/mail/*.tmpl")
+	for _, lang := range []string{"fi", "en"} {
+		msg, err := sender.Render("matti@example.com", "alert", lang, alertMail{Name: "Matti", Searches: searches})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Index(msg.Text, "Euro heikkeni") > strings.Index(msg.Text, "korko") {
+			t.Errorf("Items of a search should be listed together:\n%s", msg.Text)
+		}
+		if !strings.Contains(msg.HTML, "search?saved="+searches[1].Items[0].SearchId.Hex()) {
+			t.Errorf("Html should link to the saved search:\n%s", msg.HTML)
+		}
+	}
+}
+
+// TestPostWebhook tests the webhook request and that errors are reported
+func TestPostWebhook(t *testing.T) {
+	var received webhookPayload
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected content type %q", r.Header.Get("Content-Type"))
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	a := &Alerts{Client: &http.Client{Timeout: time.Second}}
+	if err := a.postWebhook(server.URL, testItems()); err != nil {
+		t.Fatal(err)
+	}
+	if len(received.Items) != 3 || received.Items[0].Title != "Euro vahvistui" {
+		t.Errorf("Unexpected payload %+v", received)
+	}
+	status = http.StatusInternalServerError
+	if err := a.postWebhook(server.URL, testItems()); err == nil {
+		t.Error("A failing webhook should return an error")
+	}
+	if err := a.postWebhook("ftp://example.com", testItems()); err == nil {
+		t.Error("Only http urls should be accepted")
+	}
+}
+
+// TestInternalWebhook tests that webhooks cannot reach internal addresses
+func TestInternalWebhook(t *testing.T) {
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.1.2.3/hook",
+		"http://192.168.1.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hook",
+		"http://0.0.0.0/hook",
+	} {
+		if err := ValidateWebhookURL(u); !errors.Is(err, ErrNotPublic) {
+			t.Errorf("%s should not be accepted as internal, got %v", u, err)
+		}
+	}
+	if err := ValidateWebhookURL("https://93.184.216.34/hook"); err != nil {
+		t.Errorf("A public address should be accepted: %v", err)
+	}
+
+	redirected := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	}))
+	defer target.Close()
+	// a url validated earlier may resolve to an internal address when posting
+	a := &Alerts{Client: NewWebhookClient(time.Second)}
+	if err := a.postWebhook(target.URL, testItems()); err == nil || redirected {
+		t.Error("Posting to an internal address should fail when dialing")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+	a.Client.Transport.(*http.Transport).DialContext = (&net.Dialer{}).DialContext
+	if err := a.postWebhook(server.URL, testItems()); err == nil || redirected {
+		t.Error("Redirects should not be followed")
+	}
+}
+
+// TestBackoff tests that retries of failed sends get rarer up to a limit
+func TestBackoff(t *testing.T) {
+	tests := map[int]time.Duration{0: 0, 1: time.Minute, 2: 2 * time.Minute, 4: 8 * time.Minute, 9: 256 * time.Minute, 20: 6 * time.Hour}
+	for failures, expected := range tests {
+		if got := backoff(failures); got != expected {
+			t.Errorf("%d failures: expected %v, got %v", failures, expected, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// Package analyze turns titles and search terms into the tokens news items
+// are searched by. Finnish words are stemmed and compound words split into
+// their parts, so that searching for talous finds talouden and laina finds
+// asuntolainat. Other languages are only lower cased.
+package analyze
+
+import (
+	_ "embed"
+	"strings"
+	"unicode"
+)
+
+// minPart is the shortest part a compound word is split to, in letters.
+const minPart = 3
+
+//go:embed compounds_fi.txt
+var compoundWords string
+
+var (
+	// modifiers maps the forms first parts of compounds appear in to the
+	// stem of the word
+	modifiers = map[string]string{}
+	// heads maps the beginnings of the inflected forms of last parts of
+	// compounds to the stem of the word
+	heads = map[string]string{}
+)
+
+func init() {
+	for _, line := range strings.Split(compoundWords, "\n") {
+		word := strings.TrimSpace(line)
+		if word == "" || strings.HasPrefix(word, "#") {
+			continue
+		}
+		stem := stemFinnish(word)
+		modifiers[word] = stem
+		modifiers[word+"n"] = stem
+		heads[stem] = stem
+		// inflection changes the last vowel, vaali goes vaaleissa
+		if r := []rune(word); len(r) > minPart+1 && isV1(r[len(r)-1]) {
+			heads[string(r[:len(r)-1])] = stem
+		}
+	}
+}
+
+// Words splits text into lower case words, taking letters and numbers.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Stem returns the token a single word is searched by.
+func Stem(lang string, word string) string {
+	word = strings.ToLower(word)
+	if lang == "fi" {
+		return stemFinnish(word)
+	}
+	return word
+}
+
+// Term returns the stem of a search term and, for a compound word, the
+// stems of its parts.
+func Term(lang string, word string) (string, []string) {
+	word = strings.ToLower(word)
+	if lang != "fi" {
+		return word, nil
+	}
+	return stemFinnish(word), split(word)
+}
+
+// WordTokens returns the tokens a word is indexed by: its stem and the
+// stems of the parts of a compound word.
+func WordTokens(lang string, word string) []string {
+	stem, parts := Term(lang, word)
+	return append([]string{stem}, parts...)
+}
+
+// Tokens returns the distinct tokens of the words of text.
+func Tokens(lang string, text string) []string {
+	tokens := []string{}
+	seen := map[string]bool{}
+	for _, word := range Words(text) {
+		for _, token := range WordTokens(lang, word) {
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// split returns the stems of the parts of a Finnish compound word,
+// preferring the longest first part, or nil when the word is not a known
+// compound.
+func split(word string) []string {
+	r := []rune(word)
+	for i := len(r) - minPart; i >= minPart; i-- {
+		modifier, ok := modifiers[string(r[:i])]
+		if !ok {
+			continue
+		}
+		tail := r[i:]
+		if head, ok := heads[stemFinnish(string(tail))]; ok {
+			return []string{modifier, head}
+		}
+		if parts := split(string(tail)); parts != nil {
+			return append([]string{modifier}, parts...)
+		}
+		for j := len(tail); j >= minPart; j-- {
+			if head, ok := heads[string(tail[:j])]; ok {
+				return []string{modifier, head}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package analyze
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestStemFinnish tests that inflected forms of a word share a stem
+func TestStemFinnish(t *testing.T) {
+	groups := [][]string{
+		{"talous", "talouden", "taloudessa", "Taloutta"},
+		{"talo", "talon", "taloon", "taloissa", "taloa"},
+		{"hallitus", "hallituksen", "hallitukselle", "hallituksessa"},
+		{"suomalainen", "suomalaisen", "suomalaiset", "suomalaisia"},
+		{"poliisi", "poliisin", "poliisille"},
+		{"laina", "lainan", "lainat"},
+		{"asuntolainan", "asuntolainat"},
+	}
+	for _, group := range groups {
+		stem := Stem("fi", group[0])
+		for _, word := range group[1:] {
+			if got := Stem("fi", word); got != stem {
+				t.Errorf("%s should stem like %s to %s, got %s", word, group[0], stem, got)
+			}
+		}
+	}
+	if Stem("en", "Markets") != "markets" {
+		t.Error("Other languages should only be lower cased")
+	}
+}
+
+// TestSplit tests decomposing compound words to the stems of their parts
+func TestSplit(t *testing.T) {
+	tests := map[string][]string{
+		"asuntolainat":       {"asunto", "laina"},
+		"eduskuntavaaleissa": {Stem("fi", "eduskunta"), "vaali"},
+		"valtionyhtiön":      {"valtio", Stem("fi", "yhtiö")},
+		"keskuspankki":       {"keskus", Stem("fi", "pankki")},
+		"työttömyys":         nil,
+		"lainat":             nil,
+	}
+	for word, expected := range tests {
+		if got := split(word); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Splitting %s expected %v, got %v", word, expected, got)
+		}
+	}
+}
+
+// TestTokens tests the distinct tokens of a title
+func TestTokens(t *testing.T) {
+	got := Tokens("fi", "Asuntolainat kallistuvat: lainan korko nousee")
+	expected := []string{"asuntolain", "asunto", "laina", Stem("fi", "kallistuvat"), Stem("fi", "korko"), Stem("fi", "nousee")}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := Tokens("en", "Rates rise, rates fall"); !reflect.DeepEqual(got, []string{"rates", "rise", "fall"}) {
+		t.Errorf("Unexpected english tokens %v", got)
+	}
+}
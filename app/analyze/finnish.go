@@ -0,0 +1,243 @@
+package analyze
+
+import (
+	"sort"
+	"strings"
+)
+
+// The Finnish stemmer follows the Snowball algorithm, see
+// https://snowballstem.org/algorithms/finnish/stemmer.html, with extra rules
+// for noun types whose inflected forms have a different stem. The -si and
+// -ni possessives are left alone, they are rare in news but cut words like
+// poliisi and Japani short.
+
+const (
+	v1         = "aeiouyäö"
+	v2         = "aeiouäö"
+	consonants = "bcdfghjklmnpqrstvwxz"
+)
+
+func isV1(r rune) bool { return strings.ContainsRune(v1, r) }
+func isV2(r rune) bool { return strings.ContainsRune(v2, r) }
+func isC(r rune) bool  { return strings.ContainsRune(consonants, r) }
+
+// ending is a suffix with a condition on the text before it.
+type ending struct {
+	suffix []rune
+	cond   func(w []rune, at int) bool
+}
+
+func endings(cond func(w []rune, at int) bool, suffixes ...string) []ending {
+	result := make([]ending, len(suffixes))
+	for i, s := range suffixes {
+		result[i] = ending{suffix: []rune(s), cond: cond}
+	}
+	return result
+}
+
+func longestFirst(groups ...[]ending) []ending {
+	var result []ending
+	for _, g := range groups {
+		result = append(result, g...)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return len(result[i].suffix) > len(result[j].suffix) })
+	return result
+}
+
+// among returns where the longest of list w ends with starts and the
+// ending, when the suffix starts at limit or after it and its condition
+// holds.
+func among(w []rune, limit int, list []ending) (int, *ending) {
+	for i := range list {
+		e := &list[i]
+		at := len(w) - len(e.suffix)
+		if at < limit || !endsWith(w, e.suffix) {
+			continue
+		}
+		if e.cond == nil || e.cond(w, at) {
+			return at, e
+		}
+	}
+	return -1, nil
+}
+
+func endsWith(w []rune, suffix []rune) bool {
+	if len(suffix) > len(w) {
+		return false
+	}
+	for i, r := range suffix {
+		if w[len(w)-len(suffix)+i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// before returns a condition of one of suffixes preceding the ending.
+func before(suffixes ...string) func(w []rune, at int) bool {
+	return func(w []rune, at int) bool {
+		for _, s := range suffixes {
+			if endsWith(w[:at], []rune(s)) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func not(cond func(w []rune, at int) bool) func(w []rune, at int) bool {
+	return func(w []rune, at int) bool { return !cond(w, at) }
+}
+
+// longVowel tests for a doubled vowel before at.
+func longVowel(w []rune, at int) bool {
+	return at >= 2 && w[at-1] == w[at-2] && isV2(w[at-1])
+}
+
+// vi tests for an i after a vowel before at.
+func vi(w []rune, at int) bool {
+	return at >= 2 && w[at-1] == 'i' && isV2(w[at-2])
+}
+
+var (
+	particles = longestFirst(
+		endings(func(w []rune, at int) bool {
+			return at >= 1 && (isV1(w[at-1]) || w[at-1] == 'n' || w[at-1] == 't')
+		}, "kin", "kaan", "kään", "ko", "kö", "han", "hän", "pa", "pä"),
+		// sti is checked to be in R2 by the stemmer
+		endings(nil, "sti"),
+	)
+	possessives = longestFirst(
+		endings(nil, "nsa", "nsä", "mme", "nne"),
+		endings(before("ta", "ssa", "sta", "lla", "lta", "na"), "an"),
+		endings(before("tä", "ssä", "stä", "llä", "ltä", "nä"), "än"),
+		endings(before("lle", "ine"), "en"),
+	)
+	cases = longestFirst(
+		endings(before("a"), "han"),
+		endings(before("e"), "hen"),
+		endings(before("i"), "hin"),
+		endings(before("o"), "hon"),
+		endings(before("ä"), "hän"),
+		endings(before("ö"), "hön"),
+		endings(vi, "siin", "den", "tten"),
+		endings(longVowel, "seen"),
+		endings(nil, "n"),
+		endings(func(w []rune, at int) bool {
+			return at >= 2 && isV1(w[at-1]) && isC(w[at-2])
+		}, "a", "ä"),
+		endings(before("e"), "tta", "ttä"),
+		endings(nil, "ta", "tä", "ssa", "ssä", "sta", "stä", "lla", "llä", "lta", "ltä", "lle", "na", "nä", "ksi", "ine"),
+	)
+	others = longestFirst(
+		endings(not(before("po")), "mpi", "mpa", "mpä", "mmi", "mma", "mmä"),
+		endings(nil, "impi", "impa", "impä", "immi", "imma", "immä", "eja", "ejä"),
+	)
+	tPlurals = longestFirst(
+		endings(not(before("po")), "mma"),
+		endings(nil, "imma"),
+	)
+)
+
+// regions returns the starts of the regions R1 and R2, each after the
+// first consonant following a vowel of the previous region.
+func regions(w []rune) (int, int) {
+	next := func(from int) int {
+		i := from
+		for i < len(w) && !isV1(w[i]) {
+			i++
+		}
+		for i < len(w) && isV1(w[i]) {
+			i++
+		}
+		if i < len(w) {
+			return i + 1
+		}
+		return len(w)
+	}
+	p1 := next(0)
+	return p1, next(p1)
+}
+
+// stemFinnish returns the stem of a lower case Finnish word.
+func stemFinnish(word string) string {
+	w := []rune(normalizeFinnish(word))
+	p1, p2 := regions(w)
+
+	if at, e := among(w, p1, particles); e != nil && (string(e.suffix) != "sti" || at >= p2) {
+		w = w[:at]
+	}
+	if at, e := among(w, p1, possessives); e != nil {
+		w = w[:at]
+	}
+	removed := false
+	if at, e := among(w, p1, cases); e != nil {
+		if string(e.suffix) == "n" && (longVowel(w, at) || before("ie")(w, at)) {
+			// illative, the vowel before goes as well
+			at--
+		}
+		w, removed = w[:at], true
+	}
+	if at, e := among(w, p2, others); e != nil {
+		w = w[:at]
+	}
+	if removed {
+		if n := len(w); n > p1 && (w[n-1] == 'i' || w[n-1] == 'j') {
+			w = w[:n-1]
+		}
+	} else if n := len(w); n-2 >= p1 && w[n-1] == 't' && isV1(w[n-2]) {
+		w = w[:n-1]
+		if at, e := among(w, p2, tPlurals); e != nil {
+			w = w[:at]
+		}
+	}
+	return finnishStem(tidy(w, p1))
+}
+
+func tidy(w []rune, p1 int) []rune {
+	n := len(w)
+	if n-2 >= p1 && longVowel(w, n) {
+		w, n = w[:n-1], n-1
+	}
+	if n-2 >= p1 && strings.ContainsRune("aäei", w[n-1]) && isC(w[n-2]) {
+		w, n = w[:n-1], n-1
+	}
+	if n-2 >= p1 && w[n-1] == 'j' && (w[n-2] == 'o' || w[n-2] == 'u') {
+		w, n = w[:n-1], n-1
+	}
+	if n-2 >= p1 && w[n-1] == 'o' && w[n-2] == 'j' {
+		w, n = w[:n-1], n-1
+	}
+	// undouble the last consonant
+	i := n - 1
+	for i >= 0 && isV1(w[i]) {
+		i--
+	}
+	if i >= 1 && isC(w[i]) && w[i-1] == w[i] {
+		w = append(w[:i], w[i+1:]...)
+	}
+	return w
+}
+
+// normalizeFinnish turns nominatives ending in -nen to their inflection
+// stem, so that suomalainen stems like suomalaisen and suomalaisia.
+func normalizeFinnish(word string) string {
+	if strings.HasSuffix(word, "nen") && len([]rune(word)) > 5 {
+		return strings.TrimSuffix(word, "nen") + "se"
+	}
+	return word
+}
+
+// finnishStem gives the -us and -ys nouns the stem of their nominative,
+// so that talouden, taloutta and taloudessa stem like talous and
+// hallituksen like hallitus.
+func finnishStem(w []rune) string {
+	n := len(w)
+	if n > 3 && (w[n-1] == 'd' || w[n-1] == 't') && (w[n-2] == 'u' || w[n-2] == 'y') && isV1(w[n-3]) {
+		w[n-1] = 's'
+	}
+	if n > 4 && w[n-1] == 's' && w[n-2] == 'k' && (w[n-3] == 'u' || w[n-3] == 'y') {
+		w = append(w[:n-2], 's')
+	}
+	return string(w)
+}
@@ -0,0 +1,166 @@
+// Package digest emails subscribers the most read and trending items of
+// their front page since their previous digest.
+package digest
+
+import (
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/mail"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	mostReadCount = 10
+	trendingCount = 5
+	// unsubscribeTTL is how long the unsubscribe link of a digest works.
+	unsubscribeTTL = 90 * 24 * time.Hour
+)
+
+type Digest struct {
+	Mongo  *service.Mongo
+	Sender *mail.Sender
+}
+
+func New(mongo *service.Mongo, sender *mail.Sender) *Digest {
+	return &Digest{Mongo: mongo, Sender: sender}
+}
+
+// Mail is the template data of the digest email.
+type Mail struct {
+	Name        string
+	Frequency   string
+	Since       time.Time
+	MostRead    []domain.RSS
+	Trending    []domain.RSS
+	Unsubscribe string
+	Settings    string
+}
+
+func (m Mail) Empty() bool {
+	return len(m.MostRead) == 0 && len(m.Trending) == 0
+}
+
+// Compile picks the items of the digest the user gets at now.
+func (d *Digest) Compile(user *domain.User, now time.Time) Mail {
+	lang := userLang(user)
+	since := user.Digest.LastSent
+	if earliest := now.Add(-user.Digest.Interval()); since.Before(earliest) {
+		since = earliest
+	}
+	mostRead, trending := rank(d.Mongo.DigestCandidates(lang, user.Preferences, since, now), now)
+	return Mail{
+		Name:      user.Name,
+		Frequency: user.Digest.Frequency,
+		Since:     since,
+		MostRead:  mostRead,
+		Trending:  trending,
+		Settings:  util.SiteURL + "/" + lang + "/searches",
+	}
+}
+
+// Preview renders the digest of the user at now without sending it. The
+// unsubscribe link of a preview does not work.
+func (d *Digest) Preview(user *domain.User, now time.Time) (mail.Message, error) {
+	lang := userLang(user)
+	m := d.Compile(user, now)
+	m.Unsubscribe = unsubscribeLink(lang, "preview")
+	return d.Sender.Render(user.Email, "digest", lang, m)
+}
+
+// Dispatch sends the digests that are due.
+func (d *Digest) Dispatch(now time.Time) {
+	for _, user := range d.Mongo.DigestSubscribers() {
+		if now.Sub(user.Digest.LastSent) < user.Digest.Interval() {
+			continue
+		}
+		if err := d.send(&user, now); err != nil {
+			log.Println("sending digest failed", user.Id.Hex(), err)
+		}
+	}
+}
+
+// send mails the digest unless there is nothing to tell, and records it.
+func (d *Digest) send(user *domain.User, now time.Time) error {
+	lang := userLang(user)
+	m := d.Compile(user, now)
+	record := domain.DigestRecord{UserId: user.Id, Frequency: user.Digest.Frequency, Since: m.Since, Sent: now}
+	if !m.Empty() {
+		token, err := d.Mongo.CreateUserToken(user.Id, service.TokenUnsubscribe, unsubscribeTTL)
+		if err != nil {
+			return err
+		}
+		m.Unsubscribe = unsubscribeLink(lang, token)
+		msg, err := d.Sender.Render(user.Email, "digest", lang, m)
+		if err != nil {
+			return err
+		}
+		msg.Headers = unsubscribeHeaders(m.Unsubscribe)
+		if err := d.Sender.Mailer.Send(msg); err != nil {
+			return err
+		}
+		record.Items = itemIds(m)
+	}
+	return d.Mongo.RecordDigest(record)
+}
+
+func userLang(user *domain.User) string {
+	if user.Lang == "en" {
+		return "en"
+	}
+	return "fi"
+}
+
+func unsubscribeLink(lang string, token string) string {
+	return util.SiteURL + "/" + lang + "/unsubscribe?token=" + token
+}
+
+// unsubscribeHeaders let mail clients offer one click unsubscribe (RFC 8058).
+func unsubscribeHeaders(link string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + link + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+// rank picks the most clicked items, and of the rest the trending ones,
+// those clicked the most per hour since they were published.
+func rank(items []domain.RSS, now time.Time) ([]domain.RSS, []domain.RSS) {
+	sorted := append([]domain.RSS{}, items...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Clicks != sorted[j].Clicks {
+			return sorted[i].Clicks > sorted[j].Clicks
+		}
+		return sorted[i].PubDate.After(sorted[j].PubDate)
+	})
+	n := mostReadCount
+	if len(sorted) < n {
+		n = len(sorted)
+	}
+	mostRead, rest := sorted[:n], sorted[n:]
+	rate := func(item domain.RSS) float64 {
+		return float64(item.Clicks) / math.Max(now.Sub(item.PubDate).Hours(), 1)
+	}
+	sort.SliceStable(rest, func(i, j int) bool {
+		return rate(rest[i]) > rate(rest[j])
+	})
+	if len(rest) > trendingCount {
+		rest = rest[:trendingCount]
+	}
+	return mostRead, rest
+}
+
+func itemIds(m Mail) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, items := range [][]domain.RSS{m.MostRead, m.Trending} {
+		for _, item := range items {
+			ids = append(ids, item.Id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,77 @@
+package digest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/mail"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testItem(title string, clicks int, age time.Duration, now time.Time) domain.RSS {
+	return domain.RSS{
+		Id:        primitive.NewObjectID(),
+		RssTitle:  title,
+		RssLink:   "https://example.com/" + title,
+		RssSource: "Yle",
+		Clicks:    clicks,
+		PubDate:   now.Add(-age),
+	}
+}
+
+// TestRank tests that the most clicked items come first and the fastest rising of the rest trend
+func TestRank(t *testing.T) {
+	now := time.Now()
+	var items []domain.RSS
+	for i := 0; i < mostReadCount; i++ {
+		items = append(items, testItem("top", 100+i, 20*time.Hour, now))
+	}
+	items = append(items,
+		testItem("old", 50, 20*time.Hour, now),
+		testItem("fresh", 10, time.Hour, now),
+	)
+	mostRead, trending := rank(items, now)
+	if len(mostRead) != mostReadCount || mostRead[0].Clicks != 100+mostReadCount-1 {
+		t.Fatalf("Expected the most clicked items first, got %+v", mostRead)
+	}
+	if len(trending) != 2 || trending[0].RssTitle != "fresh" {
+		t.Errorf("Expected the item clicked most per hour to trend first, got %+v", trending)
+	}
+	if mostRead, trending := rank(nil, now); len(mostRead) != 0 || len(trending) != 0 {
+		t.Error("Expected an empty digest without items")
+	}
+}
+
+// TestDigestMail tests both languages and formats of the digest email
+func TestDigestMail(t *testing.T) {
+	now := time.Now()
+	sender := mail.NewSender(&mail.FileMailer{}, "../../public/mail/*.tmpl")
+	m := Mail{
+		Name:        "Matti",
+		Frequency:   domain.DigestWeekly,
+		Since:       now.Add(-7 * 24 * time.Hour),
+		MostRead:    []domain.RSS{testItem("luettu", 10, time.Hour, now)},
+		Trending:    []domain.RSS{testItem("nouseva", 2, time.Hour, now)},
+		Unsubscribe: unsubscribeLink("fi", "abc"),
+	}
+	for _, lang := range []string{"fi", "en"} {
+		msg, err := sender.Render("matti@example.com", "digest", lang, m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, body := range []string{msg.Text, msg.HTML} {
+			if !strings.Contains(body, "https://example.com/luettu") || !strings.Contains(body, "https://example.com/nouseva") {
+				t.Errorf("%s: digest should link to the items:\n%s", lang, body)
+			}
+			if !strings.Contains(body, "/fi/unsubscribe?token=abc") {
+				t.Errorf("%s: digest should have the unsubscribe link:\n%s", lang, body)
+			}
+		}
+	}
+	headers := unsubscribeHeaders(m.Unsubscribe)
+	if headers["List-Unsubscribe"] != "<"+m.Unsubscribe+">" || headers["List-Unsubscribe-Post"] != "List-Unsubscribe=One-Click" {
+		t.Errorf("Unexpected unsubscribe headers %v", headers)
+	}
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AccountExport is everything stored about a user, downloaded as JSON.
+type AccountExport struct {
+	Exported      time.Time      `json:"exported"`
+	Profile       *User          `json:"profile"`
+	Sessions      []SessionInfo  `json:"sessions"`
+	SavedSearches []SavedSearch  `json:"savedSearches"`
+	PendingAlerts []AlertItem    `json:"pendingAlerts"`
+	Bookmarks     []Bookmark     `json:"bookmarks"`
+	ReadHistory   []ReadDay      `json:"readHistory"`
+	Digests       []DigestRecord `json:"digests"`
+}
+
+// SessionInfo is a login session without its token.
+type SessionInfo struct {
+	Created time.Time `json:"created" bson:"created"`
+	Expires time.Time `json:"expires" bson:"expires"`
+}
+
+// ReadDay lists the items a user clicked open during a day.
+type ReadDay struct {
+	Day   string               `json:"day"`
+	Items []primitive.ObjectID `json:"items"`
+}
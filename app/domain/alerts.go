@@ -0,0 +1,70 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Alert frequencies and channels of AlertSettings.
+const (
+	AlertOff     = "off"
+	AlertInstant = "instant"
+	AlertHourly  = "hourly"
+	AlertDaily   = "daily"
+
+	AlertEmail   = "email"
+	AlertWebhook = "webhook"
+)
+
+// SavedSearch is a search query a user monitors. Unread counts the items
+// matched since the user last opened the search.
+type SavedSearch struct {
+	Id      primitive.ObjectID `json:"id" bson:"_id"`
+	UserId  primitive.ObjectID `json:"-" bson:"userId"`
+	Name    string             `json:"name" bson:"name"`
+	Query   string             `json:"query" bson:"query"`
+	Lang    string             `json:"lang" bson:"lang"`
+	Created time.Time          `json:"created" bson:"created"`
+	Unread  int                `json:"unread" bson:"unread"`
+}
+
+// AlertSettings tell how often and where a user gets the new matches of
+// the saved searches.
+type AlertSettings struct {
+	Frequency  string    `json:"frequency" bson:"frequency"`
+	Channel    string    `json:"channel" bson:"channel"`
+	WebhookURL string    `json:"webhookUrl,omitempty" bson:"webhookUrl,omitempty"`
+	LastSent   time.Time `json:"lastSent" bson:"lastSent"`
+	// Failures counts the sends failed in a row, retried from RetryAt on.
+	Failures int       `json:"-" bson:"failures,omitempty"`
+	RetryAt  time.Time `json:"-" bson:"retryAt,omitempty"`
+}
+
+// Interval is how long alerts are collected before they are sent. Zero
+// means they are sent right away and a negative one that they are not sent.
+func (a AlertSettings) Interval() time.Duration {
+	switch a.Frequency {
+	case AlertInstant:
+		return 0
+	case AlertHourly:
+		return time.Hour
+	case AlertDaily:
+		return 24 * time.Hour
+	}
+	return -1
+}
+
+// AlertItem is an item matched by a saved search, waiting to be sent.
+type AlertItem struct {
+	Id         primitive.ObjectID `json:"-" bson:"_id"`
+	UserId     primitive.ObjectID `json:"-" bson:"userId"`
+	SearchId   primitive.ObjectID `json:"searchId" bson:"searchId"`
+	SearchName string             `json:"searchName" bson:"searchName"`
+	ItemId     primitive.ObjectID `json:"id" bson:"itemId"`
+	Title      string             `json:"title" bson:"title"`
+	Link       string             `json:"link" bson:"link"`
+	Source     string             `json:"source" bson:"source"`
+	PubDate    time.Time          `json:"pubDate" bson:"pubDate"`
+	Created    time.Time          `json:"-" bson:"created"`
+}
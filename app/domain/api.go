@@ -0,0 +1,42 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIError is the body of every error response of the JSON API.
+type APIError struct {
+	Error APIErrorBody `json:"error"`
+}
+
+type APIErrorBody struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Parameter string `json:"parameter,omitempty"`
+}
+
+func NewAPIError(status int, code string, message string) APIError {
+	return APIError{Error: APIErrorBody{Status: status, Code: code, Message: message}}
+}
+
+// APIKey is a partner's credential for the JSON API. Only a hash of the key
+// itself is stored.
+type APIKey struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id"`
+	Name          string             `json:"name" bson:"name"`
+	Contact       string             `json:"contact" bson:"contact"`
+	Prefix        string             `json:"prefix" bson:"prefix"`
+	Hash          string             `json:"-" bson:"hash"`
+	RatePerMinute int                `json:"ratePerMinute" bson:"ratePerMinute"`
+	Burst         int                `json:"burst" bson:"burst"`
+	Created       time.Time          `json:"created" bson:"created"`
+	Revoked       bool               `json:"revoked" bson:"revoked"`
+	LastUsed      time.Time          `json:"lastUsed" bson:"lastUsed"`
+	Requests      int64              `json:"requests" bson:"requests"`
+	Rejected      int64              `json:"rejected" bson:"rejected"`
+	RequestsToday int64              `json:"requestsToday" bson:"-"`
+	RejectedToday int64              `json:"rejectedToday" bson:"-"`
+}
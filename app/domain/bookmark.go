@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bookmark is an item a user saved for later. It keeps a copy of the item,
+// so it outlives the item in the news collection.
+type Bookmark struct {
+	Id       primitive.ObjectID `json:"-" bson:"_id"`
+	UserId   primitive.ObjectID `json:"-" bson:"userId"`
+	ItemId   primitive.ObjectID `json:"id" bson:"itemId"`
+	Title    string             `json:"title" bson:"title"`
+	Link     string             `json:"link" bson:"link"`
+	Source   string             `json:"source" bson:"source"`
+	Category Category           `json:"category" bson:"category"`
+	Language string             `json:"language" bson:"language"`
+	PubDate  time.Time          `json:"pubDate" bson:"pubDate"`
+	Created  time.Time          `json:"bookmarked" bson:"created"`
+}
+
+// RSS returns the bookmark as an item for the list templates.
+func (b Bookmark) RSS() RSS {
+	return RSS{
+		Id:        b.ItemId,
+		RssTitle:  b.Title,
+		RssLink:   b.Link,
+		RssSource: b.Source,
+		Category:  b.Category,
+		Language:  b.Language,
+		PubDate:   b.PubDate,
+	}
+}
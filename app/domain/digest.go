@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Digest frequencies of DigestSettings.
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// DigestSettings tell how often a user gets the top stories by email.
+type DigestSettings struct {
+	Frequency string    `json:"frequency" bson:"frequency"`
+	LastSent  time.Time `json:"lastSent" bson:"lastSent"`
+}
+
+// Interval is the time between digests, negative when they are not sent.
+func (d DigestSettings) Interval() time.Duration {
+	switch d.Frequency {
+	case DigestDaily:
+		return 24 * time.Hour
+	case DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return -1
+}
+
+// DigestRecord is a digest sent to a user.
+type DigestRecord struct {
+	Id        primitive.ObjectID   `json:"id" bson:"_id"`
+	UserId    primitive.ObjectID   `json:"-" bson:"userId"`
+	Frequency string               `json:"frequency" bson:"frequency"`
+	Since     time.Time            `json:"since" bson:"since"`
+	Sent      time.Time            `json:"sent" bson:"sent"`
+	Items     []primitive.ObjectID `json:"items" bson:"items"`
+}
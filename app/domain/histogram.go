@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"html/template"
+	"time"
+)
+
+// Histogram counts the items a search finds per source in each day or
+// hour of a time range.
+type Histogram struct {
+	Query    string    `json:"query"`
+	Lang     string    `json:"lang"`
+	Interval string    `json:"interval"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	// Buckets are the starts of the days or hours, Counts of the sources
+	// are in the same order.
+	Buckets []time.Time       `json:"buckets"`
+	Sources []HistogramSeries `json:"sources"`
+	Total   int               `json:"total"`
+}
+
+// HistogramSeries is the counts of one source, the sources ordered by
+// their totals.
+type HistogramSeries struct {
+	Source string `json:"source"`
+	Counts []int  `json:"counts"`
+	Total  int    `json:"total"`
+}
+
+// Chart is a histogram drawn as lines of its most common sources.
+type Chart struct {
+	Width  int
+	Height int
+	// Max is the count at the top of the chart.
+	Max     int
+	Lines   []ChartLine
+	XLabels []ChartLabel
+	// Params are the parameters of the histogram for the links to it,
+	// starting with &.
+	Params template.URL
+}
+
+// ChartLine is the polyline of a source.
+type ChartLine struct {
+	Source string
+	Color  string
+	Points string
+	Total  int
+}
+
+// ChartLabel is a label of the time axis at X.
+type ChartLabel struct {
+	X    int
+	Text string
+}
@@ -0,0 +1,71 @@
+package domain
+
+// Preferences are the categories and sources a reader follows or mutes on
+// the front page. Following anything limits the front page to the followed
+// categories and sources, muted ones are left out of it. HideRead leaves
+// the items a logged in user has opened out of the listings.
+type Preferences struct {
+	FollowCategories []string `json:"followCategories,omitempty" bson:"followCategories,omitempty"`
+	MuteCategories   []string `json:"muteCategories,omitempty" bson:"muteCategories,omitempty"`
+	FollowSources    []string `json:"followSources,omitempty" bson:"followSources,omitempty"`
+	MuteSources      []string `json:"muteSources,omitempty" bson:"muteSources,omitempty"`
+	HideRead         bool     `json:"hideRead,omitempty" bson:"hideRead,omitempty"`
+}
+
+// Empty tells if the front page is not personalized by follows or mutes.
+func (p Preferences) Empty() bool {
+	return len(p.FollowCategories) == 0 && len(p.MuteCategories) == 0 &&
+		len(p.FollowSources) == 0 && len(p.MuteSources) == 0
+}
+
+func (p Preferences) FollowsCategory(category string) bool {
+	return contains(p.FollowCategories, category)
+}
+
+func (p Preferences) MutesCategory(category string) bool {
+	return contains(p.MuteCategories, category)
+}
+
+func (p Preferences) FollowsSource(source string) bool {
+	return contains(p.FollowSources, source)
+}
+
+func (p Preferences) MutesSource(source string) bool {
+	return contains(p.MuteSources, source)
+}
+
+// Set follows or mutes a category or a source, or with action "clear"
+// forgets it. Following removes a mute and the other way round.
+func (p *Preferences) Set(kind string, name string, action string) {
+	follow, mute := &p.FollowCategories, &p.MuteCategories
+	if kind == "source" {
+		follow, mute = &p.FollowSources, &p.MuteSources
+	}
+	*follow = remove(*follow, name)
+	*mute = remove(*mute, name)
+	switch action {
+	case "follow":
+		*follow = append(*follow, name)
+	case "mute":
+		*mute = append(*mute, name)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(list []string, s string) []string {
+	var result []string
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// QueryLog is a search made on the search page, in the normalized form of
+// the query, with the number of results and how long finding them took.
+// Nothing identifying the searcher is stored.
+type QueryLog struct {
+	Id        primitive.ObjectID `json:"-" bson:"_id"`
+	Query     string             `json:"query" bson:"query"`
+	Lang      string             `json:"lang" bson:"lang"`
+	Results   int                `json:"results" bson:"results"`
+	LatencyMs int64              `json:"latencyMs" bson:"latencyMs"`
+	Time      time.Time          `json:"time" bson:"time"`
+}
+
+// QueryReport summarizes the searches of a period for editors: the most
+// common ones, the ones finding nothing and the ones searched more than in
+// the period before.
+type QueryReport struct {
+	Lang        string
+	Days        int
+	From        time.Time
+	To          time.Time
+	Searches    int
+	ZeroResults int
+	// AvgLatencyMs is the average time of finding the results.
+	AvgLatencyMs int64
+	Top          []QueryStat
+	Zero         []QueryStat
+	Trending     []QueryStat
+}
+
+// QueryStat is a query with the number of times it was searched in the
+// period and in the period before.
+type QueryStat struct {
+	Query        string
+	Count        int
+	Previous     int
+	ZeroResults  int
+	AvgResults   int
+	AvgLatencyMs int64
+}
+
+// Change returns the growth of the searches of a query from the period
+// before as a percentage, zero for a query not searched then.
+func (s QueryStat) Change() int {
+	if s.Previous == 0 {
+		return 0
+	}
+	return (s.Count - s.Previous) * 100 / s.Previous
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"html/template"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,6 +17,8 @@ type RSS struct {
 	Language  string             `json:"language" bson:"language"`
 	Category  Category           `json:"category" bson:"category"`
 	RssFeed   RssFeed            `json:"-" bson:"rssFeed"`
+	Highlight template.HTML      `json:"highlight,omitempty" bson:"-"`
+	Tokens    []string           `json:"-" bson:"tokens,omitempty"`
 }
 
 type Category struct {
@@ -32,13 +35,87 @@ type RssFeed struct {
 }
 
 type News struct {
-	RSS            []RSS  `json:"rssList"`
-	MostReadList   []RSS  `json:"mostReadList"`
-	Page           int    `json:"page"`
-	Lang           string `json:"lang"`
-	SearchQuery    string `json:"searchQuery,omitempty"`
-	ResultCount    int    `json:"count"`
-	Category       string `json:"category,omitempty"`
-	CategoryEnName string `json:"categoryEnName,omitempty" bson:"-"`
-	Source         string `json:"source,omitempty" bson:"-"`
+	RSS            []RSS                       `json:"rssList"`
+	MostReadList   []RSS                       `json:"mostReadList"`
+	Page           int                         `json:"page"`
+	Lang           string                      `json:"lang"`
+	SearchQuery    string                      `json:"searchQuery,omitempty"`
+	Sort           string                      `json:"sort,omitempty" bson:"-"`
+	ResultCount    int                         `json:"count"`
+	Total          int                         `json:"total,omitempty"`
+	Estimated      bool                        `json:"estimated,omitempty"`
+	PageSize       int                         `json:"-" bson:"-"`
+	Category       string                      `json:"category,omitempty"`
+	CategoryEnName string                      `json:"categoryEnName,omitempty" bson:"-"`
+	Source         string                      `json:"source,omitempty" bson:"-"`
+	FeedPath       string                      `json:"-" bson:"-"`
+	FeedTitle      string                      `json:"-" bson:"-"`
+	Viewer         Viewer                      `json:"-" bson:"-"`
+	LoginForm      *LoginForm                  `json:"-" bson:"-"`
+	LoginProviders []LoginProvider             `json:"-" bson:"-"`
+	SavedSearches  []SavedSearch               `json:"-" bson:"-"`
+	SavedSearch    *SavedSearch                `json:"-" bson:"-"`
+	FormError      string                      `json:"-" bson:"-"`
+	Bookmarked     map[primitive.ObjectID]bool `json:"-" bson:"-"`
+	Read           map[primitive.ObjectID]bool `json:"-" bson:"-"`
+	Facets         *Facets                     `json:"facets,omitempty" bson:"-"`
+	// FacetParams are the facet filters of a search as url parameters,
+	// starting with &, to keep them when paging and sorting.
+	FacetParams template.URL `json:"-" bson:"-"`
+	// Histogram is the time series of a search shown as Chart.
+	Histogram *Histogram `json:"histogram,omitempty" bson:"-"`
+	Chart     *Chart     `json:"-" bson:"-"`
+	// Item is the item of an item page, RSS are the news related to it.
+	Item *RSS `json:"item,omitempty" bson:"-"`
+}
+
+// MaxPage is the last page of a listing that can be browsed to.
+const MaxPage = 100
+
+// Pages returns the number of pages of a listing with a known total.
+func (n *News) Pages() int {
+	if n.PageSize <= 0 || n.Total <= 0 {
+		return 1
+	}
+	return min((n.Total+n.PageSize-1)/n.PageSize, MaxPage+1)
+}
+
+// FirstResult and LastResult number the first and the last item of the
+// page from one, both zero on an empty page.
+func (n *News) FirstResult() int {
+	if len(n.RSS) == 0 {
+		return 0
+	}
+	return n.Page*n.PageSize + 1
+}
+
+func (n *News) LastResult() int {
+	if len(n.RSS) == 0 {
+		return 0
+	}
+	return n.Page*n.PageSize + len(n.RSS)
+}
+
+// HasNext tells whether there is a page after this one.
+func (n *News) HasNext() bool {
+	return n.Page+1 < n.Pages()
+}
+
+// Facets count the search results by category, source and publish day.
+type Facets struct {
+	Categories []FacetValue `json:"categories"`
+	Sources    []FacetValue `json:"sources"`
+	Days       []FacetValue `json:"days"`
+}
+
+// FacetValue is a value of a facet with the number of results having it.
+type FacetValue struct {
+	Value string `json:"value"`
+	// Label is the value shown, e.g. the English name of a category.
+	Label    string `json:"label,omitempty"`
+	Count    int    `json:"count"`
+	Selected bool   `json:"selected,omitempty"`
+	// URL narrows the search to the value, or widens it back when the
+	// value is selected.
+	URL template.URL `json:"-"`
 }
@@ -0,0 +1,54 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type User struct {
+	Id            primitive.ObjectID `json:"id" bson:"_id"`
+	Email         string             `json:"email" bson:"email"`
+	EmailVerified bool               `json:"emailVerified" bson:"emailVerified"`
+	Name          string             `json:"name" bson:"name"`
+	PasswordHash  string             `json:"-" bson:"passwordHash"`
+	Lang          string             `json:"lang" bson:"lang"`
+	Created       time.Time          `json:"created" bson:"created"`
+	LastLogin     time.Time          `json:"lastLogin" bson:"lastLogin"`
+	Preferences   Preferences        `json:"preferences" bson:"preferences"`
+	Alerts        AlertSettings      `json:"alerts" bson:"alerts"`
+	Digest        DigestSettings     `json:"digest" bson:"digest"`
+	Identities    []Identity         `json:"identities,omitempty" bson:"identities,omitempty"`
+}
+
+// Identity is an account at an OpenID Connect provider linked to a user.
+type Identity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"subject" bson:"subject"`
+	Linked   time.Time `json:"linked" bson:"linked"`
+}
+
+// LoginProvider is an OpenID Connect provider offered on the login page.
+type LoginProvider struct {
+	ID   string
+	Name string
+}
+
+// Viewer is the logged in user, if any, the csrf token of the request and
+// the front page preferences of the user or of the anonymous reader.
+type Viewer struct {
+	User        *User
+	CSRF        string
+	Preferences Preferences
+}
+
+// LoginForm holds the submitted values and localized validation errors of
+// the login, signup and password reset forms.
+type LoginForm struct {
+	Form   string
+	Name   string
+	Email  string
+	Token  string
+	Notice string
+	Errors map[string]string
+}
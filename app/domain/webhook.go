@@ -0,0 +1,44 @@
+package domain
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// States of a WebhookDelivery. A delivery is dead when all attempts failed.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+// Webhook is a partner's subscription to new items of a language, narrowed
+// down by a category, a search query or both. Deliveries are signed with
+// the secret.
+type Webhook struct {
+	Id       primitive.ObjectID `json:"id" bson:"_id"`
+	Name     string             `json:"name" bson:"name"`
+	URL      string             `json:"url" bson:"url"`
+	Secret   string             `json:"-" bson:"secret"`
+	Lang     string             `json:"lang" bson:"lang"`
+	Category string             `json:"category,omitempty" bson:"category,omitempty"`
+	Query    string             `json:"query,omitempty" bson:"query,omitempty"`
+	Created  time.Time          `json:"created" bson:"created"`
+}
+
+// WebhookDelivery is an event posted to a webhook, kept as the delivery
+// log and retried until it is delivered or dead.
+type WebhookDelivery struct {
+	Id          primitive.ObjectID `json:"id" bson:"_id"`
+	WebhookId   primitive.ObjectID `json:"webhookId" bson:"webhookId"`
+	Event       string             `json:"event" bson:"event"`
+	Payload     string             `json:"payload" bson:"payload"`
+	Status      string             `json:"status" bson:"status"`
+	Attempts    int                `json:"attempts" bson:"attempts"`
+	NextAttempt time.Time          `json:"nextAttempt" bson:"nextAttempt"`
+	LastStatus  int                `json:"lastStatus,omitempty" bson:"lastStatus,omitempty"`
+	LastError   string             `json:"lastError,omitempty" bson:"lastError,omitempty"`
+	Created     time.Time          `json:"created" bson:"created"`
+	Delivered   time.Time          `json:"delivered,omitempty" bson:"delivered,omitempty"`
+}
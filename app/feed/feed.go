@@ -0,0 +1,253 @@
+// Package feed writes news listings as RSS 2.0, Atom 1.0 and JSON Feed 1.1.
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+)
+
+// Formats and their content types
+var ContentTypes = map[string]string{
+	"rss":  "application/rss+xml; charset=utf-8",
+	"atom": "application/atom+xml; charset=utf-8",
+	"json": "application/feed+json; charset=utf-8",
+}
+
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	FeedURL     string
+	Language    string
+	Items       []domain.RSS
+}
+
+// Write encodes the feed in format, one of the keys of ContentTypes.
+func (f *Feed) Write(format string) ([]byte, error) {
+	switch format {
+	case "rss":
+		return f.RSS()
+	case "atom":
+		return f.Atom()
+	default:
+		return f.JSONFeed()
+	}
+}
+
+func (f *Feed) updated() time.Time {
+	var updated time.Time
+	for _, item := range f.Items {
+		if item.PubDate.After(updated) {
+			updated = item.PubDate
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	return updated.UTC()
+}
+
+func (f *Feed) category(item domain.RSS) string {
+	if f.Language == "en" && item.Category.CategoryEnName != "" {
+		return item.Category.CategoryEnName
+	}
+	return item.Category.CategoryName
+}
+
+func itemID(item domain.RSS) string {
+	return "tag:uutispuro.fi,2015:" + item.Id.Hex()
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLink      atomLink  `xml:"atom:link"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title    string     `xml:"title"`
+	Link     string     `xml:"link"`
+	GUID     rssGUID    `xml:"guid"`
+	PubDate  string     `xml:"pubDate"`
+	Category string     `xml:"category,omitempty"`
+	Source   *rssSource `xml:"source,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+func (f *Feed) RSS() ([]byte, error) {
+	doc := rss{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			Language:      f.Language,
+			LastBuildDate: f.updated().Format(time.RFC1123Z),
+			AtomLink:      atomLink{Href: f.FeedURL, Rel: "self", Type: "application/rss+xml"},
+			Items:         []rssItem{},
+		},
+	}
+	for _, item := range f.Items {
+		entry := rssItem{
+			Title:    item.RssTitle,
+			Link:     item.RssLink,
+			GUID:     rssGUID{Value: itemID(item)},
+			PubDate:  item.PubDate.UTC().Format(time.RFC1123Z),
+			Category: f.category(item),
+		}
+		if item.RssFeed.Url != "" {
+			entry.Source = &rssSource{URL: item.RssFeed.Url, Name: item.RssSource}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+	return marshalXML(doc)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Lang    string      `xml:"xml:lang,attr"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title     string        `xml:"title"`
+	ID        string        `xml:"id"`
+	Link      atomLink      `xml:"link"`
+	Published string        `xml:"published"`
+	Updated   string        `xml:"updated"`
+	Author    atomAuthor    `xml:"author"`
+	Category  *atomCategory `xml:"category,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+func (f *Feed) Atom() ([]byte, error) {
+	doc := atomFeed{
+		Lang:    f.Language,
+		Title:   f.Title,
+		ID:      f.FeedURL,
+		Updated: f.updated().Format(time.RFC3339),
+		Links: []atomLink{
+			{Href: f.FeedURL, Rel: "self", Type: "application/atom+xml"},
+			{Href: f.Link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	for _, item := range f.Items {
+		published := item.PubDate.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			Title:     item.RssTitle,
+			ID:        itemID(item),
+			Link:      atomLink{Href: item.RssLink, Rel: "alternate"},
+			Published: published,
+			Updated:   published,
+			Author:    atomAuthor{Name: item.RssSource},
+		}
+		if category := f.category(item); category != "" {
+			entry.Category = &atomCategory{Term: category}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshalXML(doc)
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+func (f *Feed) JSONFeed() ([]byte, error) {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.FeedURL,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       []jsonFeedItem{},
+	}
+	for _, item := range f.Items {
+		entry := jsonFeedItem{
+			ID:            itemID(item),
+			URL:           item.RssLink,
+			Title:         item.RssTitle,
+			ContentText:   item.RssTitle,
+			DatePublished: item.PubDate.UTC().Format(time.RFC3339),
+		}
+		if item.RssSource != "" {
+			entry.Authors = []jsonFeedAuthor{{Name: item.RssSource, URL: item.RssFeed.SiteUrl}}
+		}
+		if category := f.category(item); category != "" {
+			entry.Tags = []string{category}
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+	return json.Marshal(doc)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
@@ -0,0 +1,105 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testFeed() *Feed {
+	return &Feed{
+		Title:    "Uutispuro - Talous",
+		Link:     "https://www.uutispuro.fi/fi/category/talous",
+		FeedURL:  "https://www.uutispuro.fi/fi/category/talous/feed.rss",
+		Language: "en",
+		Items: []domain.RSS{{
+			Id:        primitive.NewObjectID(),
+			RssTitle:  "Korot <nousevat> & hinnat",
+			RssLink:   "https://example.com/a?b=1&c=2",
+			PubDate:   time.Date(2026, 5, 4, 3, 2, 1, 0, time.UTC),
+			RssSource: "Yle",
+			Category:  domain.Category{CategoryName: "Talous", CategoryEnName: "Economy"},
+		}},
+	}
+}
+
+func TestRSS(t *testing.T) {
+	out, err := testFeed().RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct {
+		Items []struct {
+			Title    string `xml:"title"`
+			Link     string `xml:"link"`
+			PubDate  string `xml:"pubDate"`
+			Category string `xml:"category"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("rss is not well-formed: %v", err)
+	}
+	if len(doc.Items) != 1 {
+		t.Fatalf("expected one item, got %d", len(doc.Items))
+	}
+	item := doc.Items[0]
+	if item.Title != "Korot <nousevat> & hinnat" || item.Link != "https://example.com/a?b=1&c=2" {
+		t.Errorf("title or link not escaped properly: %+v", item)
+	}
+	if item.PubDate != "Mon, 04 May 2026 03:02:01 +0000" {
+		t.Errorf("unexpected pubDate %s", item.PubDate)
+	}
+	if item.Category != "Economy" {
+		t.Errorf("expected english category name, got %s", item.Category)
+	}
+}
+
+func TestAtom(t *testing.T) {
+	out, err := testFeed().Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `<feed xmlns="http://www.w3.org/2005/Atom" xml:lang="en">`) {
+		t.Errorf("missing atom namespace or language:\n%s", out)
+	}
+	var doc struct {
+		Entries []struct {
+			ID        string `xml:"id"`
+			Published string `xml:"published"`
+			Author    string `xml:"author>name"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(out, &doc); err != nil {
+		t.Fatalf("atom is not well-formed: %v", err)
+	}
+	if len(doc.Entries) != 1 || doc.Entries[0].Author != "Yle" || doc.Entries[0].Published != "2026-05-04T03:02:01Z" {
+		t.Errorf("unexpected entries %+v", doc.Entries)
+	}
+	if !strings.HasPrefix(doc.Entries[0].ID, "tag:uutispuro.fi,2015:") {
+		t.Errorf("unexpected entry id %s", doc.Entries[0].ID)
+	}
+}
+
+func TestJSONFeed(t *testing.T) {
+	out, err := testFeed().JSONFeed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(out, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["version"] != "https://jsonfeed.org/version/1.1" {
+		t.Errorf("unexpected version %v", doc["version"])
+	}
+	items := doc["items"].([]interface{})
+	item := items[0].(map[string]interface{})
+	if item["date_published"] != "2026-05-04T03:02:01Z" || item["url"] != "https://example.com/a?b=1&c=2" {
+		t.Errorf("unexpected item %v", item)
+	}
+}
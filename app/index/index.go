@@ -0,0 +1,190 @@
+// Package index is an inverted index of news items, an alternative to
+// searching the news collection in Mongo. It is kept in memory, optionally
+// saved to a file, fed by ingestion and rebuilt from the store when there is
+// no file. Matches are ranked with BM25.
+package index
+
+import (
+	"encoding/gob"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// format is the version of the saved index, an index saved in another
+// format is rebuilt.
+const format = 1
+
+// doc is an indexed item. Only the fields searched are kept, the items are
+// fetched from the store for showing.
+type doc struct {
+	Id         primitive.ObjectID
+	Title      string
+	Lang       string
+	Source     string
+	Category   string
+	CategoryEn string
+	PubDate    time.Time
+}
+
+// posting is a document with the number of times a token appears in it.
+type posting struct {
+	doc int32
+	tf  int32
+}
+
+// occurrence is a document with the positions of a word in its title.
+type occurrence struct {
+	doc       int32
+	positions []int32
+}
+
+// Index maps the analyzed tokens and the words of titles to the items they
+// appear in. Documents are numbered in the order they were added, so every
+// list of documents is sorted.
+type Index struct {
+	mutex      sync.RWMutex
+	docs       []doc
+	deleted    []bool
+	lengths    []int32
+	ids        map[primitive.ObjectID]int32
+	tokens     map[string][]posting
+	words      map[string][]occurrence
+	sources    map[string][]int32
+	categories map[string][]int32
+	live       int
+	// totalLength is the sum of the token counts of live documents.
+	totalLength int64
+	// last is the largest id added, ingestion continues from it.
+	last primitive.ObjectID
+}
+
+func New() *Index {
+	return &Index{
+		ids:        map[primitive.ObjectID]int32{},
+		tokens:     map[string][]posting{},
+		words:      map[string][]occurrence{},
+		sources:    map[string][]int32{},
+		categories: map[string][]int32{},
+	}
+}
+
+// Len returns the number of items in the index.
+func (x *Index) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return x.live
+}
+
+// Last returns the largest id in the index.
+func (x *Index) Last() primitive.ObjectID {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return x.last
+}
+
+// Add indexes items. An item already in the index replaces the old version
+// when its searched fields have changed.
+func (x *Index) Add(items []domain.RSS) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for _, item := range items {
+		x.add(doc{
+			Id:         item.Id,
+			Title:      item.RssTitle,
+			Lang:       item.Language,
+			Source:     item.RssSource,
+			Category:   item.Category.CategoryName,
+			CategoryEn: item.Category.CategoryEnName,
+			PubDate:    item.PubDate,
+		})
+	}
+}
+
+func (x *Index) add(d doc) {
+	if n, ok := x.ids[d.Id]; ok {
+		if x.docs[n] == d {
+			return
+		}
+		x.deleted[n] = true
+		x.live--
+		x.totalLength -= int64(x.lengths[n])
+	}
+	n := int32(len(x.docs))
+	x.docs = append(x.docs, d)
+	x.deleted = append(x.deleted, false)
+	x.ids[d.Id] = n
+	if d.Id.Hex() > x.last.Hex() {
+		x.last = d.Id
+	}
+
+	counts := map[string]int32{}
+	positions := map[string][]int32{}
+	length := int32(0)
+	for i, word := range analyze.Words(d.Title) {
+		positions[word] = append(positions[word], int32(i))
+		for _, token := range analyze.WordTokens(d.Lang, word) {
+			counts[token]++
+			length++
+		}
+	}
+	for token, tf := range counts {
+		x.tokens[token] = append(x.tokens[token], posting{doc: n, tf: tf})
+	}
+	for word, pos := range positions {
+		x.words[word] = append(x.words[word], occurrence{doc: n, positions: pos})
+	}
+	source := strings.ToLower(d.Source)
+	x.sources[source] = append(x.sources[source], n)
+	for _, name := range []string{d.Category, d.CategoryEn} {
+		if name = strings.ToLower(name); name != "" {
+			list := x.categories[name]
+			if len(list) == 0 || list[len(list)-1] != n {
+				x.categories[name] = append(list, n)
+			}
+		}
+	}
+	x.lengths = append(x.lengths, length)
+	x.live++
+	x.totalLength += int64(length)
+}
+
+type saved struct {
+	Format int
+	Docs   []doc
+}
+
+// Save writes the items of the index to w.
+func (x *Index) Save(w io.Writer) error {
+	x.mutex.RLock()
+	s := saved{Format: format, Docs: make([]doc, 0, x.live)}
+	for n, d := range x.docs {
+		if !x.deleted[n] {
+			s.Docs = append(s.Docs, d)
+		}
+	}
+	x.mutex.RUnlock()
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Load reads an index saved with Save. The titles are analyzed again, so a
+// changed analyzer takes effect on load.
+func Load(r io.Reader) (*Index, error) {
+	s := saved{}
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return nil, err
+	}
+	x := New()
+	if s.Format != format {
+		return x, nil
+	}
+	for _, d := range s.Docs {
+		x.add(d)
+	}
+	return x, nil
+}
@@ -0,0 +1,208 @@
+package index
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testItems() []domain.RSS {
+	items := []domain.RSS{
+		{RssTitle: "Euroopan keskuspankki nosti korkoa", RssSource: "Yle", Category: domain.Category{CategoryName: "Talous", CategoryEnName: "Economy"}},
+		{RssTitle: "Asuntolainat kallistuvat", RssSource: "HS", Category: domain.Category{CategoryName: "Talous", CategoryEnName: "Economy"}},
+		{RssTitle: "Korko, korko ja korko: lainan korko nousee", RssSource: "Yle", Category: domain.Category{CategoryName: "Talous", CategoryEnName: "Economy"}},
+		{RssTitle: "Poliisi tutkii ryöstöä", RssSource: "HS", Category: domain.Category{CategoryName: "Kotimaa", CategoryEnName: "Domestic"}},
+		{RssTitle: "Korkojen nousu jatkuu", RssSource: "Iltalehti", Category: domain.Category{CategoryName: "Talous", CategoryEnName: "Economy"}},
+	}
+	for i := range items {
+		items[i].Id = primitive.NewObjectID()
+		items[i].Language = "fi"
+		items[i].PubDate = now.Add(-time.Duration(len(items)-i) * time.Hour)
+	}
+	return items
+}
+
+func search(t *testing.T, x *Index, q string, order string) []primitive.ObjectID {
+	t.Helper()
+	node, err := query.Parse(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := x.Search(node, "fi", order, 0, 10, nil, now)
+	if result.Total != len(result.Ids) {
+		t.Errorf("%s: total %d differs from %d results", q, result.Total, len(result.Ids))
+	}
+	return result.Ids
+}
+
+// TestSearch tests the matches of the query language
+func TestSearch(t *testing.T) {
+	items := testItems()
+	x := New()
+	x.Add(items)
+	id := func(i ...int) []primitive.ObjectID {
+		result := []primitive.ObjectID{}
+		for _, n := range i {
+			result = append(result, items[n].Id)
+		}
+		return result
+	}
+	tests := map[string][]primitive.ObjectID{
+		"korko":                   id(4, 2, 0),
+		"laina":                   id(2, 1),
+		"korko -source:yle":       id(4),
+		"category:economy nousu":  id(4),
+		`"euroopan keskuspankki"`: id(0),
+		`"keskuspankki euroopan"`: id(),
+		"kork*":                   id(4, 2, 0),
+		"korko-lain*":             id(2),
+		"ja-lain*":                id(),
+		"poliisi OR asuntolaina":  id(3, 1),
+		"-category:talous":        id(3),
+		"after:2026-02-28 korko":  id(4, 2, 0),
+		"before:2026-02-28":       id(),
+		"category:x":              id(),
+	}
+	for q, expected := range tests {
+		if got := search(t, x, q, service.SortDate); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", q, expected, got)
+		}
+	}
+
+	node, _ := query.Parse("korko")
+	result := x.Search(node, "fi", service.SortDate, 1, 1, []primitive.ObjectID{items[4].Id}, now)
+	if result.Total != 2 || !reflect.DeepEqual(result.Ids, id(0)) {
+		t.Errorf("Paging with an excluded item gave %v of %d", result.Ids, result.Total)
+	}
+	if result := x.Search(node, "en", service.SortDate, 0, 10, nil, now); len(result.Ids) != 0 {
+		t.Errorf("Items of other languages should not match, got %v", result.Ids)
+	}
+}
+
+// TestRelevance tests ranking by BM25 score boosted by recency
+func TestRelevance(t *testing.T) {
+	items := testItems()
+	x := New()
+	x.Add(items)
+	got := search(t, x, "korko", service.SortRelevance)
+	// the repeated term wins, the shortest title comes before the longer
+	// newer one
+	expected := []primitive.ObjectID{items[2].Id, items[4].Id, items[0].Id}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestReplace tests that changed items replace their old version
+func TestReplace(t *testing.T) {
+	items := testItems()
+	x := New()
+	x.Add(items)
+	x.Add(items[:1])
+	if x.Len() != len(items) {
+		t.Errorf("Adding an unchanged item should not change the index, got %d items", x.Len())
+	}
+	items[0].RssTitle = "Pörssi nousi"
+	x.Add(items[:1])
+	if x.Len() != len(items) {
+		t.Errorf("A changed item should replace the old one, got %d items", x.Len())
+	}
+	if got := search(t, x, "keskuspankki", service.SortDate); len(got) != 0 {
+		t.Errorf("The old title should not match, got %v", got)
+	}
+	if got := search(t, x, "pörssi", service.SortDate); !reflect.DeepEqual(got, []primitive.ObjectID{items[0].Id}) {
+		t.Errorf("The new title should match, got %v", got)
+	}
+}
+
+// TestSaveLoad tests that a saved index loads with the same items
+func TestSaveLoad(t *testing.T) {
+	items := testItems()
+	x := New()
+	x.Add(items)
+	var buf bytes.Buffer
+	if err := x.Save(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != x.Len() || loaded.Last() != x.Last() {
+		t.Errorf("Loaded %d items up to %v, saved %d up to %v", loaded.Len(), loaded.Last(), x.Len(), x.Last())
+	}
+	for _, q := range []string{"korko", `"euroopan keskuspankki"`, "source:hs"} {
+		if got, expected := search(t, loaded, q, service.SortRelevance), search(t, x, q, service.SortRelevance); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v from the loaded index, got %v", q, expected, got)
+		}
+	}
+}
+
+// TestFacets tests counting the matches by category, source and day
+func TestFacets(t *testing.T) {
+	items := testItems()
+	items[0].PubDate = items[0].PubDate.AddDate(0, 0, -1)
+	x := New()
+	x.Add(items)
+	node, _ := query.Parse("korko OR poliisi")
+	facets := x.Search(node, "fi", service.SortDate, 0, 1, nil, now).Facets
+	expected := domain.Facets{
+		Categories: []domain.FacetValue{{Value: "Talous", Count: 3}, {Value: "Kotimaa", Count: 1}},
+		Sources:    []domain.FacetValue{{Value: "Yle", Count: 2}, {Value: "HS", Count: 1}, {Value: "Iltalehti", Count: 1}},
+		Days: []domain.FacetValue{
+			{Value: items[4].PubDate.In(time.Local).Format(service.DayFormat), Count: 3},
+			{Value: items[0].PubDate.In(time.Local).Format(service.DayFormat), Count: 1},
+		},
+	}
+	if !reflect.DeepEqual(facets, expected) {
+		t.Errorf("Expected %v, got %v", expected, facets)
+	}
+	if facets := x.Search(node, "en", service.SortDate, 0, 1, nil, now).Facets; len(facets.Categories) != 0 {
+		t.Errorf("Nothing found should have empty facets, got %v", facets)
+	}
+}
+
+// TestCatchUp tests that items ingested while the index is loaded leave no
+// gap in the items read from the store
+func TestCatchUp(t *testing.T) {
+	store := []domain.RSS{}
+	for i := 0; i < 2*loadBatch+10; i++ {
+		store = append(store, domain.RSS{Id: primitive.NewObjectID(), RssTitle: "Korko nousee", Language: "fi", PubDate: now})
+	}
+	newer := domain.RSS{Id: primitive.NewObjectID(), RssTitle: "Uusi uutinen", Language: "fi", PubDate: now}
+	s := &Searcher{index: New()}
+	s.itemsAfter = func(id primitive.ObjectID, limit int) ([]domain.RSS, error) {
+		if id.IsZero() {
+			// ingestion adds a newer item after the first batch is read
+			defer s.Add([]domain.RSS{newer})
+		}
+		result := []domain.RSS{}
+		for _, item := range store {
+			if item.Id.Hex() > id.Hex() && len(result) < limit {
+				result = append(result, item)
+			}
+		}
+		return result, nil
+	}
+	s.Load()
+	if !s.ready || s.current().Len() != len(store)+1 {
+		t.Errorf("Expected %d items indexed, got %d", len(store)+1, s.current().Len())
+	}
+
+	failing := &Searcher{index: New(), itemsAfter: func(id primitive.ObjectID, limit int) ([]domain.RSS, error) {
+		return nil, errors.New("connection refused")
+	}}
+	failing.Load()
+	if failing.ready {
+		t.Error("An index that failed to load should not be used")
+	}
+}
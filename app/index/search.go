@@ -0,0 +1,389 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// weights of the kinds of terms in the score, a phrase counts each word
+const (
+	termWeight   = 1.0
+	prefixWeight = 0.5
+)
+
+// Result is a page of the ids of the items found with the number and the
+// facets of all of them.
+type Result struct {
+	Ids    []primitive.ObjectID
+	Total  int
+	Facets domain.Facets
+}
+
+// Search returns a page of the items in lang node matches, newest first or
+// by relevance. Relevance is the BM25 score of the title boosted for new
+// items like in Mongo searches.
+func (x *Index) Search(node query.Node, lang string, order string, from int, count int, exclude []primitive.ObjectID, now time.Time) Result {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	excluded := make(map[primitive.ObjectID]bool, len(exclude))
+	for _, id := range exclude {
+		excluded[id] = true
+	}
+	matched := []int32{}
+	for _, n := range x.eval(node, lang) {
+		if d := x.docs[n]; d.Lang == lang && !excluded[d.Id] {
+			matched = append(matched, n)
+		}
+	}
+
+	if order == service.SortRelevance {
+		scores := x.scores(node, lang, matched, now)
+		sort.SliceStable(matched, func(i, j int) bool {
+			if scores[matched[i]] != scores[matched[j]] {
+				return scores[matched[i]] > scores[matched[j]]
+			}
+			return x.newer(matched[i], matched[j])
+		})
+	} else {
+		sort.Slice(matched, func(i, j int) bool { return x.newer(matched[i], matched[j]) })
+	}
+
+	result := Result{Ids: []primitive.ObjectID{}, Total: len(matched), Facets: x.facets(matched, lang)}
+	for i := from; i >= 0 && i < len(matched) && len(result.Ids) < count; i++ {
+		result.Ids = append(result.Ids, x.docs[matched[i]].Id)
+	}
+	return result
+}
+
+// facets counts docs by category, source and day.
+func (x *Index) facets(docs []int32, lang string) domain.Facets {
+	categories, sources, days := map[string]int{}, map[string]int{}, map[string]int{}
+	for _, n := range docs {
+		d := x.docs[n]
+		categories[d.Category]++
+		sources[d.Source]++
+		days[d.PubDate.In(time.Local).Format(service.DayFormat)]++
+	}
+	return service.CountedFacets(categories, sources, days, lang)
+}
+
+// newer orders documents newest first, the later added first on a tie.
+func (x *Index) newer(a int32, b int32) bool {
+	if !x.docs[a].PubDate.Equal(x.docs[b].PubDate) {
+		return x.docs[a].PubDate.After(x.docs[b].PubDate)
+	}
+	return a > b
+}
+
+// eval returns the live documents node matches.
+func (x *Index) eval(node query.Node, lang string) []int32 {
+	switch n := node.(type) {
+	case query.And:
+		var result []int32
+		for i, child := range n {
+			if i == 0 {
+				result = x.eval(child, lang)
+			} else if not, ok := child.(query.Not); ok {
+				result = difference(result, x.eval(not.Node, lang))
+			} else {
+				result = intersect(result, x.eval(child, lang))
+			}
+		}
+		return result
+	case query.Or:
+		var result []int32
+		for _, child := range n {
+			result = union(result, x.eval(child, lang))
+		}
+		return result
+	case query.Not:
+		return difference(x.all(), x.eval(n.Node, lang))
+	case query.Field:
+		return x.field(n)
+	case nil:
+		return nil
+	}
+	return x.alive(keys(x.leaf(node, lang)))
+}
+
+// all returns every live document.
+func (x *Index) all() []int32 {
+	result := make([]int32, 0, x.live)
+	for n := range x.docs {
+		if !x.deleted[n] {
+			result = append(result, int32(n))
+		}
+	}
+	return result
+}
+
+// alive leaves the replaced documents out of docs.
+func (x *Index) alive(docs []int32) []int32 {
+	result := docs[:0]
+	for _, n := range docs {
+		if !x.deleted[n] {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func (x *Index) field(f query.Field) []int32 {
+	switch f.Name {
+	case "source":
+		return x.alive(append([]int32(nil), x.sources[strings.ToLower(f.Value)]...))
+	case "category":
+		return x.alive(append([]int32(nil), x.categories[strings.ToLower(f.Value)]...))
+	}
+	result := []int32{}
+	for n, d := range x.docs {
+		if x.deleted[n] {
+			continue
+		}
+		if (f.Name == "after" && !d.PubDate.Before(f.Date)) || (f.Name == "before" && d.PubDate.Before(f.Date)) {
+			result = append(result, int32(n))
+		}
+	}
+	return result
+}
+
+// leaf returns the documents a term, prefix or phrase matches with the
+// number of times it appears in each.
+func (x *Index) leaf(node query.Node, lang string) map[int32]int32 {
+	result := map[int32]int32{}
+	switch n := node.(type) {
+	case query.Term:
+		stem, parts := analyze.Term(lang, string(n))
+		for _, p := range x.tokens[stem] {
+			result[p.doc] = p.tf
+		}
+		// a compound also matches items with all of its parts
+		if len(parts) > 0 {
+			var docs []int32
+			for i, part := range parts {
+				list := make([]int32, len(x.tokens[part]))
+				for j, p := range x.tokens[part] {
+					list[j] = p.doc
+				}
+				if i == 0 {
+					docs = list
+				} else {
+					docs = intersect(docs, list)
+				}
+			}
+			for _, d := range docs {
+				if result[d] == 0 {
+					result[d] = 1
+				}
+			}
+		}
+	case query.Prefix:
+		// a prefix with punctuation is a phrase ending with a prefix
+		words := analyze.Words(string(n))
+		if len(words) == 0 {
+			return result
+		}
+		last := x.prefixed(words[len(words)-1])
+		if len(words) == 1 {
+			for _, o := range last {
+				result[o.doc] += int32(len(o.positions))
+			}
+			return result
+		}
+		return x.phrase(append(x.phraseWords(words[:len(words)-1]), last))
+	case query.Phrase:
+		return x.phrase(x.phraseWords(n))
+	}
+	return result
+}
+
+// prefixed returns the occurrences of the words starting with prefix
+// merged by document.
+func (x *Index) prefixed(prefix string) []occurrence {
+	positions := map[int32][]int32{}
+	for word, occurrences := range x.words {
+		if strings.HasPrefix(word, prefix) {
+			for _, o := range occurrences {
+				positions[o.doc] = append(positions[o.doc], o.positions...)
+			}
+		}
+	}
+	result := make([]occurrence, 0, len(positions))
+	for doc, pos := range positions {
+		sort.Slice(pos, func(i, j int) bool { return pos[i] < pos[j] })
+		result = append(result, occurrence{doc: doc, positions: pos})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].doc < result[j].doc })
+	return result
+}
+
+func (x *Index) phraseWords(words []string) [][]occurrence {
+	result := make([][]occurrence, len(words))
+	for i, w := range words {
+		result[i] = x.words[strings.ToLower(w)]
+	}
+	return result
+}
+
+// phrase returns the documents having the words of the occurrences one
+// after another with the number of times they do.
+func (x *Index) phrase(words [][]occurrence) map[int32]int32 {
+	result := map[int32]int32{}
+	for _, list := range words {
+		if len(list) == 0 {
+			return result
+		}
+	}
+	for _, first := range words[0] {
+		if tf := phraseCount(first, words[1:]); tf > 0 {
+			result[first.doc] = tf
+		}
+	}
+	return result
+}
+
+// phraseCount returns how many times the words following first appear
+// right after it in the same document.
+func phraseCount(first occurrence, rest [][]occurrence) int32 {
+	following := make([][]int32, len(rest))
+	for i, list := range rest {
+		j := sort.Search(len(list), func(j int) bool { return list[j].doc >= first.doc })
+		if j == len(list) || list[j].doc != first.doc {
+			return 0
+		}
+		following[i] = list[j].positions
+	}
+	count := int32(0)
+	for _, start := range first.positions {
+		found := true
+		for i, positions := range following {
+			if !containsPosition(positions, start+int32(i)+1) {
+				found = false
+				break
+			}
+		}
+		if found {
+			count++
+		}
+	}
+	return count
+}
+
+func containsPosition(positions []int32, p int32) bool {
+	for _, q := range positions {
+		if q == p {
+			return true
+		}
+	}
+	return false
+}
+
+// scores returns the relevance of docs to the positive terms of node.
+func (x *Index) scores(node query.Node, lang string, docs []int32, now time.Time) map[int32]float64 {
+	result := make(map[int32]float64, len(docs))
+	if x.live == 0 {
+		return result
+	}
+	average := float64(x.totalLength) / float64(x.live)
+	for _, leaf := range query.Positive(node) {
+		matches := x.leaf(leaf, lang)
+		weight := termWeight
+		switch n := leaf.(type) {
+		case query.Prefix:
+			weight = prefixWeight
+		case query.Phrase:
+			weight = termWeight * float64(len(n))
+		}
+		df := float64(len(matches))
+		idf := math.Log(1 + (float64(x.live)-df+0.5)/(df+0.5))
+		for _, d := range docs {
+			tf := float64(matches[d])
+			if tf == 0 {
+				continue
+			}
+			norm := k1 * (1 - b + b*float64(x.lengths[d])/average)
+			result[d] += weight * idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+	for _, d := range docs {
+		result[d] = service.Relevance(result[d], now.Sub(x.docs[d].PubDate))
+	}
+	return result
+}
+
+func keys(m map[int32]int32) []int32 {
+	result := make([]int32, 0, len(m))
+	for k := range m {
+		result = append(result, k)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
+// intersect, union and difference combine sorted lists of documents.
+
+func intersect(a []int32, b []int32) []int32 {
+	result := []int32{}
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+func union(a []int32, b []int32) []int32 {
+	result := make([]int32, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] < b[j]:
+			result = append(result, a[i])
+			i++
+		case a[i] > b[j]:
+			result = append(result, b[j])
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	result = append(result, a[i:]...)
+	return append(result, b[j:]...)
+}
+
+func difference(a []int32, b []int32) []int32 {
+	result := []int32{}
+	j := 0
+	for _, n := range a {
+		for j < len(b) && b[j] < n {
+			j++
+		}
+		if j == len(b) || b[j] != n {
+			result = append(result, n)
+		}
+	}
+	return result
+}
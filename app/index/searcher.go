@@ -0,0 +1,188 @@
+package index
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// loadBatch is how many items are read from the store at a time.
+const loadBatch = 1000
+
+// Searcher answers the searches of the search page from the index and
+// fetches the items found from Mongo. Until the index is loaded Mongo
+// answers them.
+type Searcher struct {
+	Mongo *service.Mongo
+	// File is where the index is saved, empty to keep it only in memory.
+	File  string
+	mutex sync.RWMutex
+	index *Index
+	ready bool
+	dirty bool
+	// itemsAfter reads the items of the store in the order they were added.
+	itemsAfter func(id primitive.ObjectID, limit int) ([]domain.RSS, error)
+}
+
+func NewSearcher(mongo *service.Mongo, file string) *Searcher {
+	return &Searcher{Mongo: mongo, File: file, index: New(), itemsAfter: mongo.ItemsAfter}
+}
+
+// Load reads the saved index, or builds it from the store when there is
+// none, and adds the items added to the store since.
+func (s *Searcher) Load() {
+	if s.File != "" {
+		if x, err := s.read(); err == nil {
+			s.mutex.Lock()
+			s.index = x
+			s.mutex.Unlock()
+		} else if !os.IsNotExist(err) {
+			log.Println("reading search index failed, rebuilding it", err)
+		}
+	}
+	start := time.Now()
+	x := s.current()
+	n, err := s.catchUp(x)
+	if err != nil {
+		// searches stay with Mongo rather than a partial index
+		log.Println("loading search index failed after", n, "items", err)
+		return
+	}
+	log.Println("search index has", x.Len(), "items,", n, "added from the store in", time.Since(start))
+	s.mutex.Lock()
+	s.ready = true
+	s.dirty = s.dirty || n > 0
+	s.mutex.Unlock()
+}
+
+// Rebuild builds a new index of every item in the store, replaces the
+// index with it and saves it. It returns the number of items.
+func (s *Searcher) Rebuild() (int, error) {
+	x := New()
+	if _, err := s.catchUp(x); err != nil {
+		return 0, err
+	}
+	s.mutex.Lock()
+	s.index, s.ready, s.dirty = x, true, true
+	s.mutex.Unlock()
+	return x.Len(), s.save()
+}
+
+// catchUp adds the items added to the store after the last item of x when
+// it starts. Ingestion may add newer items to x meanwhile, so the items are
+// read from where the previous batch ended rather than from the last item
+// of x.
+func (s *Searcher) catchUp(x *Index) (int, error) {
+	count := 0
+	last := x.Last()
+	for {
+		items, err := s.itemsAfter(last, loadBatch)
+		if err != nil {
+			return count, err
+		}
+		x.Add(items)
+		count += len(items)
+		if len(items) < loadBatch {
+			return count, nil
+		}
+		last = items[len(items)-1].Id
+	}
+}
+
+func (s *Searcher) current() *Index {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.index
+}
+
+// Add is an ingest handler indexing new items.
+func (s *Searcher) Add(items []domain.RSS) {
+	s.current().Add(items)
+	s.mutex.Lock()
+	s.dirty = true
+	s.mutex.Unlock()
+}
+
+// Save writes the index to its file when it has changed since it was
+// loaded or last saved.
+func (s *Searcher) Save(now time.Time) {
+	s.mutex.RLock()
+	changed := s.ready && s.dirty
+	s.mutex.RUnlock()
+	if !changed {
+		return
+	}
+	if err := s.save(); err != nil {
+		log.Println("saving search index failed", err)
+	}
+}
+
+func (s *Searcher) save() error {
+	if s.File == "" {
+		return nil
+	}
+	s.mutex.Lock()
+	s.dirty = false
+	s.mutex.Unlock()
+	// a partly written file is never left in place of the previous one
+	f, err := os.CreateTemp(filepath.Dir(s.File), "index-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := s.current().Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.File)
+}
+
+func (s *Searcher) read() (*Index, error) {
+	f, err := os.Open(s.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+// Search returns a page of the items a query of the search language finds,
+// newest first or by relevance, with the matches highlighted, and the
+// facets of all the items found. Parse errors are returned as *query.Error.
+func (s *Searcher) Search(req service.SearchRequest) (service.SearchResult, error) {
+	s.mutex.RLock()
+	ready := s.ready
+	s.mutex.RUnlock()
+	if !ready {
+		return s.Mongo.Search(req)
+	}
+	result := service.SearchResult{Items: []domain.RSS{}}
+	node, err := req.Node()
+	if err != nil || node == nil {
+		return result, err
+	}
+	found := s.current().Search(node, req.Lang, req.Order, req.Page*req.Count, req.Count, req.Exclude, time.Now())
+	result.Items = s.Mongo.ItemsByIds(found.Ids)
+	result.Total = found.Total
+	for i := range result.Items {
+		result.Items[i].Highlight = query.Highlight(node, req.Lang, result.Items[i].RssTitle)
+	}
+	if req.Facets {
+		result.Facets = found.Facets
+	}
+	if req.Lang == "en" {
+		result.Items = util.AddCategoryEnNames(result.Items)
+	}
+	return result, nil
+}
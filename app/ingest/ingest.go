@@ -0,0 +1,83 @@
+// Package ingest notices news items the feed fetcher adds to the database
+// and hands them to the parts of the site that process new items.
+package ingest
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// batchSize is how many new items are handed to the handlers at a time.
+const batchSize = 500
+
+// Handler processes a batch of new items.
+type Handler func(items []domain.RSS)
+
+// Source lists items in the order they were added.
+type Source interface {
+	LatestItemId() primitive.ObjectID
+	ItemsAfter(id primitive.ObjectID, limit int) ([]domain.RSS, error)
+}
+
+// Watcher polls the source for items added since the previous poll. The
+// items are found by their object id, which grows with insertion time.
+type Watcher struct {
+	source   Source
+	mutex    sync.Mutex
+	handlers []Handler
+	last     primitive.ObjectID
+}
+
+func NewWatcher(source Source) *Watcher {
+	return &Watcher{source: source}
+}
+
+// Handle registers a handler for new items. Handlers are called one after
+// another from the polling goroutine.
+func (w *Watcher) Handle(h Handler) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.handlers = append(w.handlers, h)
+}
+
+// Poll hands the items added since the previous poll to the handlers. The
+// first poll only remembers where the collection is.
+func (w *Watcher) Poll(now time.Time) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.last.IsZero() {
+		w.last = w.source.LatestItemId()
+		return
+	}
+	for {
+		items, err := w.source.ItemsAfter(w.last, batchSize)
+		if err != nil {
+			log.Println("finding new items failed", err)
+			return
+		}
+		if len(items) == 0 {
+			return
+		}
+		for _, h := range w.handlers {
+			w.run(h, items)
+		}
+		w.last = items[len(items)-1].Id
+		if len(items) < batchSize {
+			return
+		}
+	}
+}
+
+// run calls a handler so that a panic in one does not stop the others.
+func (w *Watcher) run(h Handler, items []domain.RSS) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Println("ingest handler failed", r)
+		}
+	}()
+	h(items)
+}
@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testSource struct {
+	items []domain.RSS
+}
+
+func (s *testSource) LatestItemId() primitive.ObjectID {
+	if len(s.items) == 0 {
+		return primitive.NilObjectID
+	}
+	return s.items[len(s.items)-1].Id
+}
+
+func (s *testSource) ItemsAfter(id primitive.ObjectID, limit int) ([]domain.RSS, error) {
+	result := []domain.RSS{}
+	for _, item := range s.items {
+		if item.Id.Hex() > id.Hex() && len(result) < limit {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+func (s *testSource) add(n int) {
+	for i := 0; i < n; i++ {
+		s.items = append(s.items, domain.RSS{Id: primitive.NewObjectID()})
+	}
+}
+
+// TestWatcher tests that every new item is handed to every handler once
+func TestWatcher(t *testing.T) {
+	source := &testSource{}
+	source.add(3)
+	watcher := NewWatcher(source)
+	var first, second int
+	watcher.Handle(func(items []domain.RSS) { first += len(items) })
+	watcher.Handle(func(items []domain.RSS) { panic("broken handler") })
+	watcher.Handle(func(items []domain.RSS) { second += len(items) })
+
+	watcher.Poll(time.Now())
+	if first != 0 {
+		t.Errorf("Existing items should not be handled, got %d", first)
+	}
+	source.add(batchSize + 2)
+	watcher.Poll(time.Now())
+	watcher.Poll(time.Now())
+	if first != batchSize+2 || second != batchSize+2 {
+		t.Errorf("Expected %d new items for both handlers, got %d and %d", batchSize+2, first, second)
+	}
+}
@@ -0,0 +1,194 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Message is an email with a plain text and an html body. Headers are
+// added to the standard header fields, e.g. List-Unsubscribe.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Mailer delivers messages.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewMailer returns an SMTP mailer when SMTP_ADDR is set and otherwise a
+// mailer writing the messages to MAIL_DIR, or to the log when it is unset.
+func NewMailer() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Uutispuro <noreply@uutispuro.fi>"
+	}
+	if addr := os.Getenv("SMTP_ADDR"); addr != "" {
+		return &SMTPMailer{
+			Addr:     addr,
+			Username: os.Getenv("SMTP_USER"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+	log.Println("SMTP_ADDR not set, emails are not sent")
+	return &FileMailer{Dir: os.Getenv("MAIL_DIR"), From: from}
+}
+
+// SMTPMailer sends messages through an SMTP server, using PLAIN auth when
+// a username is given.
+type SMTPMailer struct {
+	Addr     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host, _, err := net.SplitHostPort(m.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+	from, err := envelopeAddress(m.From)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, auth, from, []string{msg.To}, compose(m.From, msg, time.Now()))
+}
+
+// FileMailer writes each message as an .eml file into Dir, or logs it when
+// Dir is empty. It stands in for SMTP in development and tests.
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	data := compose(m.From, msg, time.Now())
+	if m.Dir == "" {
+		log.Printf("email to %s: %s\n%s", msg.To, msg.Subject, msg.Text)
+		return nil
+	}
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := time.Now().Format("20060102T150405.000000000") + ".eml"
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o644)
+}
+
+func envelopeAddress(from string) (string, error) {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		if j := strings.LastIndex(from, ">"); j > i {
+			return from[i+1 : j], nil
+		}
+		return "", fmt.Errorf("invalid from address %q", from)
+	}
+	return from, nil
+}
+
+// compose builds a multipart/alternative MIME message.
+func compose(from string, msg Message, date time.Time) []byte {
+	b := make([]byte, 12)
+	rand.Read(b)
+	boundary := hex.EncodeToString(b)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	names := make([]string, 0, len(msg.Headers))
+	for name := range msg.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, msg.Headers[name])
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", boundary)
+	writePart(&buf, boundary, "text/plain", msg.Text)
+	if msg.HTML != "" {
+		writePart(&buf, boundary, "text/html", msg.HTML)
+	}
+	fmt.Fprintf(&buf, "--%s--\r\n", boundary)
+	return buf.Bytes()
+}
+
+func writePart(buf *bytes.Buffer, boundary string, contentType string, body string) {
+	fmt.Fprintf(buf, "--%s\r\n", boundary)
+	fmt.Fprintf(buf, "Content-Type: %s; charset=utf-8\r\n", contentType)
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	w := quotedprintable.NewWriter(buf)
+	w.Write([]byte(body))
+	w.Close()
+	buf.WriteString("\r\n")
+}
+
+// Sender renders messages from templates and sends them with a Mailer.
+// Every message name has "<name>_<lang>.subject", "<name>_<lang>.txt" and
+// "<name>_<lang>.html" templates.
+type Sender struct {
+	Mailer Mailer
+	text   *texttemplate.Template
+	html   *template.Template
+}
+
+func NewSender(mailer Mailer, glob string) *Sender {
+	return &Sender{
+		Mailer: mailer,
+		text:   texttemplate.Must(texttemplate.ParseGlob(glob)),
+		html:   template.Must(template.ParseGlob(glob)),
+	}
+}
+
+// Render builds the message name in lang for the recipient.
+func (s *Sender) Render(to string, name string, lang string, data interface{}) (Message, error) {
+	msg := Message{To: to}
+	prefix := name + "_" + lang
+	var subject, text, html bytes.Buffer
+	if err := s.text.ExecuteTemplate(&subject, prefix+".subject", data); err != nil {
+		return msg, err
+	}
+	if err := s.text.ExecuteTemplate(&text, prefix+".txt", data); err != nil {
+		return msg, err
+	}
+	if err := s.html.ExecuteTemplate(&html, prefix+".html", data); err != nil {
+		return msg, err
+	}
+	msg.Subject = strings.TrimSpace(subject.String())
+	msg.Text = strings.TrimSpace(text.String()) + "\n"
+	msg.HTML = html.String()
+	return msg, nil
+}
+
+// Send renders and sends the message name in lang.
+func (s *Sender) Send(to string, name string, lang string, data interface{}) error {
+	msg, err := s.Render(to, name, lang, data)
+	if err != nil {
+		return err
+	}
+	return s.Mailer.Send(msg)
+}
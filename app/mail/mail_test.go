@@ -0,0 +1,87 @@
+package mail
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type account struct {
+	Name string
+	Link string
+}
+
+// TestRender tests that every account email renders in both languages
+func TestRender(t *testing.T) {
+	sender := NewSender(&FileMailer{}, "../../public/mail/*.tmpl")
+	for _, name := range []string{"verify", "reset"} {
+		for _, lang := range []string{"fi", "en"} {
+			msg, err := sender.Render("matti@example.com", name, lang, account{Name: "Matti <M>", Link: "https://www.uutispuro.fi/x?token=a&b"})
+			if err != nil {
+				t.Fatalf("%s_%s: %v", name, lang, err)
+			}
+			if msg.Subject == "" || strings.Contains(msg.Subject, "\n") {
+				t.Errorf("%s_%s: bad subject %q", name, lang, msg.Subject)
+			}
+			if !strings.Contains(msg.Text, "Matti <M>") || !strings.Contains(msg.Text, "token=a&b") {
+				t.Errorf("%s_%s: text body should contain the name and link as is:\n%s", name, lang, msg.Text)
+			}
+			if !strings.Contains(msg.HTML, "Matti &lt;M&gt;") || !strings.Contains(msg.HTML, "token=a&amp;b") {
+				t.Errorf("%s_%s: html body should be escaped:\n%s", name, lang, msg.HTML)
+			}
+		}
+	}
+}
+
+// TestFileMailer tests that messages are written as parseable multipart emails
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir, From: "Uutispuro <noreply@uutispuro.fi>"}
+	err := mailer.Send(Message{To: "matti@example.com", Subject: "Hyvää päivää", Text: "tekstiä\n", HTML: "<p>tekstiä</p>",
+		Headers: map[string]string{"List-Unsubscribe": "<https://www.uutispuro.fi/unsubscribe?token=a>"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one file, got %d", len(files))
+	}
+	f, _ := os.Open(files[0])
+	defer f.Close()
+	msg, err := netmail.ReadMessage(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Header.Get("List-Unsubscribe") != "<https://www.uutispuro.fi/unsubscribe?token=a>" {
+		t.Errorf("Expected the extra header, got %q", msg.Header.Get("List-Unsubscribe"))
+	}
+	subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if subject != "Hyvää päivää" {
+		t.Errorf("Expected decoded subject, got %q", subject)
+	}
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	var types []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(part)
+		if !strings.Contains(string(body), "tekstiä") {
+			t.Errorf("Part %s did not decode: %q", part.Header.Get("Content-Type"), body)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+	}
+	if len(types) != 2 || !strings.HasPrefix(types[0], "text/plain") || !strings.HasPrefix(types[1], "text/html") {
+		t.Errorf("Expected text and html parts, got %v", types)
+	}
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	mw "github.com/labstack/echo/v4/middleware"
+)
+
+// Admin protects the admin pages with basic auth using the ADMIN_USER and
+// ADMIN_PASSWORD environment variables. Without them the pages are closed.
+func Admin() echo.MiddlewareFunc {
+	user := os.Getenv("ADMIN_USER")
+	password := os.Getenv("ADMIN_PASSWORD")
+	return mw.BasicAuthWithConfig(mw.BasicAuthConfig{
+		Realm: "uutispuro admin",
+		Validator: func(u string, p string, c echo.Context) (bool, error) {
+			if user == "" || password == "" {
+				return false, nil
+			}
+			userOk := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+			passwordOk := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+			return userOk && passwordOk, nil
+		},
+	})
+}
+
+// CSRF checks the X-CSRF-Token header or the _csrf form field of unsafe
+// requests against a cookie. The JSON api, websockets and static files are
+// not protected by it.
+func CSRF() echo.MiddlewareFunc {
+	return mw.CSRFWithConfig(mw.CSRFConfig{
+		Skipper:        skipNonPages,
+		TokenLookup:    "header:X-CSRF-Token,form:_csrf",
+		CookieName:     "_csrf",
+		CookiePath:     "/",
+		CookieHTTPOnly: true,
+		CookieSameSite: http.SameSiteLaxMode,
+	})
+}
+
+func skipNonPages(c echo.Context) bool {
+	path := c.Request().URL.Path
+	for _, prefix := range []string{"/api/", "/public/", "/ws/"} {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// APIKeyStore finds keys and counts their use.
+type APIKeyStore interface {
+	FindAPIKey(key string) *domain.APIKey
+	RecordAPIKeyUsage(id primitive.ObjectID, allowed bool)
+}
+
+// APIKeyContextKey is the echo context key of the authenticated *domain.APIKey.
+const APIKeyContextKey = "apiKey"
+
+// APIKey authenticates requests with an "Authorization: Bearer" key and
+// enforces the per-key quota with a token bucket.
+func APIKey(store APIKeyStore) echo.MiddlewareFunc {
+	limiter := newRateLimiter()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			auth := c.Request().Header.Get(echo.HeaderAuthorization)
+			token, found := strings.CutPrefix(auth, "Bearer ")
+			var key *domain.APIKey
+			if found && token != "" {
+				key = store.FindAPIKey(strings.TrimSpace(token))
+			}
+			if key == nil {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer realm="uutispuro"`)
+				return c.JSON(http.StatusUnauthorized, domain.NewAPIError(http.StatusUnauthorized,
+					"unauthorized", "a valid api key is required in the Authorization header"))
+			}
+
+			allowed, retryAfter := limiter.take(key, time.Now())
+			store.RecordAPIKeyUsage(key.Id, allowed)
+			if !allowed {
+				seconds := int(math.Ceil(retryAfter.Seconds()))
+				c.Response().Header().Set("Retry-After", strconv.Itoa(seconds))
+				return c.JSON(http.StatusTooManyRequests, domain.NewAPIError(http.StatusTooManyRequests,
+					"quota_exceeded", "quota of "+strconv.Itoa(key.RatePerMinute)+" requests per minute exceeded"))
+			}
+			c.Set(APIKeyContextKey, key)
+			return next(c)
+		}
+	}
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	mutex   sync.Mutex
+	buckets map[primitive.ObjectID]*tokenBucket
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[primitive.ObjectID]*tokenBucket)}
+}
+
+// take removes a token from the key's bucket. When the bucket is empty it
+// returns how long until the next token is available.
+func (l *rateLimiter) take(key *domain.APIKey, now time.Time) (bool, time.Duration) {
+	rate := float64(key.RatePerMinute) / 60
+	burst := float64(key.Burst)
+	if burst < 1 {
+		burst = math.Max(1, float64(key.RatePerMinute))
+	}
+	if rate <= 0 {
+		return false, time.Minute
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, ok := l.buckets[key.Id]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key.Id] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / rate * float64(time.Second))
+}
@@ -0,0 +1,97 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type testKeyStore struct {
+	key               *domain.APIKey
+	allowed, rejected int
+}
+
+func (s *testKeyStore) FindAPIKey(key string) *domain.APIKey {
+	if key == "secret" {
+		return s.key
+	}
+	return nil
+}
+
+func (s *testKeyStore) RecordAPIKeyUsage(id primitive.ObjectID, allowed bool) {
+	if allowed {
+		s.allowed++
+	} else {
+		s.rejected++
+	}
+}
+
+// TestTokenBucket tests that the bucket allows a burst and then refills at the rate
+func TestTokenBucket(t *testing.T) {
+	key := &domain.APIKey{Id: primitive.NewObjectID(), RatePerMinute: 60, Burst: 3}
+	limiter := newRateLimiter()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.take(key, now); !ok {
+			t.Fatalf("Request %d of the burst should be allowed", i+1)
+		}
+	}
+	ok, retryAfter := limiter.take(key, now)
+	if ok {
+		t.Fatal("Request over the burst should be rejected")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("Expected retry within a second at 60 requests per minute, got %v", retryAfter)
+	}
+	if ok, _ := limiter.take(key, now.Add(time.Second)); !ok {
+		t.Error("A token should have been refilled after a second")
+	}
+}
+
+// TestAPIKeyMiddleware tests authentication and quota responses
+func TestAPIKeyMiddleware(t *testing.T) {
+	store := &testKeyStore{key: &domain.APIKey{Id: primitive.NewObjectID(), RatePerMinute: 1, Burst: 1}}
+	e := echo.New()
+	e.GET("/api/v1/items", func(c echo.Context) error {
+		if c.Get(APIKeyContextKey) != store.key {
+			t.Error("Authenticated key missing from context")
+		}
+		return c.NoContent(http.StatusOK)
+	}, APIKey(store))
+
+	request := func(auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/items", nil)
+		if auth != "" {
+			req.Header.Set(echo.HeaderAuthorization, auth)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := request(""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Missing key: expected 401, got %d", rec.Code)
+	}
+	if rec := request("Bearer wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Wrong key: expected 401, got %d", rec.Code)
+	}
+	if rec := request("Bearer secret"); rec.Code != http.StatusOK {
+		t.Errorf("Valid key: expected 200, got %d", rec.Code)
+	}
+	rec := request("Bearer secret")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("Over quota: expected 429, got %d", rec.Code)
+	}
+	if retry := rec.Header().Get("Retry-After"); retry != "60" {
+		t.Errorf("Expected Retry-After 60, got %q", retry)
+	}
+	if store.allowed != 1 || store.rejected != 1 {
+		t.Errorf("Expected one allowed and one rejected request, got %d and %d", store.allowed, store.rejected)
+	}
+}
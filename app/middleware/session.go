@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// SessionCookie holds the signed session token of a logged in user.
+	SessionCookie = "session"
+	// UserContextKey is the echo context key of the logged in *domain.User.
+	UserContextKey = "user"
+	// PreferencesCookie holds the front page preferences of anonymous readers.
+	PreferencesCookie = "prefs"
+	// PreferencesContextKey is the echo context key of the domain.Preferences
+	// of the request.
+	PreferencesContextKey = "preferences"
+)
+
+// SessionStore finds the user of a session token.
+type SessionStore interface {
+	FindSession(token string) *domain.User
+}
+
+// Session loads the user of the session cookie into the echo context.
+func Session(store SessionStore, cookies *util.CookieUtil) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// clicks are recorded as read by the logged in user
+			if skipNonPages(c) && !strings.HasPrefix(c.Request().URL.Path, "/api/click/") {
+				return next(c)
+			}
+			if token, ok := cookies.SignedCookie(SessionCookie, c); ok {
+				if user := store.FindSession(token); user != nil {
+					c.Set(UserContextKey, user)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// Preferences loads the front page preferences of the logged in user, or of
+// an anonymous reader from the preferences cookie, into the echo context.
+// It has to run after Session.
+func Preferences(cookies *util.CookieUtil) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if skipNonPages(c) {
+				return next(c)
+			}
+			if user := CurrentUser(c); user != nil {
+				c.Set(PreferencesContextKey, user.Preferences)
+			} else if value, ok := cookies.SignedCookie(PreferencesCookie, c); ok {
+				p := domain.Preferences{}
+				if err := json.Unmarshal([]byte(value), &p); err == nil {
+					c.Set(PreferencesContextKey, p)
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// SetPreferencesCookie stores the preferences of an anonymous reader.
+func SetPreferencesCookie(cookies *util.CookieUtil, p domain.Preferences, c echo.Context) error {
+	if p.Empty() && !p.HideRead {
+		cookies.DeleteCookie(PreferencesCookie, c)
+		return nil
+	}
+	value, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	cookies.SetSignedCookie(PreferencesCookie, string(value), 365*24*time.Hour, c)
+	return nil
+}
+
+// CurrentPreferences returns the front page preferences of the request.
+func CurrentPreferences(c echo.Context) domain.Preferences {
+	p, _ := c.Get(PreferencesContextKey).(domain.Preferences)
+	return p
+}
+
+// CurrentUser returns the logged in user or nil.
+func CurrentUser(c echo.Context) *domain.User {
+	user, _ := c.Get(UserContextKey).(*domain.User)
+	return user
+}
+
+// CurrentViewer returns the logged in user and csrf token of the request.
+func CurrentViewer(c echo.Context) domain.Viewer {
+	token, _ := c.Get("csrf").(string)
+	return domain.Viewer{User: CurrentUser(c), CSRF: token, Preferences: CurrentPreferences(c)}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+type testSessionStore struct {
+	user *domain.User
+}
+
+func (s *testSessionStore) FindSession(token string) *domain.User {
+	if token == "token" {
+		return s.user
+	}
+	return nil
+}
+
+// TestSession tests that only a correctly signed session cookie logs the user in
+func TestSession(t *testing.T) {
+	cookies := util.NewCookieUtil("secret")
+	store := &testSessionStore{user: &domain.User{Name: "Matti"}}
+	e := echo.New()
+	e.GET("/set", func(c echo.Context) error {
+		cookies.SetSignedCookie(SessionCookie, "token", time.Hour, c)
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/", func(c echo.Context) error {
+		if user := CurrentUser(c); user != nil {
+			return c.String(http.StatusOK, user.Name)
+		}
+		return c.String(http.StatusOK, "anonymous")
+	}, Session(store, cookies))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/set", nil))
+	signed := rec.Result().Cookies()[0]
+	if !signed.HttpOnly {
+		t.Error("Session cookie should be http only")
+	}
+
+	request := func(cookie *http.Cookie) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Body.String()
+	}
+	if body := request(nil); body != "anonymous" {
+		t.Errorf("Without a cookie expected anonymous, got %q", body)
+	}
+	if body := request(signed); body != "Matti" {
+		t.Errorf("With a signed cookie expected Matti, got %q", body)
+	}
+	tampered := &http.Cookie{Name: SessionCookie, Value: "dG9rZW4.forged"}
+	if body := request(tampered); body != "anonymous" {
+		t.Errorf("With a forged signature expected anonymous, got %q", body)
+	}
+	other := util.NewCookieUtil("other secret")
+	e.GET("/other", func(c echo.Context) error {
+		other.SetSignedCookie(SessionCookie, "token", time.Hour, c)
+		return c.NoContent(http.StatusOK)
+	})
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+	if body := request(rec.Result().Cookies()[0]); body != "anonymous" {
+		t.Errorf("A cookie signed with another secret expected anonymous, got %q", body)
+	}
+}
@@ -0,0 +1,380 @@
+// Package oidc logs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE. Provider endpoints and signing keys
+// are found with discovery, and ID tokens signed with RS256 are validated
+// before their claims are trusted.
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// discoveryTTL is how long the provider configuration is cached.
+	discoveryTTL = time.Hour
+	// keyRefetch limits fetching the signing keys for unknown key ids.
+	keyRefetch = time.Minute
+	// clockSkew is allowed between the provider's clock and ours.
+	clockSkew = 2 * time.Minute
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid id token")
+	ErrUnknownKey   = errors.New("id token signed with an unknown key")
+)
+
+// Client is a relying party of one provider.
+type Client struct {
+	// ID names the provider in urls and linked identities, e.g. "google".
+	ID string
+	// Name is shown on the login button.
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	HTTP         *http.Client
+
+	mutex      sync.Mutex
+	discovery  *Discovery
+	discovered time.Time
+	keys       map[string]*rsa.PublicKey
+	keysFetch  time.Time
+}
+
+// Discovery is the part of the provider configuration the client uses.
+type Discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims are the validated claims of an ID token.
+type Claims struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp"`
+	Expires       int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce"`
+	Email         string   `json:"email"`
+	EmailVerified flexBool `json:"email_verified"`
+	Name          string   `json:"name"`
+}
+
+// audience is a string or an array of strings.
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if json.Unmarshal(b, &single) == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(b, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// flexBool is a boolean some providers send as a string.
+type flexBool bool
+
+func (f *flexBool) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	*f = flexBool(s == "true")
+	return nil
+}
+
+// NewClients configures the providers listed in OIDC_PROVIDERS, e.g.
+// "google,microsoft". Each provider <P> is configured with OIDC_<P>_ISSUER,
+// OIDC_<P>_CLIENT_ID, OIDC_<P>_CLIENT_SECRET and optionally OIDC_<P>_NAME
+// and OIDC_<P>_REDIRECT_URL, which defaults to
+// <siteURL>/login/<provider>/callback.
+func NewClients(siteURL string) []*Client {
+	var clients []*Client
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		env := func(name string) string {
+			return os.Getenv("OIDC_" + strings.ToUpper(id) + "_" + name)
+		}
+		redirectURL := env("REDIRECT_URL")
+		if redirectURL == "" {
+			redirectURL = siteURL + "/login/" + id + "/callback"
+		}
+		name := env("NAME")
+		if name == "" {
+			name = strings.ToUpper(id[:1]) + id[1:]
+		}
+		clients = append(clients, &Client{
+			ID:           id,
+			Name:         name,
+			Issuer:       env("ISSUER"),
+			ClientID:     env("CLIENT_ID"),
+			ClientSecret: env("CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			HTTP:         &http.Client{Timeout: 10 * time.Second},
+		})
+	}
+	return clients
+}
+
+// Discover returns the provider configuration, fetched from the issuer's
+// well-known address.
+func (c *Client) Discover() (*Discovery, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.discovery != nil && time.Since(c.discovered) < discoveryTTL {
+		return c.discovery, nil
+	}
+	d := &Discovery{}
+	if err := c.getJSON(strings.TrimSuffix(c.Issuer, "/")+"/.well-known/openid-configuration", d); err != nil {
+		return nil, err
+	}
+	if d.Issuer != c.Issuer {
+		return nil, fmt.Errorf("provider issuer %q does not match %q", d.Issuer, c.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("provider configuration is missing endpoints")
+	}
+	c.discovery, c.discovered = d, time.Now()
+	return d, nil
+}
+
+// AuthURL is the address the user is sent to log in at the provider.
+func (c *Client) AuthURL(state string, nonce string, verifier string) (string, error) {
+	d, err := c.Discover()
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(d.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", c.ClientID)
+	q.Set("redirect_uri", c.RedirectURL)
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", Challenge(verifier))
+	q.Set("code_challenge_method", "S256")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// Exchange trades the authorization code for tokens and returns the
+// validated claims of the ID token.
+func (c *Client) Exchange(code string, verifier string, nonce string) (*Claims, error) {
+	d, err := c.Discover()
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {c.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if c.ClientSecret == "" {
+		form.Set("client_id", c.ClientID)
+	}
+	req, err := http.NewRequest(http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if c.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(c.ClientSecret))
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded %s: %s", resp.Status, body)
+	}
+	tokens := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id token")
+	}
+	return c.Verify(tokens.IDToken, nonce, time.Now())
+}
+
+// Verify checks the signature, issuer, audience, lifetime and nonce of the
+// ID token and returns its claims.
+func (c *Client) Verify(idToken string, nonce string, now time.Time) (*Claims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	key, err := c.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	claims := &Claims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Issuer != c.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if !claims.Audience.contains(c.ClientID) || (len(claims.Audience) > 1 && claims.AuthorizedBy != c.ClientID) {
+		return nil, fmt.Errorf("%w: audience %v", ErrInvalidToken, claims.Audience)
+	}
+	if now.After(time.Unix(claims.Expires, 0).Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce does not match", ErrInvalidToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// key returns the signing key with the id, fetching the provider's keys
+// again when the id is unknown, as providers rotate their keys.
+func (c *Client) key(kid string) (*rsa.PublicKey, error) {
+	d, err := c.Discover()
+	if err != nil {
+		return nil, err
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	if c.keys != nil && time.Since(c.keysFetch) < keyRefetch {
+		return nil, ErrUnknownKey
+	}
+	set := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}{}
+	c.keysFetch = time.Now()
+	if err := c.getJSON(d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	c.keys = map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		c.keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (c *Client) getJSON(address string, v interface{}) error {
+	resp, err := c.HTTP.Get(address)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %s", address, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// RandomString returns a url safe random string for states, nonces and
+// PKCE verifiers.
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge is the S256 PKCE code challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,197 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// provider is a stand-in OpenID Connect provider. It issues a code for
+// every authorization request and checks the PKCE verifier when the code
+// is exchanged.
+type provider struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	mutex  sync.Mutex
+	codes  map[string]url.Values
+	claims map[string]interface{}
+}
+
+func newProvider(t *testing.T) *provider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &provider{key: key, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.URL,
+			"authorization_endpoint": p.URL + "/authorize",
+			"token_endpoint":         p.URL + "/token",
+			"jwks_uri":               p.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "key1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, secret, _ := r.BasicAuth()
+		p.mutex.Lock()
+		auth, ok := p.codes[r.FormValue("code")]
+		delete(p.codes, r.FormValue("code"))
+		p.mutex.Unlock()
+		if !ok || user != "client" || secret != "secret" ||
+			Challenge(r.FormValue("code_verifier")) != auth.Get("code_challenge") ||
+			r.FormValue("redirect_uri") != auth.Get("redirect_uri") {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":            p.URL,
+			"sub":            "12345",
+			"aud":            "client",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          auth.Get("nonce"),
+			"email":          "matti@example.com",
+			"email_verified": true,
+			"name":           "Matti",
+		}
+		for k, v := range p.claims {
+			claims[k] = v
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, "key1", claims), "token_type": "Bearer"})
+	})
+	p.Server = httptest.NewServer(mux)
+	return p
+}
+
+func (p *provider) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// authorize plays the user logging in at the provider and returns the code
+func (p *provider) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, p.URL+"/authorize") {
+		t.Fatalf("Unexpected auth url %s", authURL)
+	}
+	code, _ := RandomString()
+	p.mutex.Lock()
+	p.codes[code] = u.Query()
+	p.mutex.Unlock()
+	return code
+}
+
+func (p *provider) client() *Client {
+	return &Client{ID: "test", Issuer: p.URL, ClientID: "client", ClientSecret: "secret",
+		RedirectURL: "https://www.uutispuro.fi/login/test/callback", HTTP: p.Client()}
+}
+
+// TestLogin tests the authorization code flow with PKCE against the stand-in provider
+func TestLogin(t *testing.T) {
+	p := newProvider(t)
+	defer p.Close()
+	c := p.client()
+	state, _ := RandomString()
+	nonce, _ := RandomString()
+	verifier, _ := RandomString()
+	authURL, err := c.AuthURL(state, nonce, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, _ := url.ParseQuery(authURL[strings.Index(authURL, "?")+1:])
+	if q.Get("state") != state || q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == verifier ||
+		!strings.Contains(q.Get("scope"), "openid") {
+		t.Errorf("Unexpected authorization request %v", q)
+	}
+	code := p.authorize(t, authURL)
+	claims, err := c.Exchange(code, verifier, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "12345" || claims.Email != "matti@example.com" || !claims.EmailVerified || claims.Name != "Matti" {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+
+	code = p.authorize(t, authURL)
+	if _, err := c.Exchange(code, "wrong verifier", nonce); err == nil {
+		t.Error("Exchange with a wrong PKCE verifier should fail")
+	}
+}
+
+// TestInvalidTokens tests that tokens failing any check are rejected
+func TestInvalidTokens(t *testing.T) {
+	p := newProvider(t)
+	defer p.Close()
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": p.URL, "sub": "12345", "aud": "client", "nonce": "n",
+			"exp": now.Add(time.Hour).Unix(), "iat": now.Unix(),
+		}
+	}
+	c := p.client()
+	if _, err := c.Verify(p.sign(t, "key1", valid()), "n", now); err != nil {
+		t.Fatalf("Valid token rejected: %v", err)
+	}
+	cases := map[string]func(map[string]interface{}){
+		"issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil.example.com" },
+		"audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"azp":      func(c map[string]interface{}) { c["aud"] = []string{"client", "other"} },
+		"expired":  func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() },
+		"future":   func(c map[string]interface{}) { c["iat"] = now.Add(time.Hour).Unix() },
+		"nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+		"subject":  func(c map[string]interface{}) { delete(c, "sub") },
+	}
+	for name, change := range cases {
+		claims := valid()
+		change(claims)
+		if _, err := c.Verify(p.sign(t, "key1", claims), "n", now); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected an invalid token, got %v", name, err)
+		}
+	}
+
+	token := p.sign(t, "key1", valid())
+	tampered := strings.Split(token, ".")
+	claims, _ := json.Marshal(map[string]interface{}{"iss": p.URL, "sub": "admin", "aud": "client", "nonce": "n",
+		"exp": now.Add(time.Hour).Unix(), "iat": now.Unix()})
+	tampered[1] = base64.RawURLEncoding.EncodeToString(claims)
+	if _, err := c.Verify(strings.Join(tampered, "."), "n", now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Tampered token: expected an invalid token, got %v", err)
+	}
+	if _, err := c.Verify(p.sign(t, "key2", valid()), "n", now); err != ErrUnknownKey {
+		t.Errorf("Unknown key: expected ErrUnknownKey, got %v", err)
+	}
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + tampered[1] + "."
+	if _, err := c.Verify(none, "n", now); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Unsigned token: expected an invalid token, got %v", err)
+	}
+}
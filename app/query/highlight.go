@@ -0,0 +1,167 @@
+package query
+
+import (
+	"html"
+	"html/template"
+	"sort"
+	"strings"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+)
+
+// span is a part of a text by byte offsets.
+type span struct {
+	start, end int
+}
+
+// wordSpans splits text to words the same way the title regexes do.
+func wordSpans(text string) []span {
+	var spans []span
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			spans = append(spans, span{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, span{start, len(text)})
+	}
+	return spans
+}
+
+// Positive returns the terms, prefixes and phrases a match of node can
+// contain, leaving out the negated ones.
+func Positive(node Node) []Node {
+	return positive(node, false, nil)
+}
+
+func positive(node Node, negated bool, result []Node) []Node {
+	switch n := node.(type) {
+	case And:
+		for _, child := range n {
+			result = positive(child, negated, result)
+		}
+	case Or:
+		for _, child := range n {
+			result = positive(child, negated, result)
+		}
+	case Not:
+		result = positive(n.Node, !negated, result)
+	case Term, Prefix, Phrase:
+		if !negated {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// weights of matches in Score, a phrase counts each of its words
+const (
+	termWeight   = 1.0
+	prefixWeight = 0.5
+)
+
+// matches returns where the positive terms of node appear in text in lang
+// and a score of how well they match.
+func matches(node Node, lang string, text string) ([]span, float64) {
+	words := wordSpans(text)
+	lower := make([]string, len(words))
+	tokens := make([][]string, len(words))
+	for i, w := range words {
+		lower[i] = strings.ToLower(text[w.start:w.end])
+		tokens[i] = analyze.WordTokens(lang, lower[i])
+	}
+	var found []span
+	score := 0.0
+	// like Mongo's text score, matches in short texts weigh more
+	coefficient := 0.5 * (1 + 1/float64(max(len(words), 1)))
+	for _, leaf := range Positive(node) {
+		var stem string
+		var parts []string
+		if term, ok := leaf.(Term); ok {
+			stem, parts = analyze.Term(lang, string(term))
+		}
+		for i := range lower {
+			switch n := leaf.(type) {
+			case Term:
+				if containsAll(tokens[i], stem) || (len(parts) > 0 && containsAll(tokens[i], parts...)) {
+					found = append(found, words[i])
+					score += termWeight * coefficient
+				}
+			case Prefix:
+				if strings.HasPrefix(lower[i], strings.ToLower(string(n))) {
+					found = append(found, words[i])
+					score += prefixWeight * coefficient
+				}
+			case Phrase:
+				if i+len(n) > len(lower) {
+					continue
+				}
+				equal := true
+				for j, w := range n {
+					if lower[i+j] != strings.ToLower(w) {
+						equal = false
+						break
+					}
+				}
+				if equal {
+					found = append(found, span{words[i].start, words[i+len(n)-1].end})
+					score += termWeight * float64(len(n)) * coefficient
+				}
+			}
+		}
+	}
+	return found, score
+}
+
+func containsAll(tokens []string, values ...string) bool {
+	for _, v := range values {
+		found := false
+		for _, t := range tokens {
+			if t == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Score returns how well text in lang matches the terms of node, zero when
+// none of them appear.
+func Score(node Node, lang string, text string) float64 {
+	_, score := matches(node, lang, text)
+	return score
+}
+
+// Highlight returns text in lang as html with the terms of node wrapped in
+// mark elements.
+func Highlight(node Node, lang string, text string) template.HTML {
+	found, _ := matches(node, lang, text)
+	sort.Slice(found, func(i, j int) bool { return found[i].start < found[j].start })
+	var b strings.Builder
+	at := 0
+	for i := 0; i < len(found); i++ {
+		s := found[i]
+		// overlapping matches share one mark
+		for i+1 < len(found) && found[i+1].start <= s.end {
+			i++
+			s.end = max(s.end, found[i].end)
+		}
+		b.WriteString(html.EscapeString(text[at:s.start]))
+		b.WriteString("<mark>" + html.EscapeString(text[s.start:s.end]) + "</mark>")
+		at = s.end
+	}
+	b.WriteString(html.EscapeString(text[at:]))
+	return template.HTML(b.String())
+}
@@ -0,0 +1,53 @@
+package query
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Normalize returns the canonical lower case form of a query, so that
+// differently written searches for the same thing count as one. Invalid and
+// empty queries give an empty string.
+func Normalize(input string) string {
+	node, err := Parse(input)
+	if err != nil || node == nil {
+		return ""
+	}
+	return strings.ToLower(node.String())
+}
+
+var (
+	email = regexp.MustCompile(`[^\s@"]+@[^\s@"]+\.[^\s@"]+`)
+	// personalCode is a Finnish personal identity code, e.g. 131052-308T.
+	personalCode = regexp.MustCompile(`(?i)\b\d{6}[-+a-fu-y]\d{3}[0-9a-y]\b`)
+	date         = regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}\b`)
+	// number is a run of digits with the separators of phone and account
+	// numbers.
+	number = regexp.MustCompile(`\+?\d[\d\s\-/().]*\d`)
+)
+
+// minPersonalDigits is the length of a number taken for a phone, account or
+// card number.
+const minPersonalDigits = 7
+
+// Personal tells whether a query looks like it contains personal data: an
+// email address, a personal identity code or a phone or account number.
+// Such queries are not logged.
+func Personal(input string) bool {
+	if email.MatchString(input) || personalCode.MatchString(input) {
+		return true
+	}
+	for _, n := range number.FindAllString(date.ReplaceAllString(input, " "), -1) {
+		digits := 0
+		for _, r := range n {
+			if unicode.IsDigit(r) {
+				digits++
+			}
+		}
+		if digits >= minPersonalDigits {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,353 @@
+package query
+
+import (
+	"strings"
+	"time"
+	"unicode"
+)
+
+type kind int
+
+const (
+	tWord kind = iota
+	tPhrase
+	tField
+	tAnd
+	tOr
+	tNot
+	tOpen
+	tClose
+)
+
+type token struct {
+	kind   kind
+	pos    int
+	text   string
+	words  []string
+	prefix bool
+	field  Field
+}
+
+// Parse parses a query. A query without any terms parses to nil, errors
+// are of type *Error.
+func Parse(input string) (Node, error) {
+	runes := []rune(input)
+	if len(runes) > MaxLength {
+		return nil, &Error{Pos: MaxLength + 1, Code: "long"}
+	}
+	tokens, lexErr := lex(runes)
+	if lexErr != nil {
+		return nil, lexErr
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	p := &parser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t != nil {
+		return nil, &Error{Pos: t.pos, Code: "open"}
+	}
+	return node, nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+func splitWords(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool { return !isWordRune(r) })
+}
+
+func isKnownField(name string) bool {
+	for _, field := range Fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func lex(runes []rune) ([]token, *Error) {
+	var tokens []token
+	// quoted reads the text between quotation marks starting at i
+	quoted := func(i int) (string, int, *Error) {
+		for j := i + 1; j < len(runes); j++ {
+			if runes[j] == '"' {
+				return string(runes[i+1 : j]), j + 1, nil
+			}
+		}
+		return "", 0, &Error{Pos: i + 1, Code: "quote"}
+	}
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tOpen, pos: i + 1, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tClose, pos: i + 1, text: ")"})
+			i++
+		case r == '"':
+			text, next, err := quoted(i)
+			if err != nil {
+				return nil, err
+			}
+			words := splitWords(text)
+			if len(words) == 0 {
+				return nil, &Error{Pos: i + 1, Code: "phrase"}
+			}
+			tokens = append(tokens, token{kind: tPhrase, pos: i + 1, words: words})
+			i = next
+		case r == '-':
+			// a minus negates the term right after it, a lone one is ignored
+			if i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && runes[i+1] != ')' {
+				tokens = append(tokens, token{kind: tNot, pos: i + 1, text: "-"})
+			}
+			i++
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && !strings.ContainsRune(`()"`, runes[i]) {
+				i++
+			}
+			text := string(runes[start:i])
+			t := token{pos: start + 1, text: text}
+			switch text {
+			case "AND":
+				t.kind = tAnd
+			case "OR":
+				t.kind = tOr
+			case "NOT":
+				t.kind = tNot
+			default:
+				if colon := strings.IndexRune(text, ':'); colon > 0 && strings.IndexFunc(text[:colon], func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+					name := strings.ToLower(text[:colon])
+					if !isKnownField(name) {
+						return nil, &Error{Pos: t.pos, Code: "field", Arg: name + ":"}
+					}
+					value := text[colon+1:]
+					if value == "" && i < len(runes) && runes[i] == '"' {
+						var err *Error
+						if value, i, err = quoted(i); err != nil {
+							return nil, err
+						}
+					}
+					field, err := newField(name, strings.TrimSpace(value), t.pos)
+					if err != nil {
+						return nil, err
+					}
+					t.kind, t.field = tField, field
+					break
+				}
+				word, err := lexWord(text, t.pos)
+				if err != nil {
+					return nil, err
+				}
+				if word.kind == tWord && word.text == "" {
+					// punctuation only
+					continue
+				}
+				t = word
+			}
+			tokens = append(tokens, t)
+		}
+	}
+	return tokens, nil
+}
+
+func lexWord(text string, pos int) (token, *Error) {
+	t := token{kind: tWord, pos: pos}
+	if strings.HasSuffix(text, "*") {
+		t.prefix = true
+		text = strings.TrimRight(text, "*")
+	}
+	if strings.Contains(text, "*") {
+		return t, &Error{Pos: pos, Code: "wildcard"}
+	}
+	text = strings.TrimFunc(text, func(r rune) bool { return !isWordRune(r) })
+	if t.prefix {
+		if len([]rune(text)) < minPrefix {
+			return t, &Error{Pos: pos, Code: "wildcard"}
+		}
+		t.text = text
+		return t, nil
+	}
+	// words joined by punctuation, like covid-19, match as a phrase
+	if words := splitWords(text); len(words) > 1 {
+		return token{kind: tPhrase, pos: pos, words: words}, nil
+	}
+	t.text = text
+	return t, nil
+}
+
+func newField(name string, value string, pos int) (Field, *Error) {
+	field := Field{Name: name, Value: value}
+	if value == "" {
+		return field, &Error{Pos: pos, Code: "value", Arg: name + ":"}
+	}
+	if name == "after" || name == "before" {
+		date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return field, &Error{Pos: pos, Code: "date", Arg: value}
+		}
+		field.Date = date
+	}
+	return field, nil
+}
+
+type parser struct {
+	tokens  []token
+	i       int
+	clauses int
+	depth   int
+}
+
+func (p *parser) peek() *token {
+	if p.i < len(p.tokens) {
+		return &p.tokens[p.i]
+	}
+	return nil
+}
+
+func (p *parser) next() *token {
+	t := p.peek()
+	if t != nil {
+		p.i++
+	}
+	return t
+}
+
+// operand checks that a term follows the operator op.
+func (p *parser) operand(op *token) error {
+	if t := p.peek(); t == nil || t.kind == tClose || t.kind == tAnd || t.kind == tOr {
+		return &Error{Pos: op.pos, Code: "operand", Arg: op.text}
+	}
+	return nil
+}
+
+func (p *parser) parseOr() (Node, error) {
+	var nodes Or
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if or, ok := node.(Or); ok {
+			nodes = append(nodes, or...)
+		} else {
+			nodes = append(nodes, node)
+		}
+		t := p.peek()
+		if t == nil || t.kind != tOr {
+			break
+		}
+		p.next()
+		if err := p.operand(t); err != nil {
+			return nil, err
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseAnd() (Node, error) {
+	var nodes And
+	for {
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		if and, ok := node.(And); ok {
+			nodes = append(nodes, and...)
+		} else {
+			nodes = append(nodes, node)
+		}
+		t := p.peek()
+		if t == nil || t.kind == tClose || t.kind == tOr {
+			break
+		}
+		if t.kind == tAnd {
+			p.next()
+			if err := p.operand(t); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return nodes, nil
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t := p.peek()
+	if t == nil || t.kind != tNot {
+		return p.parsePrimary()
+	}
+	p.next()
+	if err := p.operand(t); err != nil {
+		return nil, err
+	}
+	if p.depth++; p.depth > maxDepth {
+		return nil, &Error{Pos: t.pos, Code: "deep"}
+	}
+	node, err := p.parseUnary()
+	p.depth--
+	if err != nil {
+		return nil, err
+	}
+	if not, ok := node.(Not); ok {
+		return not.Node, nil
+	}
+	return Not{Node: node}, nil
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+	switch t.kind {
+	case tOpen:
+		if p.depth++; p.depth > maxDepth {
+			return nil, &Error{Pos: t.pos, Code: "deep"}
+		}
+		if next := p.peek(); next == nil {
+			return nil, &Error{Pos: t.pos, Code: "close"}
+		} else if next.kind == tClose {
+			return nil, &Error{Pos: t.pos, Code: "empty"}
+		}
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if next := p.next(); next == nil || next.kind != tClose {
+			return nil, &Error{Pos: t.pos, Code: "close"}
+		}
+		p.depth--
+		return node, nil
+	case tClose:
+		return nil, &Error{Pos: t.pos, Code: "open"}
+	case tAnd, tOr:
+		return nil, &Error{Pos: t.pos, Code: "start", Arg: t.text}
+	}
+	if p.clauses++; p.clauses > maxClauses {
+		return nil, &Error{Pos: t.pos, Code: "long"}
+	}
+	switch t.kind {
+	case tPhrase:
+		if len(t.words) == 1 {
+			return Term(t.words[0]), nil
+		}
+		return Phrase(t.words), nil
+	case tField:
+		return t.field, nil
+	}
+	if t.prefix {
+		return Prefix(t.text), nil
+	}
+	return Term(t.text), nil
+}
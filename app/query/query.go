@@ -0,0 +1,278 @@
+// Package query parses the search language of the site and compiles it to
+// a Mongo filter on news items.
+//
+// Words match the analyzed tokens of titles, so inflected forms and parts
+// of compound words match too, and combine with AND unless OR is given.
+// NOT or a leading minus excludes and parentheses group. "Quoted words"
+// match as a phrase and a trailing * matches a word prefix, both as written
+// in the title. The fields source:, category:, after: and before: filter by
+// source, category and publish date, after: including its day and before:
+// not.
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	// MaxLength is the longest query accepted, in characters.
+	MaxLength = 500
+	// maxClauses limits the terms and fields of one query.
+	maxClauses = 30
+	// maxDepth limits nested parentheses and negations.
+	maxDepth = 10
+	// minPrefix is the shortest word prefix a wildcard is accepted on.
+	minPrefix = 2
+)
+
+// Fields are the field filters of the language.
+var Fields = []string{"source", "category", "after", "before"}
+
+// Node is a parsed query.
+type Node interface {
+	// Filter returns the Mongo filter matching the node in items of lang.
+	Filter(lang string) bson.M
+	// String returns the node in a canonical form of the language.
+	String() string
+}
+
+// And matches items all of its nodes match.
+type And []Node
+
+// Or matches items any of its nodes match.
+type Or []Node
+
+// Not matches items its node does not match.
+type Not struct {
+	Node Node
+}
+
+// Term matches a word of the title in any inflected form.
+type Term string
+
+// Prefix matches a word of the title starting with it.
+type Prefix string
+
+// Phrase matches consecutive words of the title.
+type Phrase []string
+
+// Field filters by source, category or publish date.
+type Field struct {
+	Name  string
+	Value string
+	Date  time.Time
+}
+
+// word are the characters of a title word, punctuation separates words.
+const word = `\p{L}\p{N}`
+
+func titleRegex(pattern string) bson.M {
+	return bson.M{"rssTitle": bson.M{"$regex": `(^|[^` + word + `])` + pattern, "$options": "i"}}
+}
+
+func equalFold(value string) bson.M {
+	return bson.M{"$regex": "^" + regexp.QuoteMeta(value) + "$", "$options": "i"}
+}
+
+func (n And) Filter(lang string) bson.M {
+	filters := make([]bson.M, len(n))
+	for i, node := range n {
+		filters[i] = node.Filter(lang)
+	}
+	return bson.M{"$and": filters}
+}
+
+func (n Or) Filter(lang string) bson.M {
+	filters := make([]bson.M, len(n))
+	for i, node := range n {
+		filters[i] = node.Filter(lang)
+	}
+	return bson.M{"$or": filters}
+}
+
+func (n Not) Filter(lang string) bson.M {
+	return bson.M{"$nor": []bson.M{n.Node.Filter(lang)}}
+}
+
+func (n Term) Filter(lang string) bson.M {
+	stem, parts := analyze.Term(lang, string(n))
+	if len(parts) == 0 {
+		return bson.M{"tokens": stem}
+	}
+	// a compound also matches items with all of its parts
+	return bson.M{"$or": []bson.M{{"tokens": stem}, {"tokens": bson.M{"$all": parts}}}}
+}
+
+// narrowed adds to the title regex of a filter the tokens of the whole words
+// it matches, so that Mongo finds the candidates from the index of tokens
+// and runs the regex on their titles only.
+func narrowed(filter bson.M, lang string, words []string) bson.M {
+	if len(words) == 0 {
+		return filter
+	}
+	stems := make([]string, len(words))
+	for i, w := range words {
+		stems[i] = analyze.Stem(lang, w)
+	}
+	filter["tokens"] = bson.M{"$all": stems}
+	return filter
+}
+
+func (n Prefix) Filter(lang string) bson.M {
+	text := string(n)
+	words := analyze.Words(text)
+	// the last word is cut unless punctuation ends the prefix
+	cut := len(words) > 0 && strings.TrimRightFunc(text, notWord) == text
+	if cut {
+		words = words[:len(words)-1]
+	}
+	filter := narrowed(titleRegex(regexp.QuoteMeta(text)), lang, words)
+	if cut && lang != "fi" {
+		// tokens other than Finnish stems are the words themselves
+		tokens, _ := filter["tokens"].(bson.M)
+		if tokens == nil {
+			tokens = bson.M{}
+		}
+		last := analyze.Words(text)
+		tokens["$regex"] = "^" + regexp.QuoteMeta(last[len(last)-1])
+		filter["tokens"] = tokens
+	}
+	return filter
+}
+
+func notWord(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+}
+
+func (n Phrase) Filter(lang string) bson.M {
+	words := make([]string, len(n))
+	for i, w := range n {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	filter := titleRegex(strings.Join(words, `[^`+word+`]+`) + `([^` + word + `]|$)`)
+	return narrowed(filter, lang, analyze.Words(strings.Join(n, " ")))
+}
+
+func (n Field) Filter(lang string) bson.M {
+	switch n.Name {
+	case "source":
+		return bson.M{"rssSource": equalFold(n.Value)}
+	case "category":
+		return bson.M{"$or": []bson.M{
+			{"category.categoryName": equalFold(n.Value)},
+			{"category.enName": equalFold(n.Value)},
+		}}
+	case "after":
+		return bson.M{"pubDate": bson.M{"$gte": n.Date}}
+	default:
+		return bson.M{"pubDate": bson.M{"$lt": n.Date}}
+	}
+}
+
+func (n And) String() string {
+	parts := make([]string, len(n))
+	for i, node := range n {
+		parts[i] = node.String()
+		if _, ok := node.(Or); ok {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func (n Or) String() string {
+	parts := make([]string, len(n))
+	for i, node := range n {
+		parts[i] = node.String()
+	}
+	return strings.Join(parts, " OR ")
+}
+
+func (n Not) String() string {
+	switch n.Node.(type) {
+	case And, Or:
+		return "-(" + n.Node.String() + ")"
+	}
+	return "-" + n.Node.String()
+}
+
+func (n Term) String() string   { return string(n) }
+func (n Prefix) String() string { return string(n) + "*" }
+func (n Phrase) String() string { return `"` + strings.Join(n, " ") + `"` }
+
+func (n Field) String() string {
+	if strings.ContainsFunc(n.Value, unicode.IsSpace) {
+		return n.Name + `:"` + n.Value + `"`
+	}
+	return n.Name + ":" + n.Value
+}
+
+// Error is a parse error at a character position of the query.
+type Error struct {
+	// Pos is the position of the error, counting characters from one.
+	Pos  int
+	Code string
+	// Arg is the offending text shown in the message.
+	Arg string
+}
+
+var errorMessages = map[string]map[string]string{
+	"fi": {
+		"quote":    "Lainausmerkki jää sulkematta",
+		"close":    "Sulkeva sulku puuttuu",
+		"open":     "Ylimääräinen sulkeva sulku",
+		"operand":  "Operaattorin %s jälkeen puuttuu hakusana",
+		"start":    "Haku ei voi alkaa operaattorilla %s",
+		"field":    "Tuntematon kenttä %s, käytettävissä ovat source:, category:, after: ja before:",
+		"value":    "Kentän %s arvo puuttuu",
+		"date":     "Päivämäärä %s ei kelpaa, käytä muotoa 2026-01-31",
+		"wildcard": "Tähden pitää olla vähintään kahden kirjaimen sanan lopussa",
+		"phrase":   "Lainausmerkkien sisällä ei ole sanoja",
+		"empty":    "Sulkujen sisällä ei ole hakusanoja",
+		"long":     "Haku on liian pitkä",
+		"deep":     "Haussa on liian monta sisäkkäistä sulkua",
+	},
+	"en": {
+		"quote":    "A quotation mark is not closed",
+		"close":    "A closing parenthesis is missing",
+		"open":     "An extra closing parenthesis",
+		"operand":  "Search terms are missing after the operator %s",
+		"start":    "A search can not start with the operator %s",
+		"field":    "Unknown field %s, the fields are source:, category:, after: and before:",
+		"value":    "The value of the field %s is missing",
+		"date":     "The date %s is not valid, use the form 2026-01-31",
+		"wildcard": "An asterisk must end a word of at least two letters",
+		"phrase":   "There are no words inside the quotation marks",
+		"empty":    "There are no search terms inside the parentheses",
+		"long":     "The search is too long",
+		"deep":     "The search has too many nested parentheses",
+	},
+}
+
+var positionMessages = map[string]string{
+	"fi": "%s (kohta %d)",
+	"en": "%s (at character %d)",
+}
+
+// Message returns the error in lang, fi or en.
+func (e *Error) Message(lang string) string {
+	if lang != "fi" {
+		lang = "en"
+	}
+	message := errorMessages[lang][e.Code]
+	if strings.Contains(message, "%s") {
+		message = fmt.Sprintf(message, e.Arg)
+	}
+	return fmt.Sprintf(positionMessages[lang], message, e.Pos)
+}
+
+func (e *Error) Error() string {
+	return e.Message("en")
+}
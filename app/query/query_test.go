@@ -0,0 +1,254 @@
+package query
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// TestParse tests the canonical form of parsed queries
+func TestParse(t *testing.T) {
+	tests := map[string]string{
+		"talous":                              "talous",
+		"  talous   Suomi ":                   "talous Suomi",
+		"talous AND suomi":                    "talous suomi",
+		"talous OR pörssi":                    "talous OR pörssi",
+		"a OR b c":                            "a OR b c",
+		"(a OR b) c":                          "(a OR b) c",
+		"NOT urheilu":                         "-urheilu",
+		"-urheilu -(jalkapallo OR jääkiekko)": "-urheilu -(jalkapallo OR jääkiekko)",
+		"NOT NOT a":                           "a",
+		`"keskuspankki nosti korkoa"`:         `"keskuspankki nosti korkoa"`,
+		`"korko"`:                             "korko",
+		"covid-19":                            `"covid 19"`,
+		"ilmasto*":                            "ilmasto*",
+		"source:Yle":                          "source:Yle",
+		`Source:"Helsingin Sanomat" vaalit`:   `source:"Helsingin Sanomat" vaalit`,
+		"category:talous after:2026-01-01 before:2026-02-01": "category:talous after:2026-01-01 before:2026-02-01",
+		"klo 12:30": `klo "12 30"`,
+		"a , b":     "a b",
+		"- a":       "a",
+		"":          "",
+	}
+	for input, expected := range tests {
+		node, err := Parse(input)
+		if err != nil {
+			t.Errorf("Parsing %q failed: %v", input, err)
+			continue
+		}
+		got := ""
+		if node != nil {
+			got = node.String()
+		}
+		if got != expected {
+			t.Errorf("Parsing %q expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+// TestParseErrors tests the codes and positions of parse errors
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		code  string
+		pos   int
+	}{
+		{`talous "korko`, "quote", 8},
+		{"(a OR b", "close", 1},
+		{"a) b", "open", 2},
+		{"a AND", "operand", 3},
+		{"a OR OR b", "operand", 3},
+		{"a NOT", "operand", 3},
+		{"OR a", "start", 1},
+		{"author:me", "field", 1},
+		{"source:", "value", 1},
+		{"after:2026-13-01", "date", 1},
+		{"a*b", "wildcard", 1},
+		{"k*", "wildcard", 1},
+		{`""`, "phrase", 1},
+		{"a ()", "empty", 3},
+		{"((((((((((((a))))))))))))", "deep", 11},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parsing %q expected an error, got %v", test.input, err)
+			continue
+		}
+		if e.Code != test.code || e.Pos != test.pos {
+			t.Errorf("Parsing %q expected %s at %d, got %s at %d", test.input, test.code, test.pos, e.Code, e.Pos)
+		}
+	}
+
+	_, err := Parse("a AND")
+	if message := err.(*Error).Message("fi"); message != "Operaattorin AND jälkeen puuttuu hakusana (kohta 3)" {
+		t.Errorf("Unexpected finnish message %q", message)
+	}
+	if message := err.Error(); message != "Search terms are missing after the operator AND (at character 3)" {
+		t.Errorf("Unexpected english message %q", message)
+	}
+}
+
+// TestFilter tests the Mongo filters of the nodes
+func TestFilter(t *testing.T) {
+	node, err := Parse(`-source:yle (korko* OR "euroopan keskuspankki") after:2026-01-01`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters := node.Filter("fi")["$and"].([]bson.M)
+	if len(filters) != 3 {
+		t.Fatalf("Expected three filters, got %v", filters)
+	}
+	source := filters[0]["$nor"].([]bson.M)[0]["rssSource"]
+	if !reflect.DeepEqual(source, bson.M{"$regex": "^yle$", "$options": "i"}) {
+		t.Errorf("Unexpected source filter %v", source)
+	}
+	after := filters[2]["pubDate"].(bson.M)["$gte"].(time.Time)
+	if !after.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Unexpected date %v", after)
+	}
+
+	// the title regexes behave the same in Go as in Mongo
+	matches := func(node Node, title string) bool {
+		pattern := node.Filter("fi")["rssTitle"].(bson.M)["$regex"].(string)
+		return regexp.MustCompile("(?i)" + pattern).MatchString(title)
+	}
+	or := filters[1]["$or"].([]bson.M)
+	if len(or) != 2 {
+		t.Fatalf("Expected two alternatives, got %v", or)
+	}
+	titles := []struct {
+		node  Node
+		title string
+		match bool
+	}{
+		{Prefix("kork"), "Korkojen nousu", true},
+		{Prefix("kork"), "Viinikorkki", false},
+		{Phrase{"euroopan", "keskuspankki"}, "Euroopan keskuspankki nosti", true},
+		{Phrase{"euroopan", "keskuspankki"}, "Euroopan suurin keskuspankki", false},
+		{Phrase{"covid", "19"}, "Covid-19 rokotteet", true},
+		{Prefix("a.b"), "axb", false},
+	}
+	for _, test := range titles {
+		if matches(test.node, test.title) != test.match {
+			t.Errorf("%s matching %q should be %v", test.node, test.title, test.match)
+		}
+	}
+
+	// phrases and prefixes are narrowed by the tokens of their whole words
+	narrowing := []struct {
+		node   Node
+		lang   string
+		tokens bson.M
+	}{
+		{Phrase{"Euroopan", "keskuspankki"}, "fi", bson.M{"$all": []string{"euroop", "keskuspank"}}},
+		{Prefix("covid-19"), "fi", bson.M{"$all": []string{"covid"}}},
+		{Prefix("covid-"), "fi", bson.M{"$all": []string{"covid"}}},
+		{Prefix("kork"), "fi", nil},
+		{Prefix("inter"), "en", bson.M{"$regex": "^inter"}},
+		{Prefix("covid-19"), "en", bson.M{"$all": []string{"covid"}, "$regex": "^19"}},
+	}
+	for _, test := range narrowing {
+		got, _ := test.node.Filter(test.lang)["tokens"].(bson.M)
+		if !reflect.DeepEqual(got, test.tokens) {
+			t.Errorf("%s in %s: expected tokens %v, got %v", test.node, test.lang, test.tokens, got)
+		}
+	}
+
+	// terms match the analyzed tokens, compounds their parts as well
+	if got := Term("Lainat").Filter("fi"); !reflect.DeepEqual(got, bson.M{"tokens": "laina"}) {
+		t.Errorf("Unexpected term filter %v", got)
+	}
+	expected := bson.M{"$or": []bson.M{{"tokens": "asuntolain"}, {"tokens": bson.M{"$all": []string{"asunto", "laina"}}}}}
+	if got := Term("asuntolainat").Filter("fi"); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Unexpected compound filter %v", got)
+	}
+}
+
+// TestHighlight tests marking the matched terms and escaping the rest
+func TestHighlight(t *testing.T) {
+	tests := map[string]string{
+		"korko":                       `Euroopan keskuspankki &amp; <mark>korko</mark>: nousu jatkuu`,
+		`"euroopan keskuspankki"`:     `<mark>Euroopan keskuspankki</mark> &amp; korko: nousu jatkuu`,
+		"kesk* -nousu":                `Euroopan <mark>keskuspankki</mark> &amp; korko: nousu jatkuu`,
+		"source:yle":                  `Euroopan keskuspankki &amp; korko: nousu jatkuu`,
+		`euroopan "euroopan keskus*"`: `<mark>Euroopan</mark> keskuspankki &amp; korko: nousu jatkuu`,
+	}
+	title := "Euroopan keskuspankki & korko: nousu jatkuu"
+	for input, expected := range tests {
+		node, err := Parse(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(Highlight(node, "fi", title)); got != expected {
+			t.Errorf("Highlighting %q expected %s, got %s", input, expected, got)
+		}
+	}
+
+	node, _ := Parse(`korko OR "korko nousee"`)
+	if got := string(Highlight(node, "fi", "Korko nousee")); got != "<mark>Korko nousee</mark>" {
+		t.Errorf("Overlapping matches should share a mark, got %s", got)
+	}
+
+	node, _ = Parse("laina")
+	if got := string(Highlight(node, "fi", "Asuntolainat ja lainan korko")); got != "<mark>Asuntolainat</mark> ja <mark>lainan</mark> korko" {
+		t.Errorf("Inflected and compound forms should be marked, got %s", got)
+	}
+}
+
+// TestScore tests that better matches score higher
+func TestScore(t *testing.T) {
+	node, _ := Parse(`korko* OR "euroopan keskuspankki"`)
+	scores := []float64{
+		Score(node, "fi", "Euroopan keskuspankki nosti korkoa"),
+		Score(node, "fi", "Euroopan keskuspankki kokoontuu"),
+		Score(node, "fi", "Korkojen nousu jatkuu, sanoo pankki"),
+		Score(node, "fi", "Pörssi nousi"),
+	}
+	for i := 1; i < len(scores); i++ {
+		if scores[i-1] <= scores[i] {
+			t.Errorf("Expected decreasing scores, got %v", scores)
+		}
+	}
+	if scores[len(scores)-1] != 0 {
+		t.Errorf("A text without matches should score zero, got %v", scores)
+	}
+}
+
+// TestNormalize tests the logged form of queries
+func TestNormalize(t *testing.T) {
+	tests := map[string]string{
+		"  Talous   AND  Korko ": "talous korko",
+		"Source:YLE":             "source:yle",
+		`"euro`:                  "",
+		"   ":                    "",
+	}
+	for input, expected := range tests {
+		if got := Normalize(input); got != expected {
+			t.Errorf("Normalizing %q expected %q, got %q", input, expected, got)
+		}
+	}
+}
+
+// TestPersonal tests recognizing queries with personal data
+func TestPersonal(t *testing.T) {
+	tests := map[string]bool{
+		"matti.meikalainen@example.com": true,
+		"131052-308T":                   true,
+		"040 123 4567":                  true,
+		"+358 40 1234567":               true,
+		"FI21 1234 5600 0007 85":        true,
+		"covid-19 after:2026-01-01":     false,
+		"vaalit 2027":                   false,
+		"korko 3,5 prosenttia":          false,
+	}
+	for input, expected := range tests {
+		if got := Personal(input); got != expected {
+			t.Errorf("Personal(%q) expected %v, got %v", input, expected, got)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package related finds news similar to an item among recent items. Titles
+// are compared as TF-IDF vectors of their analyzed tokens by cosine
+// similarity, preferring items of other sources and of the same category.
+// The index is built from the database on start and kept up to date as
+// items arrive.
+package related
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Window is how far back related items are looked for.
+	Window = 14 * 24 * time.Hour
+	// minScore leaves out items sharing only a common word or two.
+	minScore = 0.2
+	// boosts of the same category and another source
+	categoryBoost = 1.25
+	sourceBoost   = 1.2
+)
+
+type doc struct {
+	id       primitive.ObjectID
+	lang     string
+	source   string
+	category string
+	pubDate  time.Time
+	title    string
+	tokens   []string
+}
+
+// Index is the tokens of the recent items of each language.
+type Index struct {
+	Mongo *service.Mongo
+	mutex sync.RWMutex
+	docs  map[primitive.ObjectID]*doc
+	// postings are the items having each token of a language, the key is
+	// the language and the token
+	postings map[string]map[primitive.ObjectID]bool
+}
+
+func New(mongo *service.Mongo) *Index {
+	return &Index{
+		Mongo:    mongo,
+		docs:     map[primitive.ObjectID]*doc{},
+		postings: map[string]map[primitive.ObjectID]bool{},
+	}
+}
+
+// Load adds the items of the window from the database.
+func (x *Index) Load() {
+	x.Add(x.Mongo.ItemsSince(time.Now().Add(-Window)))
+}
+
+// Add indexes new items, replacing the ones indexed already. It is an
+// ingest handler, run after the items are analyzed.
+func (x *Index) Add(items []domain.RSS) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for _, item := range items {
+		x.remove(item.Id)
+		d := newDoc(item)
+		x.docs[d.id] = d
+		for _, t := range d.tokens {
+			key := d.lang + ":" + t
+			if x.postings[key] == nil {
+				x.postings[key] = map[primitive.ObjectID]bool{}
+			}
+			x.postings[key][d.id] = true
+		}
+	}
+}
+
+// Prune drops the items published before the window.
+func (x *Index) Prune(now time.Time) {
+	x.mutex.Lock()
+	defer x.mutex.Unlock()
+	for id, d := range x.docs {
+		if d.pubDate.Before(now.Add(-Window)) {
+			x.remove(id)
+		}
+	}
+}
+
+func (x *Index) remove(id primitive.ObjectID) {
+	d, ok := x.docs[id]
+	if !ok {
+		return
+	}
+	for _, t := range d.tokens {
+		key := d.lang + ":" + t
+		delete(x.postings[key], id)
+		if len(x.postings[key]) == 0 {
+			delete(x.postings, key)
+		}
+	}
+	delete(x.docs, id)
+}
+
+// Len returns the number of items indexed.
+func (x *Index) Len() int {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	return len(x.docs)
+}
+
+func newDoc(item domain.RSS) *doc {
+	tokens := item.Tokens
+	if len(tokens) == 0 {
+		tokens = analyze.Tokens(item.Language, item.RssTitle)
+	}
+	return &doc{
+		id:       item.Id,
+		lang:     item.Language,
+		source:   item.RssSource,
+		category: item.Category.CategoryName,
+		pubDate:  item.PubDate,
+		title:    strings.ToLower(strings.Join(analyze.Words(item.RssTitle), " ")),
+		tokens:   tokens,
+	}
+}
+
+// Related returns the ids of at most limit items most similar to item,
+// best first. The item need not be indexed itself. Items with the same
+// title, such as the same news in two feeds of a source, are left out.
+func (x *Index) Related(item domain.RSS, limit int) []primitive.ObjectID {
+	x.mutex.RLock()
+	defer x.mutex.RUnlock()
+	target := newDoc(item)
+	n := float64(len(x.docs))
+	idf := func(token string) float64 {
+		return math.Log(1 + n/float64(1+len(x.postings[target.lang+":"+token])))
+	}
+	weights := map[string]float64{}
+	norm := 0.0
+	for _, t := range target.tokens {
+		weights[t] = idf(t)
+		norm += weights[t] * weights[t]
+	}
+	if norm == 0 {
+		return []primitive.ObjectID{}
+	}
+
+	// the dot products with the items sharing a token
+	dots := map[primitive.ObjectID]float64{}
+	for t, w := range weights {
+		for id := range x.postings[target.lang+":"+t] {
+			dots[id] += w * w
+		}
+	}
+	type match struct {
+		d     *doc
+		score float64
+	}
+	matches := []match{}
+	for id, dot := range dots {
+		d := x.docs[id]
+		if id == target.id || d.title == target.title {
+			continue
+		}
+		dNorm := 0.0
+		for _, t := range d.tokens {
+			w := idf(t)
+			dNorm += w * w
+		}
+		score := dot / math.Sqrt(norm*dNorm)
+		if score < minScore {
+			continue
+		}
+		if d.category == target.category {
+			score *= categoryBoost
+		}
+		if d.source != target.source {
+			score *= sourceBoost
+		}
+		matches = append(matches, match{d, score})
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].d.pubDate.After(matches[j].d.pubDate)
+	})
+	result := []primitive.ObjectID{}
+	for i := 0; i < len(matches) && i < limit; i++ {
+		result = append(result, matches[i].d.id)
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package related
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var now = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func item(title string, source string, category string, lang string) domain.RSS {
+	return domain.RSS{
+		Id:        primitive.NewObjectID(),
+		RssTitle:  title,
+		RssSource: source,
+		Language:  lang,
+		Category:  domain.Category{CategoryName: category},
+		PubDate:   now.Add(-time.Hour),
+	}
+}
+
+// TestRelated tests finding similar titles, preferring other sources and
+// leaving out the item itself, duplicates and other languages
+func TestRelated(t *testing.T) {
+	target := item("Euroopan keskuspankki nosti korkoa", "Yle", "Talous", "fi")
+	otherSource := item("Keskuspankki nosti korkoa jälleen", "HS", "Talous", "fi")
+	sameSource := item("Keskuspankki nosti korkoa jälleen", "Yle", "Talous", "fi")
+	duplicate := item("Euroopan keskuspankki nosti korkoa", "Yle", "Talous", "fi")
+	unrelated := item("HJK voitti jalkapallo-ottelun", "HS", "Urheilu", "fi")
+	english := item("keskuspankki nosti korkoa", "Yle", "Talous", "en")
+	x := New(nil)
+	x.Add([]domain.RSS{target, otherSource, sameSource, duplicate, unrelated, english})
+
+	got := x.Related(target, 10)
+	if len(got) != 2 || got[0] != otherSource.Id || got[1] != sameSource.Id {
+		t.Errorf("related %v, expected %v and %v", got, otherSource.Id, sameSource.Id)
+	}
+	if got := x.Related(target, 1); len(got) != 1 {
+		t.Errorf("limited to %d", len(got))
+	}
+	if got := x.Related(unrelated, 10); len(got) != 0 {
+		t.Errorf("unrelated item has related %v", got)
+	}
+}
+
+// TestCategoryBoost tests preferring items of the same category
+func TestCategoryBoost(t *testing.T) {
+	target := item("Hallitus leikkaa koulutuksesta", "Yle", "Kotimaa", "fi")
+	sameCategory := item("Hallitus leikkaa koulutuksesta lisää", "HS", "Kotimaa", "fi")
+	otherCategory := item("Hallitus leikkaa koulutuksesta lisää", "IL", "Talous", "fi")
+	x := New(nil)
+	x.Add([]domain.RSS{otherCategory, sameCategory})
+	if got := x.Related(target, 10); len(got) != 2 || got[0] != sameCategory.Id {
+		t.Errorf("related %v, expected %v first", got, sameCategory.Id)
+	}
+}
+
+// TestReplaceAndPrune tests replacing an item and dropping old ones
+func TestReplaceAndPrune(t *testing.T) {
+	a := item("Keskuspankki nosti korkoa", "Yle", "Talous", "fi")
+	b := item("Keskuspankki nosti korkoa taas", "HS", "Talous", "fi")
+	x := New(nil)
+	x.Add([]domain.RSS{a, b})
+	b.RssTitle = "HJK voitti"
+	x.Add([]domain.RSS{b})
+	if x.Len() != 2 {
+		t.Errorf("%d items after replacing", x.Len())
+	}
+	if got := x.Related(a, 10); len(got) != 0 {
+		t.Errorf("replaced item still related %v", got)
+	}
+	x.Prune(now.Add(Window))
+	if x.Len() != 0 {
+		t.Errorf("%d items after pruning", x.Len())
+	}
+	if len(x.postings) != 0 {
+		t.Errorf("%d tokens left after pruning", len(x.postings))
+	}
+}
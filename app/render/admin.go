@@ -0,0 +1,51 @@
+package render
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AdminPage is the template data of the admin pages.
+type AdminPage struct {
+	APIKeys      []domain.APIKey
+	NewKey       string
+	Webhooks     []domain.Webhook
+	WebhookNames map[primitive.ObjectID]string
+	Deliveries   []domain.WebhookDelivery
+	DeadLetters  []domain.WebhookDelivery
+	Queries      *domain.QueryReport
+	Notice       string
+	Error        string
+	CSRF         string
+}
+
+func (r *Render) AdminAPIKeys(page AdminPage, c echo.Context, statusCode int) error {
+	var buf bytes.Buffer
+	if err := r.t.templates.ExecuteTemplate(&buf, "admin_apikeys", &page); err != nil {
+		log.Println("rendering page admin_apikeys failed.", err.Error())
+		return err
+	}
+	return r.render(statusCode, buf.Bytes(), c)
+}
+
+func (r *Render) AdminWebhooks(page AdminPage, c echo.Context, statusCode int) error {
+	var buf bytes.Buffer
+	if err := r.t.templates.ExecuteTemplate(&buf, "admin_webhooks", &page); err != nil {
+		log.Println("rendering page admin_webhooks failed.", err.Error())
+		return err
+	}
+	return r.render(statusCode, buf.Bytes(), c)
+}
+
+func (r *Render) AdminQueries(page AdminPage, c echo.Context, statusCode int) error {
+	var buf bytes.Buffer
+	if err := r.t.templates.ExecuteTemplate(&buf, "admin_queries", &page); err != nil {
+		log.Println("rendering page admin_queries failed.", err.Error())
+		return err
+	}
+	return r.render(statusCode, buf.Bytes(), c)
+}
@@ -0,0 +1,46 @@
+package render
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Bookmarks renders a page of the logged in user's bookmarks as a news list.
+func (r *Render) Bookmarks(name string, lang string, page int, c echo.Context) error {
+	var buf bytes.Buffer
+	viewer := middleware.CurrentViewer(c)
+	bookmarks := r.Mongo.Bookmarks(viewer.User.Id, page, 30)
+	rssList := make([]domain.RSS, 0, len(bookmarks))
+	bookmarked := map[primitive.ObjectID]bool{}
+	for _, b := range bookmarks {
+		rssList = append(rssList, b.RSS())
+		bookmarked[b.ItemId] = true
+	}
+	if lang == "en" {
+		rssList = util.AddCategoryEnNames(rssList)
+	}
+	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
+		Page:         page,
+		Lang:         lang,
+		ResultCount:  len(rssList),
+		Total:        r.Mongo.CountBookmarks(viewer.User.Id),
+		PageSize:     30,
+		RSS:          rssList,
+		MostReadList: r.Mongo.MostReadWeekly(lang, 0, 5),
+		Viewer:       viewer,
+		Bookmarked:   bookmarked,
+		Read:         r.readItems(viewer),
+	})
+	if err != nil {
+		log.Println("rendering page", name, "failed.", err.Error())
+		return err
+	}
+	return r.render(http.StatusOK, buf.Bytes(), c)
+}
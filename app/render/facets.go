@@ -0,0 +1,109 @@
+package render
+
+import (
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+// searchRequest reads the order and the facet filters of a search from
+// the url.
+func searchRequest(lang string, searchString string, page int, c echo.Context) service.SearchRequest {
+	req := service.SearchRequest{
+		Query:    searchString,
+		Lang:     lang,
+		Order:    service.SortDate,
+		Page:     page,
+		Count:    30,
+		Category: strings.TrimSpace(c.QueryParam("category")),
+		Source:   strings.TrimSpace(c.QueryParam("source")),
+		Facets:   true,
+	}
+	if c.QueryParam("sort") == service.SortRelevance {
+		req.Order = service.SortRelevance
+	}
+	if day, err := time.ParseInLocation(service.DayFormat, c.QueryParam("day"), time.Local); err == nil {
+		req.Day = day
+	}
+	return req
+}
+
+// refined tells whether a search is narrowed by facets, sorted or viewed
+// as a histogram, the same query searched again from its results.
+func refined(req service.SearchRequest, c echo.Context) bool {
+	return len(facetParams(req)) > 0 || c.QueryParam("sort") != "" || c.QueryParam("histogram") != ""
+}
+
+// facetParams returns the facet filters of a search as url parameters.
+func facetParams(req service.SearchRequest) url.Values {
+	params := url.Values{}
+	if req.Category != "" {
+		params.Set("category", req.Category)
+	}
+	if req.Source != "" {
+		params.Set("source", req.Source)
+	}
+	if !req.Day.IsZero() {
+		params.Set("day", req.Day.Format(service.DayFormat))
+	}
+	return params
+}
+
+// facetQuery returns the facet filters of a search as parameters to add to
+// a url.
+func facetQuery(req service.SearchRequest) template.URL {
+	if params := facetParams(req); len(params) > 0 {
+		return template.URL("&" + params.Encode())
+	}
+	return ""
+}
+
+// searchURL returns the url of the first page of a search.
+func searchURL(req service.SearchRequest) template.URL {
+	params := facetParams(req)
+	params.Set("q", req.Query)
+	if req.Order == service.SortRelevance {
+		params.Set("sort", req.Order)
+	}
+	return template.URL("/" + req.Lang + "/search?" + params.Encode())
+}
+
+// facetLinks links each facet value to the search narrowed to it, or for
+// the selected values, back to the search without the filter. Facets of
+// different fields combine.
+func facetLinks(req service.SearchRequest, f *domain.Facets) {
+	day := ""
+	if !req.Day.IsZero() {
+		day = req.Day.Format(service.DayFormat)
+	}
+	link := func(values []domain.FacetValue, selected string, set func(r *service.SearchRequest, value string)) {
+		for i := range values {
+			r := req
+			if values[i].Selected = strings.EqualFold(values[i].Value, selected); values[i].Selected {
+				set(&r, "")
+			} else {
+				set(&r, values[i].Value)
+			}
+			values[i].URL = searchURL(r)
+		}
+	}
+	link(f.Categories, req.Category, func(r *service.SearchRequest, v string) { r.Category = v })
+	link(f.Sources, req.Source, func(r *service.SearchRequest, v string) { r.Source = v })
+	link(f.Days, day, func(r *service.SearchRequest, v string) {
+		r.Day, _ = time.ParseInLocation(service.DayFormat, v, time.Local)
+	})
+	for i := range f.Days {
+		if d, err := time.ParseInLocation(service.DayFormat, f.Days[i].Value, time.Local); err == nil {
+			if req.Lang == "fi" {
+				f.Days[i].Label = d.Format("2.1.2006")
+			} else {
+				f.Days[i].Label = d.Format("Jan 2, 2006")
+			}
+		}
+	}
+}
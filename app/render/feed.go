@@ -0,0 +1,114 @@
+package render
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/feed"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+// Listing identifies one of the html listings that also have a feed.
+type Listing struct {
+	Lang        string
+	Category    string
+	Source      string
+	SearchQuery string
+}
+
+// Path returns the path of the html listing without a page number.
+func (l Listing) Path() string {
+	switch {
+	case l.Category != "":
+		return "/" + l.Lang + "/category/" + url.PathEscape(strings.ToLower(l.Category))
+	case l.Source != "":
+		return "/" + l.Lang + "/source/" + url.PathEscape(l.Source)
+	case l.SearchQuery != "":
+		return "/" + l.Lang + "/search"
+	}
+	return "/" + l.Lang
+}
+
+// FeedPath returns the feed path of the listing without the format extension.
+func (l Listing) FeedPath() string {
+	return l.Path() + "/feed"
+}
+
+func (l Listing) query() string {
+	if l.SearchQuery != "" {
+		return "?q=" + url.QueryEscape(l.SearchQuery)
+	}
+	return ""
+}
+
+// Title returns the localized name of the listing.
+func (l Listing) Title() string {
+	fi := l.Lang == "fi"
+	switch {
+	case l.Category != "":
+		if !fi {
+			return "Uutispuro - " + util.EnCategoryName(l.Category)
+		}
+		return "Uutispuro - " + l.Category
+	case l.Source != "":
+		return "Uutispuro - " + l.Source
+	case l.SearchQuery != "":
+		if fi {
+			return "Uutispuro - haku " + l.SearchQuery
+		}
+		return "Uutispuro - search " + l.SearchQuery
+	}
+	if fi {
+		return "Uutispuro - Uusimmat uutiset"
+	}
+	return "Uutispuro - Latest news"
+}
+
+func (r *Render) listingItems(l Listing) ([]domain.RSS, error) {
+	switch {
+	case l.Category != "":
+		return r.Mongo.FetchRssItemsByCategory(l.Lang, l.Category, 0, 30), nil
+	case l.Source != "":
+		return r.Mongo.FetchRssItemsBySource(l.Lang, l.Source, 0, 30), nil
+	case l.SearchQuery != "":
+		result, err := r.Mongo.Search(service.SearchRequest{Query: l.SearchQuery, Lang: l.Lang, Order: service.SortDate, Count: 30})
+		return result.Items, err
+	}
+	return r.Mongo.FetchRssItems(l.Lang, 0, 30), nil
+}
+
+// Feed writes the latest items of a listing as rss, atom or json feed.
+func (r *Render) Feed(l Listing, format string, c echo.Context) error {
+	contentType, ok := feed.ContentTypes[format]
+	if !ok {
+		return c.NoContent(http.StatusNotFound)
+	}
+	items, err := r.listingItems(l)
+	if e, ok := err.(*query.Error); ok {
+		return c.String(http.StatusBadRequest, e.Message(l.Lang))
+	}
+	if err != nil {
+		log.Println("finding", l.FeedPath(), "feed items failed", err.Error())
+		return err
+	}
+	f := &feed.Feed{
+		Title:       l.Title(),
+		Description: l.Title(),
+		Link:        util.SiteURL + l.Path() + l.query(),
+		FeedURL:     util.SiteURL + l.FeedPath() + "." + format + l.query(),
+		Language:    l.Lang,
+		Items:       items,
+	}
+	data, err := f.Write(format)
+	if err != nil {
+		log.Println("writing", format, "feed failed", err.Error())
+		return err
+	}
+	return c.Blob(http.StatusOK, contentType, data)
+}
@@ -0,0 +1,130 @@
+package render
+
+import (
+	"html/template"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+// size of the chart and the room left for the labels
+const (
+	chartWidth  = 600
+	chartHeight = 180
+	chartLeft   = 30
+	chartRight  = 10
+	chartTop    = 10
+	chartBottom = 20
+	// chartSources is how many of the most common sources are drawn.
+	chartSources = 5
+	chartLabels  = 6
+)
+
+var chartColors = []string{"#1f77b4", "#ff7f0e", "#2ca02c", "#d62728", "#9467bd"}
+
+// HistogramRequest reads the interval and the range of a histogram from
+// the url, the range as days in local time with to included.
+func HistogramRequest(lang string, searchString string, interval string, c echo.Context) service.HistogramRequest {
+	req := service.HistogramRequest{Query: searchString, Lang: lang, Interval: interval}
+	if from, err := time.ParseInLocation(service.DayFormat, c.QueryParam("from"), time.Local); err == nil {
+		req.From = from
+	}
+	if to, err := time.ParseInLocation(service.DayFormat, c.QueryParam("to"), time.Local); err == nil {
+		req.To = to.AddDate(0, 0, 1)
+	}
+	return req
+}
+
+// histogramParams returns the interval and the range of a histogram as
+// parameters to add to a url.
+func histogramParams(req service.HistogramRequest, c echo.Context) template.URL {
+	params := url.Values{}
+	params.Set("interval", req.Interval)
+	for _, name := range []string{"from", "to"} {
+		if _, err := time.Parse(service.DayFormat, c.QueryParam(name)); err == nil {
+			params.Set(name, c.QueryParam(name))
+		}
+	}
+	return template.URL("&" + params.Encode())
+}
+
+// searchHistogram returns the histogram of a search and its chart, nil
+// unless the histogram=day or histogram=hour parameter asks for them. A
+// range too long for the interval falls back to the default range.
+func (r *Render) searchHistogram(lang string, searchString string, c echo.Context) (*domain.Histogram, *domain.Chart) {
+	interval := c.QueryParam("histogram")
+	if searchString == "" || (interval != service.IntervalDay && interval != service.IntervalHour) {
+		return nil, nil
+	}
+	req := HistogramRequest(lang, searchString, interval, c)
+	h, err := r.Mongo.Histogram(req)
+	if err == service.ErrHistogramRange {
+		req.From = time.Time{}
+		h, err = r.Mongo.Histogram(req)
+	}
+	if err != nil {
+		if _, ok := err.(*query.Error); !ok {
+			log.Println("counting histogram failed", err)
+		}
+		return nil, nil
+	}
+	chart := histogramChart(h, lang)
+	chart.Params = histogramParams(req.WithDefaults(time.Now()), c)
+	return &h, chart
+}
+
+// histogramChart draws the most common sources of h as lines.
+func histogramChart(h domain.Histogram, lang string) *domain.Chart {
+	chart := &domain.Chart{Width: chartWidth, Height: chartHeight, Max: 1}
+	sources := h.Sources[:min(chartSources, len(h.Sources))]
+	for _, s := range sources {
+		for _, n := range s.Counts {
+			chart.Max = max(chart.Max, n)
+		}
+	}
+	x := func(i int) int {
+		if len(h.Buckets) < 2 {
+			return chartLeft + (chartWidth-chartLeft-chartRight)/2
+		}
+		return chartLeft + i*(chartWidth-chartLeft-chartRight)/(len(h.Buckets)-1)
+	}
+	y := func(n int) int {
+		return chartHeight - chartBottom - n*(chartHeight-chartBottom-chartTop)/chart.Max
+	}
+	for i, s := range sources {
+		points := make([]string, len(s.Counts))
+		for j, n := range s.Counts {
+			points[j] = strconv.Itoa(x(j)) + "," + strconv.Itoa(y(n))
+		}
+		chart.Lines = append(chart.Lines, domain.ChartLine{
+			Source: s.Source,
+			Color:  chartColors[i%len(chartColors)],
+			Points: strings.Join(points, " "),
+			Total:  s.Total,
+		})
+	}
+	step := max(1, (len(h.Buckets)+chartLabels-1)/chartLabels)
+	for i := 0; i < len(h.Buckets); i += step {
+		chart.XLabels = append(chart.XLabels, domain.ChartLabel{X: x(i), Text: bucketLabel(h.Buckets[i], h.Interval, lang)})
+	}
+	return chart
+}
+
+func bucketLabel(t time.Time, interval string, lang string) string {
+	switch {
+	case lang == "fi" && interval == service.IntervalHour:
+		return t.Format("2.1. 15:04")
+	case lang == "fi":
+		return t.Format("2.1.")
+	case interval == service.IntervalHour:
+		return t.Format("Jan 2 15:04")
+	}
+	return t.Format("Jan 2")
+}
@@ -0,0 +1,50 @@
+package render
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// relatedCount is how many related items the item page shows.
+const relatedCount = 10
+
+// Item renders the page of an item with the news related to it.
+func (r *Render) Item(name string, lang string, id primitive.ObjectID, c echo.Context) error {
+	var buf bytes.Buffer
+	found := r.Mongo.ItemsByIds([]primitive.ObjectID{id})
+	if len(found) == 0 {
+		return c.NoContent(http.StatusNotFound)
+	}
+	item := found[0]
+	relatedList := []domain.RSS{}
+	if r.Related != nil {
+		relatedList = r.Mongo.ItemsByIds(r.Related.Related(item, relatedCount))
+	}
+	if lang == "en" {
+		item = util.AddCategoryEnNames([]domain.RSS{item})[0]
+		relatedList = util.AddCategoryEnNames(relatedList)
+	}
+	viewer := middleware.CurrentViewer(c)
+	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
+		Lang:         lang,
+		Item:         &item,
+		RSS:          relatedList,
+		ResultCount:  len(relatedList),
+		MostReadList: r.Mongo.MostReadWeekly(lang, 0, 5),
+		Viewer:       viewer,
+		Bookmarked:   r.bookmarked(viewer, append([]domain.RSS{item}, relatedList...)),
+		Read:         r.readItems(viewer),
+	})
+	if err != nil {
+		log.Println("rendering page", name, "failed.", err.Error())
+		return err
+	}
+	return r.render(http.StatusOK, buf.Bytes(), c)
+}
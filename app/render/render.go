@@ -7,19 +7,31 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/related"
 	"github.com/jelinden/newsfeedreader/app/service"
 	"github.com/jelinden/newsfeedreader/app/util"
 	"github.com/labstack/echo/v4"
 	"github.com/rsniezynski/go-asset-helper"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type (
 	Render struct {
-		Mongo  *service.Mongo
-		t      *Template
-		static *asset.Static
+		Mongo *service.Mongo
+		// Searcher answers the searches of the search page, Mongo unless
+		// configured otherwise.
+		Searcher service.Searcher
+		// Related finds the news related to an item, none when nil.
+		Related *related.Index
+		// LoginProviders are offered on the login page.
+		LoginProviders []domain.LoginProvider
+		t              *Template
+		static         *asset.Static
 	}
 	Template struct {
 		templates *template.Template
@@ -29,6 +41,7 @@ type (
 func NewRender(mongo *service.Mongo) *Render {
 	render := &Render{}
 	render.Mongo = mongo
+	render.Searcher = mongo
 	newStatic, _ := asset.NewStatic("", "./manifest.json")
 	render.static = newStatic
 	render.t = &Template{
@@ -40,31 +53,103 @@ func NewRender(mongo *service.Mongo) *Render {
 				return a + b
 			},
 			"toLower": strings.ToLower,
+			"dict":    dict,
+			"number":  number,
 		}).ParseGlob("public/html/*")),
 	}
 	return render
 }
 
+// dict builds a map from key value pairs, to pass several values to a
+// template.
+func dict(pairs ...interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if key, ok := pairs[i].(string); ok {
+			result[key] = pairs[i+1]
+		}
+	}
+	return result
+}
+
+// number writes n with the thousands separated the way of lang.
+func number(lang string, n int) string {
+	separator := ","
+	if lang == "fi" {
+		separator = "\u00a0"
+	}
+	digits := strconv.Itoa(n)
+	if n < 0 {
+		return "-" + number(lang, -n)
+	}
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + separator + digits[i:]
+	}
+	return digits
+}
+
+// readItems returns the items the logged in viewer has opened.
+func (r *Render) readItems(viewer domain.Viewer) map[primitive.ObjectID]bool {
+	if viewer.User == nil {
+		return nil
+	}
+	return r.Mongo.ReadItems(viewer.User.Id)
+}
+
+// hiddenItems returns the read items to leave out of the listings when the
+// viewer hides read items.
+func hiddenItems(viewer domain.Viewer, read map[primitive.ObjectID]bool) []primitive.ObjectID {
+	if !viewer.Preferences.HideRead {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, 0, len(read))
+	for id := range read {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// bookmarked tells which of the items the logged in viewer has bookmarked.
+func (r *Render) bookmarked(viewer domain.Viewer, items []domain.RSS) map[primitive.ObjectID]bool {
+	if viewer.User == nil {
+		return nil
+	}
+	return r.Mongo.Bookmarked(viewer.User.Id, items)
+}
+
 func (r *Render) Index(name string, lang string, page int, c echo.Context, statusCode int) error {
-	return r.render(http.StatusOK, r.RenderIndex(name, lang, strconv.Itoa(page)), c)
+	buf := r.getIndexTemplate(name, lang, page, middleware.CurrentViewer(c))
+	return r.render(http.StatusOK, buf.Bytes(), c)
 }
 
 func (r *Render) RenderIndex(params ...string) []byte {
 	p, _ := strconv.Atoi(params[2])
-	buf := r.getIndexTemplate(params[0], params[1], p)
+	buf := r.getIndexTemplate(params[0], params[1], p, domain.Viewer{})
 	return buf.Bytes()
 }
 
-func (r *Render) getIndexTemplate(name string, lang string, page int) bytes.Buffer {
+func (r *Render) getIndexTemplate(name string, lang string, page int, viewer domain.Viewer) bytes.Buffer {
 	var buf bytes.Buffer
-	rssList := r.Mongo.FetchRssItems(lang, page, 30)
+	read := r.readItems(viewer)
+	var rssList []domain.RSS
+	if viewer.Preferences.Empty() {
+		rssList = r.Mongo.FetchRssItems(lang, page, 30, hiddenItems(viewer, read)...)
+	} else {
+		rssList = r.Mongo.FetchPersonalRssItems(lang, viewer.Preferences, page, 30, hiddenItems(viewer, read)...)
+	}
 	mostReadList := r.Mongo.MostReadWeekly(lang, 0, 5)
+	listing := Listing{Lang: lang}
 	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
 		Page:         page,
 		Lang:         lang,
 		ResultCount:  len(rssList),
 		RSS:          rssList,
 		MostReadList: mostReadList,
+		FeedPath:     listing.FeedPath(),
+		FeedTitle:    listing.Title(),
+		Viewer:       viewer,
+		Bookmarked:   r.bookmarked(viewer, rssList),
+		Read:         read,
 	})
 	if err != nil {
 		log.Println("rendering page", name, "failed.", err.Error())
@@ -72,21 +157,26 @@ func (r *Render) getIndexTemplate(name string, lang string, page int) bytes.Buff
 	return buf
 }
 
-func (r *Render) Login(name string, lang string, c echo.Context, statusCode int) error {
-	buf := r.RenderLogin(name, lang)
-	return r.render(http.StatusOK, buf.Bytes(), c)
+// Login renders the login and signup forms. A non nil form is shown with
+// the submitted values and its validation errors.
+func (r *Render) Login(name string, lang string, form *domain.LoginForm, c echo.Context, statusCode int) error {
+	buf := r.getLoginTemplate(name, lang, form, middleware.CurrentViewer(c))
+	return r.render(statusCode, buf.Bytes(), c)
 }
 
 func (r *Render) RenderLogin(name string, lang string) bytes.Buffer {
-	return r.getLoginTemplate(name, lang)
+	return r.getLoginTemplate(name, lang, nil, domain.Viewer{})
 }
 
-func (r *Render) getLoginTemplate(name string, lang string) bytes.Buffer {
+func (r *Render) getLoginTemplate(name string, lang string, form *domain.LoginForm, viewer domain.Viewer) bytes.Buffer {
 	var buf bytes.Buffer
 	mostReadList := r.Mongo.MostReadWeekly(lang, 0, 5)
 	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
-		Lang:         lang,
-		MostReadList: mostReadList,
+		Lang:           lang,
+		MostReadList:   mostReadList,
+		Viewer:         viewer,
+		LoginForm:      form,
+		LoginProviders: r.LoginProviders,
 	})
 	if err != nil {
 		log.Println("rendering page", name, "failed.", err.Error())
@@ -96,48 +186,115 @@ func (r *Render) getLoginTemplate(name string, lang string) bytes.Buffer {
 
 func (r *Render) RenderSearch(name string, lang string, searchString string, page int, c echo.Context, statusCode int) error {
 	var buf bytes.Buffer
-	rssList := r.Mongo.Search(searchString, lang, page, 30)
+	viewer := middleware.CurrentViewer(c)
+	var saved *domain.SavedSearch
+	if viewer.User != nil && c.QueryParam("saved") != "" {
+		// opening a saved search shows its query and marks its matches read
+		if saved = r.Mongo.FindSavedSearch(viewer.User.Id, c.QueryParam("saved")); saved != nil {
+			searchString = saved.Query
+			r.Mongo.MarkSavedSearchRead(viewer.User.Id, saved.Id.Hex())
+		}
+	}
+	read := r.readItems(viewer)
+	req := searchRequest(lang, searchString, page, c)
+	req.Exclude = hiddenItems(viewer, read)
+	started := time.Now()
+	result, err := r.Searcher.Search(req)
+	latency := time.Since(started)
+	rssList := result.Items
+	var facets *domain.Facets
+	if err == nil && searchString != "" {
+		facets = &result.Facets
+		facetLinks(req, facets)
+	}
+	queryError := ""
+	if e, ok := err.(*query.Error); ok {
+		queryError = e.Message(lang)
+		statusCode = http.StatusBadRequest
+	}
+	var histogram *domain.Histogram
+	var chart *domain.Chart
+	if err == nil {
+		histogram, chart = r.searchHistogram(lang, searchString, c)
+	}
+	if err == nil && page == 0 && saved == nil && searchString != "" && !refined(req, c) {
+		go r.Mongo.LogQuery(domain.QueryLog{
+			Query:     searchString,
+			Lang:      lang,
+			Results:   result.Total,
+			LatencyMs: latency.Milliseconds(),
+			Time:      started,
+		})
+	}
 	mostReadList := r.Mongo.MostReadWeekly(lang, 0, 5)
-	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
+	listing := Listing{Lang: lang, SearchQuery: searchString}
+	err = r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
 		Page:         page,
 		Lang:         lang,
 		ResultCount:  len(rssList),
+		Total:        result.Total,
+		Estimated:    result.Estimated,
+		PageSize:     req.Count,
 		SearchQuery:  searchString,
 		RSS:          rssList,
 		MostReadList: mostReadList,
+		FeedPath:     listing.FeedPath(),
+		FeedTitle:    listing.Title(),
+		Viewer:       viewer,
+		SavedSearch:  saved,
+		Bookmarked:   r.bookmarked(viewer, rssList),
+		Read:         read,
+		FormError:    queryError,
+		Sort:         req.Order,
+		Facets:       facets,
+		FacetParams:  facetQuery(req),
+		Histogram:    histogram,
+		Chart:        chart,
 	})
 	if err != nil {
 		log.Println("rendering page", name, "failed.", err.Error())
 		return err
 	}
-	return r.render(http.StatusOK, buf.Bytes(), c)
+	return r.render(statusCode, buf.Bytes(), c)
 }
 
 func (r *Render) ByCategory(name string, lang string, category string, page int, c echo.Context, statusCode int) error {
-	return r.render(http.StatusOK, r.RenderByCategory(name, lang, category, strconv.Itoa(page)), c)
+	return r.render(http.StatusOK, r.getCategoryTemplate(name, lang, category, page, middleware.CurrentViewer(c)).Bytes(), c)
 }
 
 func (r *Render) RenderByCategory(params ...string) []byte {
 	p, _ := strconv.Atoi(params[3])
-	return r.getCategoryTemplate(params[0], params[1], params[2], p).Bytes()
+	return r.getCategoryTemplate(params[0], params[1], params[2], p, domain.Viewer{}).Bytes()
 }
 
-func (r *Render) getCategoryTemplate(name string, lang string, category string, page int) *bytes.Buffer {
+func (r *Render) getCategoryTemplate(name string, lang string, category string, page int, viewer domain.Viewer) *bytes.Buffer {
 	var buf bytes.Buffer
-	rssList := r.Mongo.FetchRssItemsByCategory(lang, category, page, 30)
+	read := r.readItems(viewer)
+	hidden := hiddenItems(viewer, read)
+	rssList := r.Mongo.FetchRssItemsByCategory(lang, category, page, 30, hidden...)
+	total, estimated := r.Mongo.CountRssItemsByCategory(lang, category, hidden...)
 	mostReadList := r.Mongo.MostReadWeekly(lang, 0, 5)
 	var catEn string
 	if lang == "en" {
 		catEn = util.EnCategoryName(category)
 	}
+	listing := Listing{Lang: lang, Category: category}
 	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
 		Page:           page,
 		Lang:           lang,
 		ResultCount:    len(rssList),
+		Total:          total,
+		Estimated:      estimated,
+		PageSize:       30,
 		Category:       category,
 		CategoryEnName: catEn,
 		RSS:            rssList,
 		MostReadList:   mostReadList,
+		FeedPath:       listing.FeedPath(),
+		FeedTitle:      listing.Title(),
+		Viewer:         viewer,
+		Bookmarked:     r.bookmarked(viewer, rssList),
+		Read:           read,
 	})
 	if err != nil {
 		log.Println("rendering page", name, "failed.", err.Error())
@@ -146,26 +303,38 @@ func (r *Render) getCategoryTemplate(name string, lang string, category string,
 }
 
 func (r *Render) BySource(name string, lang string, source string, page int, c echo.Context, statusCode int) error {
-	return r.render(http.StatusOK, r.RenderBySource(name, lang, source, strconv.Itoa(page)), c)
+	return r.render(http.StatusOK, r.getSourceTemplate(name, lang, source, page, middleware.CurrentViewer(c)).Bytes(), c)
 
 }
 
 func (r *Render) RenderBySource(params ...string) []byte {
 	p, _ := strconv.Atoi(params[3])
-	return r.getSourceTemplate(params[0], params[1], params[2], p).Bytes()
+	return r.getSourceTemplate(params[0], params[1], params[2], p, domain.Viewer{}).Bytes()
 }
 
-func (r *Render) getSourceTemplate(name string, lang string, source string, page int) *bytes.Buffer {
+func (r *Render) getSourceTemplate(name string, lang string, source string, page int, viewer domain.Viewer) *bytes.Buffer {
 	var buf bytes.Buffer
-	rssList := r.Mongo.FetchRssItemsBySource(lang, source, page, 30)
+	read := r.readItems(viewer)
+	hidden := hiddenItems(viewer, read)
+	rssList := r.Mongo.FetchRssItemsBySource(lang, source, page, 30, hidden...)
+	total, estimated := r.Mongo.CountRssItemsBySource(lang, source, hidden...)
 	mostReadList := r.Mongo.MostReadWeekly(lang, 0, 5)
+	listing := Listing{Lang: lang, Source: source}
 	err := r.t.templates.ExecuteTemplate(&buf, name, &domain.News{
 		Page:         page,
 		Lang:         lang,
 		ResultCount:  len(rssList),
+		Total:        total,
+		Estimated:    estimated,
+		PageSize:     30,
 		Source:       source,
 		RSS:          rssList,
 		MostReadList: mostReadList,
+		FeedPath:     listing.FeedPath(),
+		FeedTitle:    listing.Title(),
+		Viewer:       viewer,
+		Bookmarked:   r.bookmarked(viewer, rssList),
+		Read:         read,
 	})
 	if err != nil {
 		log.Println("rendering page", name, "failed.", err.Error())
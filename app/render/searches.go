@@ -0,0 +1,29 @@
+package render
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/labstack/echo/v4"
+)
+
+// Searches renders the saved searches and alert settings of the logged in
+// user with an optional error of the submitted form.
+func (r *Render) Searches(lang string, formError string, c echo.Context, statusCode int) error {
+	var buf bytes.Buffer
+	viewer := middleware.CurrentViewer(c)
+	err := r.t.templates.ExecuteTemplate(&buf, "searches", &domain.News{
+		Lang:          lang,
+		MostReadList:  r.Mongo.MostReadWeekly(lang, 0, 5),
+		Viewer:        viewer,
+		SavedSearches: r.Mongo.SavedSearches(viewer.User.Id),
+		FormError:     formError,
+	})
+	if err != nil {
+		log.Println("rendering page searches failed.", err.Error())
+		return err
+	}
+	return r.render(statusCode, buf.Bytes(), c)
+}
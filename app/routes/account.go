@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+func Account(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if middleware.CurrentUser(c) == nil {
+			return c.Redirect(http.StatusFound, "/"+lang+"/login")
+		}
+		return r.Login("account", lang, &domain.LoginForm{Form: "account"}, c, http.StatusOK)
+	}
+}
+
+// ExportAccount downloads everything stored about the user as JSON.
+func ExportAccount(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		export, err := mgo.ExportAccount(user.Id)
+		if err != nil {
+			log.Println("exporting account failed", user.Id.Hex(), err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		body, err := json.MarshalIndent(export, "", "  ")
+		if err != nil {
+			return err
+		}
+		c.Response().Header().Set("Cache-Control", "no-store")
+		c.Response().Header().Set(echo.HeaderContentDisposition,
+			`attachment; filename="uutispuro-account-`+export.Exported.Format("2006-01-02")+`.json"`)
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, body)
+	}
+}
+
+// DeleteAccount deletes the user and all data of the user after the user
+// confirms it with the password, or with the email address when the
+// account has no password.
+func DeleteAccount(r *render.Render, mgo *service.Mongo, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		form := &domain.LoginForm{Form: "account", Errors: map[string]string{}}
+		confirmed := false
+		if user.PasswordHash != "" {
+			confirmed = mgo.Authenticate(user.Email, c.FormValue("password")) != nil
+		} else {
+			confirmed = strings.EqualFold(strings.TrimSpace(c.FormValue("email")), user.Email)
+		}
+		if !confirmed {
+			form.Errors["confirm"] = accountErrors[lang]["confirm"]
+			return r.Login("account", lang, form, c, http.StatusForbidden)
+		}
+		if err := mgo.DeleteAccount(user.Id); err != nil {
+			log.Println("deleting account failed", user.Id.Hex(), err)
+			form.Errors["failed"] = accountErrors[lang]["failed"]
+			return r.Login("account", lang, form, c, http.StatusInternalServerError)
+		}
+		cookies.DeleteCookie(middleware.SessionCookie, c)
+		cookies.DeleteCookie(middleware.PreferencesCookie, c)
+		c.Set(middleware.UserContextKey, nil)
+		c.Set(middleware.PreferencesContextKey, nil)
+		form = &domain.LoginForm{Form: "message", Notice: accountNotices[lang]["deleted"]}
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
@@ -0,0 +1,299 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/mail"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	minPasswordLength = 8
+	verifyTokenTTL    = 48 * time.Hour
+	resetTokenTTL     = time.Hour
+)
+
+var accountNotices = map[string]map[string]string{
+	"fi": {
+		"verified":     "Sähköpostiosoite on vahvistettu",
+		"sent":         "Vahvistuslinkki on lähetetty sähköpostiisi",
+		"forgot":       "Jos osoite on rekisteröity, lähetimme siihen linkin salasanan vaihtoon",
+		"reset":        "Salasana on vaihdettu, voit nyt kirjautua",
+		"unsubscribed": "Et saa enää koostetta sähköpostiisi",
+		"deleted":      "Tilisi ja kaikki sen tiedot on poistettu",
+	},
+	"en": {
+		"verified":     "Your email address has been confirmed",
+		"sent":         "A confirmation link has been sent to your email",
+		"forgot":       "If the address is registered, we sent it a link to reset the password",
+		"reset":        "Your password has been changed, you can now log in",
+		"unsubscribed": "You will not get the digest anymore",
+		"deleted":      "Your account and all of its data have been deleted",
+	},
+}
+
+var accountErrors = map[string]map[string]string{
+	"fi": {
+		"name":        "Nimi puuttuu",
+		"email":       "Sähköpostiosoite ei kelpaa",
+		"password":    "Salasanan pitää olla vähintään 8 merkkiä",
+		"long":        "Salasana on liian pitkä",
+		"taken":       "Sähköpostiosoite on jo rekisteröity",
+		"credentials": "Väärä sähköpostiosoite tai salasana",
+		"failed":      "Jotain meni vikaan, yritä uudelleen",
+		"token":       "Linkki on vanhentunut tai jo käytetty",
+		"confirm":     "Vahvistus ei täsmää, tiliä ei poistettu",
+		"provider":    "Kirjautuminen palvelun kautta epäonnistui, yritä uudelleen",
+		"unverified":  "Palvelu ei ole vahvistanut sähköpostiosoitettasi",
+	},
+	"en": {
+		"name":        "Name is missing",
+		"email":       "Email address is not valid",
+		"password":    "Password must be at least 8 characters",
+		"long":        "Password is too long",
+		"taken":       "Email address is already registered",
+		"credentials": "Wrong email or password",
+		"failed":      "Something went wrong, please try again",
+		"token":       "The link has expired or has already been used",
+		"confirm":     "The confirmation does not match, the account was not deleted",
+		"provider":    "Logging in through the service failed, please try again",
+		"unverified":  "The service has not verified your email address",
+	},
+}
+
+func formLang(c echo.Context) string {
+	if c.FormValue("lang") == "en" {
+		return "en"
+	}
+	return "fi"
+}
+
+func Login(render *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if middleware.CurrentUser(c) != nil {
+			return c.Redirect(http.StatusFound, "/"+lang)
+		}
+		return render.Login("login", lang, nil, c, http.StatusOK)
+	}
+}
+
+func PostLogin(r *render.Render, mgo *service.Mongo, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		form := &domain.LoginForm{Form: "login", Email: strings.TrimSpace(c.FormValue("email")), Errors: map[string]string{}}
+		user := mgo.Authenticate(form.Email, c.FormValue("password"))
+		if user == nil {
+			form.Errors["login"] = accountErrors[lang]["credentials"]
+			return r.Login("login", lang, form, c, http.StatusUnauthorized)
+		}
+		return startSession(r, mgo, cookies, user, lang, form, c)
+	}
+}
+
+func Signup(r *render.Render, mgo *service.Mongo, cookies *util.CookieUtil, sender *mail.Sender) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		form := &domain.LoginForm{
+			Form:   "signup",
+			Name:   strings.TrimSpace(c.FormValue("name")),
+			Email:  strings.TrimSpace(c.FormValue("email")),
+			Errors: map[string]string{},
+		}
+		password := c.FormValue("password")
+		if form.Name == "" {
+			form.Errors["name"] = accountErrors[lang]["name"]
+		}
+		if address, err := netmail.ParseAddress(form.Email); err != nil || address.Address != form.Email {
+			form.Errors["email"] = accountErrors[lang]["email"]
+		}
+		if len([]rune(password)) < minPasswordLength {
+			form.Errors["password"] = accountErrors[lang]["password"]
+		} else if len(password) > service.MaxPasswordLength {
+			form.Errors["password"] = accountErrors[lang]["long"]
+		}
+		if len(form.Errors) > 0 {
+			return r.Login("login", lang, form, c, http.StatusBadRequest)
+		}
+		user, err := mgo.CreateUser(form.Name, form.Email, password, lang)
+		if err == service.ErrEmailTaken {
+			form.Errors["email"] = accountErrors[lang]["taken"]
+			return r.Login("login", lang, form, c, http.StatusConflict)
+		}
+		if err == service.ErrPasswordTooLong {
+			form.Errors["password"] = accountErrors[lang]["long"]
+			return r.Login("login", lang, form, c, http.StatusBadRequest)
+		}
+		if err != nil {
+			log.Println("creating user failed", err)
+			form.Errors["signup"] = accountErrors[lang]["failed"]
+			return r.Login("login", lang, form, c, http.StatusInternalServerError)
+		}
+		go sendVerification(mgo, sender, user, lang)
+		return startSession(r, mgo, cookies, user, lang, form, c)
+	}
+}
+
+func startSession(r *render.Render, mgo *service.Mongo, cookies *util.CookieUtil, user *domain.User, lang string, form *domain.LoginForm, c echo.Context) error {
+	token, err := mgo.CreateSession(user.Id)
+	if err != nil {
+		log.Println("creating session failed", err)
+		form.Errors[form.Form] = accountErrors[lang]["failed"]
+		return r.Login("login", lang, form, c, http.StatusInternalServerError)
+	}
+	cookies.SetSignedCookie(middleware.SessionCookie, token, service.SessionTTL, c)
+	return c.Redirect(http.StatusSeeOther, "/"+lang)
+}
+
+func Logout(mgo *service.Mongo, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if token, ok := cookies.SignedCookie(middleware.SessionCookie, c); ok {
+			mgo.DeleteSession(token)
+		}
+		cookies.DeleteCookie(middleware.SessionCookie, c)
+		return c.Redirect(http.StatusSeeOther, "/"+formLang(c))
+	}
+}
+
+// accountMail is the template data of the account emails.
+type accountMail struct {
+	Name string
+	Link string
+}
+
+func sendVerification(mgo *service.Mongo, sender *mail.Sender, user *domain.User, lang string) error {
+	token, err := mgo.CreateUserToken(user.Id, service.TokenVerifyEmail, verifyTokenTTL)
+	if err == nil {
+		link := util.SiteURL + "/" + lang + "/verify?token=" + token
+		err = sender.Send(user.Email, "verify", lang, accountMail{Name: user.Name, Link: link})
+	}
+	if err != nil {
+		log.Println("sending verification email failed", err)
+	}
+	return err
+}
+
+func VerifyEmail(r *render.Render, mgo *service.Mongo, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		form := &domain.LoginForm{Form: "message", Errors: map[string]string{}}
+		userId, err := mgo.ConsumeUserToken(c.QueryParam("token"), service.TokenVerifyEmail)
+		if err == nil {
+			err = mgo.VerifyEmail(userId)
+		}
+		if err != nil {
+			if err != service.ErrInvalidToken {
+				log.Println("verifying email failed", err)
+			}
+			form.Errors["token"] = accountErrors[lang]["token"]
+			return r.Login("password", lang, form, c, http.StatusBadRequest)
+		}
+		form.Notice = accountNotices[lang]["verified"]
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
+
+// ResendVerification sends a new confirmation link to the logged in user.
+func ResendVerification(r *render.Render, mgo *service.Mongo, sender *mail.Sender) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		form := &domain.LoginForm{Form: "message", Errors: map[string]string{}}
+		if user.EmailVerified {
+			form.Notice = accountNotices[lang]["verified"]
+			return r.Login("password", lang, form, c, http.StatusOK)
+		}
+		if err := sendVerification(mgo, sender, user, lang); err != nil {
+			form.Errors["token"] = accountErrors[lang]["failed"]
+			return r.Login("password", lang, form, c, http.StatusInternalServerError)
+		}
+		form.Notice = accountNotices[lang]["sent"]
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
+
+func ForgotPassword(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return r.Login("password", lang, &domain.LoginForm{Form: "forgot"}, c, http.StatusOK)
+	}
+}
+
+// PostForgotPassword mails a reset link if the address is registered. The
+// response is the same either way, so it does not reveal who has an account.
+func PostForgotPassword(r *render.Render, mgo *service.Mongo, sender *mail.Sender) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		form := &domain.LoginForm{Form: "forgot", Email: strings.TrimSpace(c.FormValue("email")), Errors: map[string]string{}}
+		if _, err := netmail.ParseAddress(form.Email); err != nil {
+			form.Errors["email"] = accountErrors[lang]["email"]
+			return r.Login("password", lang, form, c, http.StatusBadRequest)
+		}
+		if user := mgo.FindUserByEmail(form.Email); user != nil {
+			go func() {
+				token, err := mgo.CreateUserToken(user.Id, service.TokenResetPassword, resetTokenTTL)
+				if err == nil {
+					link := util.SiteURL + "/" + lang + "/reset?token=" + token
+					err = sender.Send(user.Email, "reset", lang, accountMail{Name: user.Name, Link: link})
+				}
+				if err != nil {
+					log.Println("sending password reset email failed", err)
+				}
+			}()
+		}
+		form.Form = "message"
+		form.Notice = accountNotices[lang]["forgot"]
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
+
+func ResetPassword(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		form := &domain.LoginForm{Form: "reset", Token: c.QueryParam("token")}
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
+
+func PostResetPassword(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		form := &domain.LoginForm{Form: "reset", Token: c.FormValue("token"), Errors: map[string]string{}}
+		password := c.FormValue("password")
+		if len([]rune(password)) < minPasswordLength {
+			form.Errors["password"] = accountErrors[lang]["password"]
+		} else if len(password) > service.MaxPasswordLength {
+			form.Errors["password"] = accountErrors[lang]["long"]
+		}
+		if len(form.Errors) > 0 {
+			return r.Login("password", lang, form, c, http.StatusBadRequest)
+		}
+		userId, err := mgo.ConsumeUserToken(form.Token, service.TokenResetPassword)
+		if err == nil {
+			err = mgo.SetPassword(userId, password)
+		}
+		if err == nil {
+			// the reset link proves the address works as well
+			err = mgo.VerifyEmail(userId)
+		}
+		if err != nil {
+			if err != service.ErrInvalidToken {
+				log.Println("resetting password failed", err)
+			}
+			form.Form = "message"
+			form.Errors["token"] = accountErrors[lang]["token"]
+			return r.Login("password", lang, form, c, http.StatusBadRequest)
+		}
+		form.Form = "message"
+		form.Notice = accountNotices[lang]["reset"]
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
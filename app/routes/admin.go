@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/alerts"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/webhooks"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func csrfToken(c echo.Context) string {
+	token, _ := c.Get("csrf").(string)
+	return token
+}
+
+func AdminAPIKeys(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return r.AdminAPIKeys(render.AdminPage{
+			APIKeys: mgo.ListAPIKeys(),
+			CSRF:    csrfToken(c),
+		}, c, http.StatusOK)
+	}
+}
+
+func CreateAPIKey(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		page := render.AdminPage{CSRF: csrfToken(c)}
+		name := strings.TrimSpace(c.FormValue("name"))
+		rate, rateErr := strconv.Atoi(c.FormValue("ratePerMinute"))
+		burst, burstErr := strconv.Atoi(c.FormValue("burst"))
+		if name == "" || rateErr != nil || burstErr != nil || rate < 1 || burst < 1 {
+			page.Error = "Name, a positive rate per minute and burst are required"
+			page.APIKeys = mgo.ListAPIKeys()
+			return r.AdminAPIKeys(page, c, http.StatusBadRequest)
+		}
+		key, _, err := mgo.CreateAPIKey(name, strings.TrimSpace(c.FormValue("contact")), rate, burst)
+		if err != nil {
+			log.Println("creating api key failed", err)
+			page.Error = "Creating the key failed"
+		}
+		page.NewKey = key
+		page.APIKeys = mgo.ListAPIKeys()
+		return r.AdminAPIKeys(page, c, http.StatusOK)
+	}
+}
+
+func RevokeAPIKey(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := mgo.RevokeAPIKey(c.Param("id")); err != nil {
+			log.Println("revoking api key failed", c.Param("id"), err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/admin/apikeys")
+	}
+}
+
+// deliveryLogSize is the number of deliveries shown on the webhook page.
+const deliveryLogSize = 50
+
+func webhookPage(mgo *service.Mongo, c echo.Context) render.AdminPage {
+	page := render.AdminPage{
+		Webhooks:     mgo.ListWebhooks(),
+		WebhookNames: map[primitive.ObjectID]string{},
+		Deliveries:   mgo.WebhookDeliveries("", deliveryLogSize),
+		DeadLetters:  mgo.WebhookDeliveries(domain.DeliveryDead, deliveryLogSize),
+		CSRF:         csrfToken(c),
+	}
+	for _, hook := range page.Webhooks {
+		page.WebhookNames[hook.Id] = hook.Name
+	}
+	return page
+}
+
+func AdminWebhooks(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return r.AdminWebhooks(webhookPage(mgo, c), c, http.StatusOK)
+	}
+}
+
+func CreateWebhook(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hook := domain.Webhook{
+			Name:     strings.TrimSpace(c.FormValue("name")),
+			URL:      strings.TrimSpace(c.FormValue("url")),
+			Lang:     c.FormValue("lang"),
+			Category: validateAndCorrectifySearchTerm(strings.TrimSpace(c.FormValue("category"))),
+			Query:    strings.TrimSpace(c.FormValue("query")),
+		}
+		if hook.Name == "" || hook.URL == "" || (hook.Lang != "fi" && hook.Lang != "en") {
+			page := webhookPage(mgo, c)
+			page.Error = "Name, url and language are required"
+			return r.AdminWebhooks(page, c, http.StatusBadRequest)
+		}
+		if err := alerts.ValidateWebhookURL(hook.URL); err != nil {
+			page := webhookPage(mgo, c)
+			page.Error = searchErrors["en"][webhookError(err)]
+			return r.AdminWebhooks(page, c, http.StatusBadRequest)
+		}
+		if _, err := query.Parse(hook.Query); err != nil {
+			page := webhookPage(mgo, c)
+			page.Error = "Query: " + err.Error()
+			return r.AdminWebhooks(page, c, http.StatusBadRequest)
+		}
+		if _, err := mgo.CreateWebhook(hook); err != nil {
+			log.Println("creating webhook failed", err)
+			page := webhookPage(mgo, c)
+			page.Error = "Creating the webhook failed"
+			return r.AdminWebhooks(page, c, http.StatusInternalServerError)
+		}
+		return c.Redirect(http.StatusSeeOther, "/admin/webhooks")
+	}
+}
+
+func DeleteWebhook(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := mgo.DeleteWebhook(c.Param("id")); err != nil {
+			log.Println("deleting webhook failed", c.Param("id"), err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/admin/webhooks")
+	}
+}
+
+// TestWebhook sends a test delivery to the webhook and shows the outcome,
+// as JSON when asked for.
+func TestWebhook(r *render.Render, mgo *service.Mongo, hooks *webhooks.Webhooks) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		hook := mgo.FindWebhook(c.Param("id"))
+		if hook == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		delivery, err := hooks.Test(hook)
+		if err != nil {
+			log.Println("test delivery failed", hook.Id.Hex(), err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+			return c.JSON(http.StatusOK, delivery)
+		}
+		page := webhookPage(mgo, c)
+		if delivery.Status == domain.DeliveryDelivered {
+			page.Notice = fmt.Sprintf("Test delivery to %s succeeded with %d", hook.Name, delivery.LastStatus)
+		} else {
+			page.Error = fmt.Sprintf("Test delivery to %s failed: %s", hook.Name, delivery.LastError)
+		}
+		return r.AdminWebhooks(page, c, http.StatusOK)
+	}
+}
+
+func RetryDelivery(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if err := mgo.RetryDelivery(c.Param("id")); err != nil {
+			log.Println("retrying webhook delivery failed", c.Param("id"), err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/admin/webhooks")
+	}
+}
+
+// AdminQueries reports what is searched for, by default in the past week.
+func AdminQueries(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		days, err := strconv.Atoi(c.QueryParam("days"))
+		if err != nil || days < 1 || days > service.QueryReportMaxDays {
+			days = 7
+		}
+		lang := c.QueryParam("lang")
+		if lang != "fi" && lang != "en" {
+			lang = ""
+		}
+		report := mgo.QueryReport(lang, days, time.Now())
+		return r.AdminQueries(render.AdminPage{Queries: &report, CSRF: csrfToken(c)}, c, http.StatusOK)
+	}
+}
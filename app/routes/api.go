@@ -2,6 +2,7 @@ package routes
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/jelinden/newsfeedreader/app/domain"
@@ -9,13 +10,34 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-// News returns news items as json
+const defaultNewsLimit = 20
+
+// News returns news items matching comma separated search terms as json
 func News(c echo.Context) error {
-	params := c.QueryParam("q")
-	paramSlice := validateParams(strings.Split(params, ","))
-	p := `"` + strings.Join(paramSlice, `" "`) + `"`
-	news := NewsItems{Items: service.News(p)}
-	return c.JSON(http.StatusOK, news)
+	lang := c.QueryParam("lang")
+	if lang == "" {
+		lang = "en"
+	}
+	if lang != "fi" && lang != "en" {
+		return invalidParameter(c, "lang", "lang must be fi or en")
+	}
+	limit := defaultNewsLimit
+	if l := c.QueryParam("limit"); l != "" {
+		var err error
+		if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxAPILimit {
+			return invalidParameter(c, "limit", "limit must be between 1 and "+strconv.Itoa(maxAPILimit))
+		}
+	}
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = service.SearchAll
+	}
+	if mode != service.SearchAny && mode != service.SearchAll && mode != service.SearchPhrase {
+		return invalidParameter(c, "mode", "mode must be any, all or phrase")
+	}
+	terms := validateParams(strings.Split(c.QueryParam("q"), ","))
+	items, total := service.News(terms, mode, lang, limit)
+	return c.JSON(http.StatusOK, NewsItems{Items: items, Total: total})
 }
 
 func validateParams(params []string) []string {
@@ -27,4 +49,5 @@ func validateParams(params []string) []string {
 
 type NewsItems struct {
 	Items []domain.RSS `json:"items"`
+	Total int64        `json:"total"`
 }
@@ -0,0 +1,272 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/related"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/suggest"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultAPILimit     = 30
+	maxAPILimit         = 100
+	defaultSuggestLimit = 10
+	maxSuggestLimit     = 20
+	defaultRelatedLimit = 10
+	maxRelatedLimit     = 50
+)
+
+type ItemsResponse struct {
+	Items      []domain.RSS   `json:"items"`
+	Pagination Pagination     `json:"pagination"`
+	Facets     *domain.Facets `json:"facets,omitempty"`
+}
+
+type Pagination struct {
+	Limit      int    `json:"limit"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+}
+
+func apiError(c echo.Context, status int, code string, message string, parameter string) error {
+	e := domain.NewAPIError(status, code, message)
+	e.Error.Parameter = parameter
+	return c.JSON(status, e)
+}
+
+func invalidParameter(c echo.Context, parameter string, message string) error {
+	return apiError(c, http.StatusBadRequest, "invalid_parameter", message, parameter)
+}
+
+// Items returns a page of news items as json
+func Items(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := service.ItemFilter{
+			Lang:     c.QueryParam("lang"),
+			Category: util.ToUpper(validateAndCorrectifySearchTerm(c.QueryParam("category"))),
+			Source:   util.ToUpper(validateAndCorrectifySearchTerm(c.QueryParam("source"))),
+			Query:    strings.TrimSpace(c.QueryParam("q")),
+			Cursor:   c.QueryParam("cursor"),
+			Limit:    defaultAPILimit,
+		}
+		if filter.Lang == "" {
+			filter.Lang = "fi"
+		}
+		if filter.Lang != "fi" && filter.Lang != "en" {
+			return invalidParameter(c, "lang", "lang must be fi or en")
+		}
+		if limit := c.QueryParam("limit"); limit != "" {
+			l, err := strconv.Atoi(limit)
+			if err != nil || l < 1 || l > maxAPILimit {
+				return invalidParameter(c, "limit", "limit must be between 1 and "+strconv.Itoa(maxAPILimit))
+			}
+			filter.Limit = l
+		}
+		switch sort := c.QueryParam("sort"); sort {
+		case "", service.SortDate:
+		case service.SortRelevance:
+			if filter.Query == "" {
+				return invalidParameter(c, "sort", "sorting by relevance needs search terms in q")
+			}
+			if filter.Cursor != "" {
+				return invalidParameter(c, "cursor", "results sorted by relevance have a single page")
+			}
+			filter.Sort = sort
+		default:
+			return invalidParameter(c, "sort", "sort must be relevance or date")
+		}
+		var err error
+		if filter.From, err = parseDate(c.QueryParam("from"), false); err != nil {
+			return invalidParameter(c, "from", "from must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		if filter.To, err = parseDate(c.QueryParam("to"), true); err != nil {
+			return invalidParameter(c, "to", "to must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+			return invalidParameter(c, "to", "to must be after from")
+		}
+
+		withFacets := false
+		switch c.QueryParam("facets") {
+		case "", "false":
+		case "true":
+			withFacets = true
+		default:
+			return invalidParameter(c, "facets", "facets must be true or false")
+		}
+
+		page, err := mgo.FetchItems(filter)
+		if err == service.ErrInvalidCursor {
+			return invalidParameter(c, "cursor", "cursor is not valid")
+		}
+		if e, ok := err.(*query.Error); ok {
+			return invalidParameter(c, "q", e.Error())
+		}
+		if err != nil {
+			log.Println("fetching items failed", err)
+			return apiError(c, http.StatusInternalServerError, "internal_error", "fetching items failed", "")
+		}
+		response := ItemsResponse{
+			Items: page.Items,
+			Pagination: Pagination{
+				Limit:      filter.Limit,
+				Total:      page.Total,
+				NextCursor: page.NextCursor,
+				HasMore:    page.NextCursor != "",
+			},
+		}
+		if withFacets {
+			facets, err := mgo.ItemFacets(filter)
+			if err != nil {
+				log.Println("counting facets failed", err)
+				return apiError(c, http.StatusInternalServerError, "internal_error", "counting facets failed", "")
+			}
+			response.Facets = &facets
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+type SuggestResponse struct {
+	Suggestions []suggest.Suggestion `json:"suggestions"`
+}
+
+// Suggest returns completions of the beginning of a search as json
+func Suggest(s *suggest.Suggester) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := c.QueryParam("lang")
+		if lang == "" {
+			lang = "fi"
+		}
+		if lang != "fi" && lang != "en" {
+			return invalidParameter(c, "lang", "lang must be fi or en")
+		}
+		q := strings.TrimSpace(c.QueryParam("q"))
+		if q == "" {
+			return invalidParameter(c, "q", "q is required")
+		}
+		if utf8.RuneCountInString(q) > query.MaxLength {
+			return invalidParameter(c, "q", "q must be at most "+strconv.Itoa(query.MaxLength)+" characters")
+		}
+		limit := defaultSuggestLimit
+		if l := c.QueryParam("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxSuggestLimit {
+				return invalidParameter(c, "limit", "limit must be between 1 and "+strconv.Itoa(maxSuggestLimit))
+			}
+		}
+		return c.JSON(http.StatusOK, SuggestResponse{Suggestions: s.Suggest(lang, q, limit)})
+	}
+}
+
+// RelatedItems returns the recent items most similar to an item as json
+func RelatedItems(mgo *service.Mongo, rel *related.Index) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			return apiError(c, http.StatusNotFound, "not_found", "no such item", "id")
+		}
+		limit := defaultRelatedLimit
+		if l := c.QueryParam("limit"); l != "" {
+			if limit, err = strconv.Atoi(l); err != nil || limit < 1 || limit > maxRelatedLimit {
+				return invalidParameter(c, "limit", "limit must be between 1 and "+strconv.Itoa(maxRelatedLimit))
+			}
+		}
+		found := mgo.ItemsByIds([]primitive.ObjectID{id})
+		if len(found) == 0 {
+			return apiError(c, http.StatusNotFound, "not_found", "no such item", "id")
+		}
+		items := mgo.ItemsByIds(rel.Related(found[0], limit))
+		if found[0].Language == "en" {
+			items = util.AddCategoryEnNames(items)
+		}
+		return c.JSON(http.StatusOK, RelatedResponse{Items: items})
+	}
+}
+
+type RelatedResponse struct {
+	Items []domain.RSS `json:"items"`
+}
+
+// Histogram returns the numbers of items a search finds per source and day
+// or hour as json
+func Histogram(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := service.HistogramRequest{
+			Query:    strings.TrimSpace(c.QueryParam("q")),
+			Lang:     c.QueryParam("lang"),
+			Interval: c.QueryParam("interval"),
+		}
+		if req.Lang == "" {
+			req.Lang = "fi"
+		}
+		if req.Lang != "fi" && req.Lang != "en" {
+			return invalidParameter(c, "lang", "lang must be fi or en")
+		}
+		switch req.Interval {
+		case "":
+			req.Interval = service.IntervalDay
+		case service.IntervalDay, service.IntervalHour:
+		default:
+			return invalidParameter(c, "interval", "interval must be day or hour")
+		}
+		var err error
+		if req.From, err = parseDate(c.QueryParam("from"), false); err != nil {
+			return invalidParameter(c, "from", "from must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		if req.To, err = parseDate(c.QueryParam("to"), true); err != nil {
+			return invalidParameter(c, "to", "to must be a date (2006-01-02) or an RFC 3339 timestamp")
+		}
+		if !req.From.IsZero() && !req.To.IsZero() && !req.From.Before(req.To) {
+			return invalidParameter(c, "to", "to must be after from")
+		}
+		h, err := mgo.Histogram(req)
+		if e, ok := err.(*query.Error); ok {
+			return invalidParameter(c, "q", e.Error())
+		}
+		if err == service.ErrHistogramRange {
+			return invalidParameter(c, "from", "the range must be at most "+strconv.Itoa(service.MaxHistogramBuckets)+" days or hours")
+		}
+		if err != nil {
+			log.Println("counting histogram failed", err)
+			return apiError(c, http.StatusInternalServerError, "internal_error", "counting histogram failed", "")
+		}
+		return c.JSON(http.StatusOK, h)
+	}
+}
+
+// parseDate accepts a date or an RFC 3339 timestamp. A date given as the
+// end of a range includes the whole day.
+func parseDate(value string, endOfRange bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfRange {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+// APINotFound answers unknown API paths with an error object
+func APINotFound(c echo.Context) error {
+	return apiError(c, http.StatusNotFound, "not_found", "no such endpoint", "")
+}
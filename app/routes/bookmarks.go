@@ -0,0 +1,115 @@
+package routes
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+func Bookmarks(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if middleware.CurrentUser(c) == nil {
+			return c.Redirect(http.StatusFound, "/"+lang+"/login")
+		}
+		page, err := strconv.Atoi(c.Param("page"))
+		if err != nil || page < 0 || page >= 999 {
+			page = 0
+		}
+		return r.Bookmarks("bookmarks_"+lang, lang, page, c)
+	}
+}
+
+func AddBookmark(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		item := mgo.FindItem(c.Param("id"))
+		if item == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		if err := mgo.AddBookmark(user.Id, *item); err != nil {
+			log.Println("adding bookmark failed", c.Param("id"), err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return bookmarkResponse(c, true)
+	}
+}
+
+func RemoveBookmark(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		if err := mgo.RemoveBookmark(user.Id, c.Param("id")); err != nil {
+			log.Println("removing bookmark failed", c.Param("id"), err)
+			return c.NoContent(http.StatusBadRequest)
+		}
+		return bookmarkResponse(c, false)
+	}
+}
+
+// bookmarkResponse answers scripts with json and forms by going back to the
+// page the form was on.
+func bookmarkResponse(c echo.Context, bookmarked bool) error {
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) {
+		return c.JSON(http.StatusOK, map[string]bool{"bookmarked": bookmarked})
+	}
+	return c.Redirect(http.StatusSeeOther, refererPath(c, "/"+formLang(c)+"/bookmarks"))
+}
+
+// ExportBookmarks downloads all bookmarks of the user as json or csv.
+func ExportBookmarks(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		format := c.Param("format")
+		if format != "json" && format != "csv" {
+			return c.NoContent(http.StatusNotFound)
+		}
+		bookmarks := mgo.Bookmarks(user.Id, 0, 0)
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="uutispuro-bookmarks.`+format+`"`)
+		if format == "json" {
+			return c.JSONPretty(http.StatusOK, map[string][]domain.Bookmark{"bookmarks": bookmarks}, "  ")
+		}
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		w := csv.NewWriter(c.Response())
+		w.Write([]string{"id", "title", "link", "source", "category", "language", "published", "bookmarked"})
+		for _, b := range bookmarks {
+			w.Write([]string{
+				b.ItemId.Hex(),
+				csvSafe(b.Title),
+				csvSafe(b.Link),
+				csvSafe(b.Source),
+				csvSafe(b.Category.CategoryName),
+				b.Language,
+				b.PubDate.UTC().Format(time.RFC3339),
+				b.Created.UTC().Format(time.RFC3339),
+			})
+		}
+		w.Flush()
+		return w.Error()
+	}
+}
+
+// csvSafe keeps spreadsheets from evaluating a cell as a formula.
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
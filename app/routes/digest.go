@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+func SaveDigestSettings(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		frequency := c.FormValue("frequency")
+		switch frequency {
+		case domain.DigestOff, domain.DigestDaily, domain.DigestWeekly:
+		default:
+			return c.NoContent(http.StatusBadRequest)
+		}
+		if !user.EmailVerified && frequency != domain.DigestOff {
+			return r.Searches(lang, searchErrors[lang]["digest"], c, http.StatusBadRequest)
+		}
+		if err := mgo.SaveDigestSettings(user.Id, frequency); err != nil {
+			log.Println("saving digest settings failed", err)
+			return r.Searches(lang, searchErrors[lang]["failed"], c, http.StatusInternalServerError)
+		}
+		return c.Redirect(http.StatusSeeOther, "/"+lang+"/searches")
+	}
+}
+
+// Unsubscribe asks to confirm the unsubscribe link of a digest, so that
+// link scanners of mail services do not unsubscribe anyone.
+func Unsubscribe(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		form := &domain.LoginForm{Form: "unsubscribe", Token: c.QueryParam("token")}
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
+
+// PostUnsubscribe stops the digests of the owner of the token. It takes
+// both the confirmation form and one click unsubscribe requests of mail
+// clients, which come without cookies and are not checked for csrf.
+func PostUnsubscribe(r *render.Render, mgo *service.Mongo, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		form := &domain.LoginForm{Form: "message", Errors: map[string]string{}}
+		userId, err := mgo.ConsumeUserToken(c.FormValue("token"), service.TokenUnsubscribe)
+		if err == nil {
+			err = mgo.SaveDigestSettings(userId, domain.DigestOff)
+		}
+		if err != nil {
+			if err != service.ErrInvalidToken {
+				log.Println("unsubscribing failed", err)
+			}
+			form.Errors["token"] = accountErrors[lang]["token"]
+			return r.Login("password", lang, form, c, http.StatusBadRequest)
+		}
+		form.Notice = accountNotices[lang]["unsubscribed"]
+		return r.Login("password", lang, form, c, http.StatusOK)
+	}
+}
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+// SearchHistogram downloads the time series of a search as json or csv.
+func SearchHistogram(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		format := c.Param("format")
+		if format != "json" && format != "csv" {
+			return c.NoContent(http.StatusNotFound)
+		}
+		req := render.HistogramRequest(lang, strings.TrimSpace(c.QueryParam("q")), c.QueryParam("interval"), c)
+		h, err := r.Mongo.Histogram(req)
+		if e, ok := err.(*query.Error); ok {
+			return c.String(http.StatusBadRequest, e.Message(lang))
+		}
+		if err == service.ErrHistogramRange {
+			return c.String(http.StatusBadRequest, "the range must be at most "+strconv.Itoa(service.MaxHistogramBuckets)+" days or hours")
+		}
+		if err != nil {
+			log.Println("counting histogram failed", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="uutispuro-histogram.`+format+`"`)
+		if format == "json" {
+			return c.JSONPretty(http.StatusOK, h, "  ")
+		}
+		c.Response().Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+		c.Response().WriteHeader(http.StatusOK)
+		return writeHistogramCSV(c.Response(), h)
+	}
+}
+
+// writeHistogramCSV writes a row for each day or hour with a column for
+// each source and the total.
+func writeHistogramCSV(w http.ResponseWriter, h domain.Histogram) error {
+	out := csv.NewWriter(w)
+	header := []string{"time"}
+	for _, s := range h.Sources {
+		header = append(header, csvSafe(s.Source))
+	}
+	out.Write(append(header, "total"))
+	for i, t := range h.Buckets {
+		row := []string{t.Format(time.RFC3339)}
+		total := 0
+		for _, s := range h.Sources {
+			row = append(row, strconv.Itoa(s.Counts[i]))
+			total += s.Counts[i]
+		}
+		out.Write(append(row, strconv.Itoa(total)))
+	}
+	out.Flush()
+	return out.Error()
+}
@@ -0,0 +1,128 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/oidc"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	oidcCookie   = "oidc"
+	oidcStateTTL = 10 * time.Minute
+)
+
+// oidcState is kept in a signed cookie between sending the user to the
+// provider and the provider sending the user back.
+type oidcState struct {
+	Provider string `json:"p"`
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+	Lang     string `json:"l"`
+}
+
+func findClient(clients []*oidc.Client, id string) *oidc.Client {
+	for _, client := range clients {
+		if client.ID == id {
+			return client
+		}
+	}
+	return nil
+}
+
+// OIDCLogin sends the user to log in at the provider.
+func OIDCLogin(r *render.Render, clients []*oidc.Client, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		client := findClient(clients, c.Param("provider"))
+		if client == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		lang := "fi"
+		if c.QueryParam("lang") == "en" {
+			lang = "en"
+		}
+		state := oidcState{Provider: client.ID, Lang: lang}
+		var err error
+		for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+			if *value, err = oidc.RandomString(); err != nil {
+				return err
+			}
+		}
+		authURL, err := client.AuthURL(state.State, state.Nonce, state.Verifier)
+		if err != nil {
+			log.Println("oidc discovery failed", client.ID, err)
+			return loginError(r, lang, "provider", c, http.StatusBadGateway)
+		}
+		value, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		cookies.SetSignedCookie(oidcCookie, string(value), oidcStateTTL, c)
+		return c.Redirect(http.StatusFound, authURL)
+	}
+}
+
+// OIDCCallback logs in the user the provider sent back. A user logging in
+// for the first time is linked to the account with the same email address
+// when the provider has verified it, or gets a new account.
+func OIDCCallback(r *render.Render, mgo *service.Mongo, clients []*oidc.Client, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		client := findClient(clients, c.Param("provider"))
+		if client == nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		state := oidcState{Lang: "fi"}
+		value, ok := cookies.SignedCookie(oidcCookie, c)
+		cookies.DeleteCookie(oidcCookie, c)
+		if !ok || json.Unmarshal([]byte(value), &state) != nil || state.Provider != client.ID ||
+			subtle.ConstantTimeCompare([]byte(state.State), []byte(c.QueryParam("state"))) != 1 {
+			return loginError(r, state.Lang, "provider", c, http.StatusBadRequest)
+		}
+		lang := state.Lang
+		if c.QueryParam("error") != "" || c.QueryParam("code") == "" {
+			return loginError(r, lang, "provider", c, http.StatusBadRequest)
+		}
+		claims, err := client.Exchange(c.QueryParam("code"), state.Verifier, state.Nonce)
+		if err != nil {
+			log.Println("oidc login failed", client.ID, err)
+			return loginError(r, lang, "provider", c, http.StatusBadRequest)
+		}
+
+		user := mgo.FindUserByIdentity(client.ID, claims.Subject)
+		if user == nil {
+			if !claims.EmailVerified || claims.Email == "" {
+				return loginError(r, lang, "unverified", c, http.StatusForbidden)
+			}
+			identity := domain.Identity{Provider: client.ID, Subject: claims.Subject, Linked: time.Now()}
+			if user = mgo.FindUserByEmail(claims.Email); user != nil {
+				err = mgo.LinkIdentity(user, identity)
+			} else {
+				name := claims.Name
+				if name == "" {
+					name, _, _ = strings.Cut(claims.Email, "@")
+				}
+				user, err = mgo.CreateLinkedUser(name, claims.Email, lang, identity)
+			}
+			if err != nil {
+				log.Println("linking oidc identity failed", client.ID, err)
+				return loginError(r, lang, "failed", c, http.StatusInternalServerError)
+			}
+		}
+		return startSession(r, mgo, cookies, user, lang, &domain.LoginForm{Form: "login", Errors: map[string]string{}}, c)
+	}
+}
+
+func loginError(r *render.Render, lang string, message string, c echo.Context, statusCode int) error {
+	form := &domain.LoginForm{Form: "login", Errors: map[string]string{"login": accountErrors[lang][message]}}
+	return r.Login("login", lang, form, c, statusCode)
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/labstack/echo/v4"
+)
+
+// maxPreferences limits the number of followed or muted names of each kind.
+const maxPreferences = 50
+
+// UpdatePreferences follows, mutes or clears a category or a source, or
+// hides or shows read items, for the logged in user, or in a cookie for
+// anonymous readers, and returns to the page the form was on.
+func UpdatePreferences(mgo *service.Mongo, cookies *util.CookieUtil) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		kind := c.FormValue("kind")
+		action := c.FormValue("action")
+		name := validateAndCorrectifySearchTerm(util.ToUpper(strings.TrimSpace(c.FormValue("name"))))
+		p := middleware.CurrentPreferences(c)
+		switch {
+		case action == "reset":
+			p = domain.Preferences{HideRead: p.HideRead}
+		case action == "hideRead" || action == "showRead":
+			p.HideRead = action == "hideRead"
+		case (kind == "category" || kind == "source") && name != "" &&
+			(action == "follow" || action == "mute" || action == "clear"):
+			p.Set(kind, name, action)
+			if len(p.FollowCategories) > maxPreferences || len(p.MuteCategories) > maxPreferences ||
+				len(p.FollowSources) > maxPreferences || len(p.MuteSources) > maxPreferences {
+				return c.NoContent(http.StatusBadRequest)
+			}
+		default:
+			return c.NoContent(http.StatusBadRequest)
+		}
+
+		if user := middleware.CurrentUser(c); user != nil {
+			if err := mgo.SavePreferences(user.Id, p); err != nil {
+				log.Println("saving preferences failed", err)
+				return c.NoContent(http.StatusInternalServerError)
+			}
+		} else if err := middleware.SetPreferencesCookie(cookies, p, c); err != nil {
+			log.Println("saving preferences cookie failed", err)
+			return c.NoContent(http.StatusInternalServerError)
+		}
+		return c.Redirect(http.StatusSeeOther, returnPath(c.FormValue("return"), refererPath(c, "/"+lang)))
+	}
+}
+
+// returnPath accepts only local paths to redirect to.
+func returnPath(path string, fallback string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return fallback
+	}
+	return path
+}
+
+// refererPath returns the local page the request came from.
+func refererPath(c echo.Context, fallback string) string {
+	if referer, err := url.Parse(c.Request().Referer()); err == nil && referer.Host == c.Request().Host {
+		return returnPath(referer.RequestURI(), fallback)
+	}
+	return fallback
+}
@@ -6,11 +6,13 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/jelinden/newsfeedreader/app/middleware"
 	"github.com/jelinden/newsfeedreader/app/render"
 	"github.com/jelinden/newsfeedreader/app/service"
 	"github.com/jelinden/newsfeedreader/app/util"
 
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func Root(c echo.Context) error {
@@ -27,12 +29,6 @@ func FiRoot(render *render.Render) echo.HandlerFunc {
 	}
 }
 
-func Login(render *render.Render, lang string) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		return render.Login("login", lang, c, http.StatusOK)
-	}
-}
-
 func EnRoot(render *render.Render) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		return render.Index("index_en", "en", 0, c, http.StatusOK)
@@ -63,32 +59,32 @@ func EnRootPaged(render *render.Render) echo.HandlerFunc {
 
 func FiSearch(render *render.Render) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return render.RenderSearch("search_fi", "fi", validateAndCorrectifySearchTerm(c.FormValue("q")), 0, c, http.StatusOK)
+		return render.RenderSearch("search_fi", "fi", strings.TrimSpace(c.FormValue("q")), 0, c, http.StatusOK)
 	}
 }
 func EnSearch(render *render.Render) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		return render.RenderSearch("search_en", "en", validateAndCorrectifySearchTerm(c.FormValue("q")), 0, c, http.StatusOK)
+		return render.RenderSearch("search_en", "en", strings.TrimSpace(c.FormValue("q")), 0, c, http.StatusOK)
 	}
 }
 func FiSearchPaged(render *render.Render) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if page, err := strconv.Atoi(c.Param("page")); err == nil {
 			if page < 999 && page >= 0 {
-				return render.RenderSearch("search_fi", "fi", validateAndCorrectifySearchTerm(c.FormValue("q")), page, c, http.StatusOK)
+				return render.RenderSearch("search_fi", "fi", strings.TrimSpace(c.FormValue("q")), page, c, http.StatusOK)
 			}
 		}
-		return render.RenderSearch("search_fi", "fi", validateAndCorrectifySearchTerm(c.FormValue("q")), 0, c, http.StatusOK)
+		return render.RenderSearch("search_fi", "fi", strings.TrimSpace(c.FormValue("q")), 0, c, http.StatusOK)
 	}
 }
 func EnSearchPaged(render *render.Render) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		if page, err := strconv.Atoi(c.Param("page")); err == nil {
 			if page < 999 && page >= 0 {
-				return render.RenderSearch("search_en", "en", validateAndCorrectifySearchTerm(c.FormValue("q")), page, c, http.StatusOK)
+				return render.RenderSearch("search_en", "en", strings.TrimSpace(c.FormValue("q")), page, c, http.StatusOK)
 			}
 		}
-		return render.RenderSearch("search_en", "en", validateAndCorrectifySearchTerm(c.FormValue("q")), 0, c, http.StatusOK)
+		return render.RenderSearch("search_en", "en", strings.TrimSpace(c.FormValue("q")), 0, c, http.StatusOK)
 	}
 }
 func FiCategory(render *render.Render) echo.HandlerFunc {
@@ -135,9 +131,46 @@ func EnSource(render *render.Render) echo.HandlerFunc {
 		return render.BySource("source_en", "en", validateAndCorrectifySearchTerm(category), 0, c, http.StatusOK)
 	}
 }
+func Feed(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		listing := render.Listing{
+			Lang:     lang,
+			Category: validateAndCorrectifySearchTerm(util.ToUpper(c.Param("category"))),
+			Source:   validateAndCorrectifySearchTerm(util.ToUpper(c.Param("source"))),
+		}
+		return r.Feed(listing, c.Param("format"), c)
+	}
+}
+
+// SearchFeed serves the feed of a search, which needs a query.
+func SearchFeed(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		searchString := strings.TrimSpace(c.QueryParam("q"))
+		if searchString == "" {
+			return c.String(http.StatusBadRequest, searchErrors[lang]["query"])
+		}
+		return r.Feed(render.Listing{Lang: lang, SearchQuery: searchString}, c.Param("format"), c)
+	}
+}
+
+// Item shows an item with the news related to it.
+func Item(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			return c.NoContent(http.StatusNotFound)
+		}
+		return r.Item("item_"+lang, lang, id, c)
+	}
+}
+
 func Click(mgo *service.Mongo) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		mgo.SaveClick(validateAndCorrectifySearchTerm(c.Param("id")))
+		id := validateAndCorrectifySearchTerm(c.Param("id"))
+		mgo.SaveClick(id)
+		if user := middleware.CurrentUser(c); user != nil {
+			mgo.MarkRead(user.Id, id)
+		}
 		return c.NoContent(http.StatusOK)
 	}
 }
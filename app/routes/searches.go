@@ -0,0 +1,144 @@
+package routes
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/jelinden/newsfeedreader/app/alerts"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/render"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/labstack/echo/v4"
+)
+
+var searchErrors = map[string]map[string]string{
+	"fi": {
+		"query":   "Hakusana puuttuu",
+		"tooMany": "Voit tallentaa enintään 20 hakua",
+		"webhook": "Webhookin osoitteen pitää olla http- tai https-osoite",
+		"private": "Webhookin osoitteen pitää olla julkinen, ei sisäverkon tai paikallinen",
+		"resolve": "Webhookin palvelinta ei löydy, tarkista osoite",
+		"email":   "Vahvista sähköpostiosoitteesi saadaksesi hälytykset sähköpostiin",
+		"digest":  "Vahvista sähköpostiosoitteesi saadaksesi koosteen",
+		"failed":  "Jotain meni vikaan, yritä uudelleen",
+	},
+	"en": {
+		"query":   "Search terms are missing",
+		"tooMany": "You can save at most 20 searches",
+		"webhook": "The webhook address must be an http or https url",
+		"private": "The webhook address must be public, not internal or local",
+		"resolve": "The webhook host cannot be found, check the address",
+		"email":   "Confirm your email address to get alerts by email",
+		"digest":  "Confirm your email address to get the digest",
+		"failed":  "Something went wrong, please try again",
+	},
+}
+
+func SavedSearches(r *render.Render, lang string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if middleware.CurrentUser(c) == nil {
+			return c.Redirect(http.StatusFound, "/"+lang+"/login")
+		}
+		return r.Searches(lang, "", c, http.StatusOK)
+	}
+}
+
+func SaveSearch(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		q := strings.TrimSpace(c.FormValue("q"))
+		node, err := query.Parse(q)
+		if err != nil {
+			return r.Searches(lang, err.(*query.Error).Message(lang), c, http.StatusBadRequest)
+		}
+		if node == nil {
+			return r.Searches(lang, searchErrors[lang]["query"], c, http.StatusBadRequest)
+		}
+		name := strings.TrimSpace(c.FormValue("name"))
+		if name == "" {
+			name = q
+		}
+		if len([]rune(name)) > 100 {
+			name = string([]rune(name)[:100])
+		}
+		if _, err := mgo.SaveSearch(user.Id, name, q, lang); err != nil {
+			if err == service.ErrTooManySearches {
+				return r.Searches(lang, searchErrors[lang]["tooMany"], c, http.StatusBadRequest)
+			}
+			log.Println("saving search failed", err)
+			return r.Searches(lang, searchErrors[lang]["failed"], c, http.StatusInternalServerError)
+		}
+		return c.Redirect(http.StatusSeeOther, "/"+lang+"/searches")
+	}
+}
+
+func DeleteSavedSearch(mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		if err := mgo.DeleteSavedSearch(user.Id, c.Param("id")); err != nil {
+			log.Println("deleting saved search failed", c.Param("id"), err)
+		}
+		return c.Redirect(http.StatusSeeOther, "/"+lang+"/searches")
+	}
+}
+
+func SaveAlertSettings(r *render.Render, mgo *service.Mongo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		lang := formLang(c)
+		user := middleware.CurrentUser(c)
+		if user == nil {
+			return c.Redirect(http.StatusSeeOther, "/"+lang+"/login")
+		}
+		settings := domain.AlertSettings{
+			Frequency:  c.FormValue("frequency"),
+			Channel:    c.FormValue("channel"),
+			WebhookURL: strings.TrimSpace(c.FormValue("webhookUrl")),
+		}
+		switch settings.Frequency {
+		case domain.AlertOff, domain.AlertInstant, domain.AlertHourly, domain.AlertDaily:
+		default:
+			return c.NoContent(http.StatusBadRequest)
+		}
+		switch settings.Channel {
+		case domain.AlertEmail:
+			settings.WebhookURL = ""
+			if !user.EmailVerified && settings.Frequency != domain.AlertOff {
+				return r.Searches(lang, searchErrors[lang]["email"], c, http.StatusBadRequest)
+			}
+		case domain.AlertWebhook:
+			if err := alerts.ValidateWebhookURL(settings.WebhookURL); err != nil {
+				return r.Searches(lang, searchErrors[lang][webhookError(err)], c, http.StatusBadRequest)
+			}
+		default:
+			return c.NoContent(http.StatusBadRequest)
+		}
+		if err := mgo.SaveAlertSettings(user.Id, settings); err != nil {
+			log.Println("saving alert settings failed", err)
+			return r.Searches(lang, searchErrors[lang]["failed"], c, http.StatusInternalServerError)
+		}
+		return c.Redirect(http.StatusSeeOther, "/"+lang+"/searches")
+	}
+}
+
+// webhookError returns the key of the message of an invalid webhook url.
+func webhookError(err error) string {
+	switch {
+	case errors.Is(err, alerts.ErrNotPublic):
+		return "private"
+	case errors.Is(err, alerts.ErrUnresolved):
+		return "resolve"
+	}
+	return "webhook"
+}
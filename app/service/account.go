@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// userCollections hold documents of a single user by userId. Click counts
+// of items and other aggregates are not linked to users and stay when an
+// account is deleted.
+var userCollections = []string{
+	"sessions",
+	"usertokens",
+	"savedsearches",
+	"alertqueue",
+	"bookmarks",
+	"reads",
+	"digests",
+}
+
+// exportedCollections are the user collections ExportAccount includes,
+// every one but the tokens, which are secrets. A new collection of user
+// documents goes to both lists.
+var exportedCollections = []string{
+	"sessions",
+	"savedsearches",
+	"alertqueue",
+	"bookmarks",
+	"reads",
+	"digests",
+}
+
+// ExportAccount collects everything stored about the user.
+func (m *Mongo) ExportAccount(userId primitive.ObjectID) (*domain.AccountExport, error) {
+	user := m.FindUser(userId)
+	if user == nil {
+		return nil, errors.New("user not found")
+	}
+	export := &domain.AccountExport{
+		Exported:      time.Now(),
+		Profile:       user,
+		Sessions:      []domain.SessionInfo{},
+		SavedSearches: []domain.SavedSearch{},
+		PendingAlerts: []domain.AlertItem{},
+		Bookmarks:     []domain.Bookmark{},
+		ReadHistory:   []domain.ReadDay{},
+		Digests:       []domain.DigestRecord{},
+	}
+	query := M{"userId": userId}
+	if err := findAll("sessions", query, "created", &export.Sessions); err != nil {
+		return nil, err
+	}
+	if err := findAll("savedsearches", query, "created", &export.SavedSearches); err != nil {
+		return nil, err
+	}
+	if err := findAll("alertqueue", query, "created", &export.PendingAlerts); err != nil {
+		return nil, err
+	}
+	if err := findAll("bookmarks", query, "created", &export.Bookmarks); err != nil {
+		return nil, err
+	}
+	if err := findAll("digests", query, "sent", &export.Digests); err != nil {
+		return nil, err
+	}
+	days := []reads{}
+	if err := findAll("reads", query, "_id", &days); err != nil {
+		return nil, err
+	}
+	for _, day := range days {
+		_, date, _ := strings.Cut(day.Id, ":")
+		export.ReadHistory = append(export.ReadHistory, domain.ReadDay{Day: date, Items: day.Items})
+	}
+	return export, nil
+}
+
+// DeleteAccount removes the user and all documents of the user. The user
+// document goes last, so that a failed deletion can be tried again.
+func (m *Mongo) DeleteAccount(userId primitive.ObjectID) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	for _, name := range userCollections {
+		c := mongoConn.Client.Database("news").Collection(name)
+		if _, err := c.DeleteMany(ctx, M{"userId": userId}); err != nil {
+			return err
+		}
+	}
+	users := mongoConn.Client.Database("news").Collection("users")
+	_, err := users.DeleteOne(ctx, M{"_id": userId})
+	return err
+}
+
+func findAll(collection string, query M, sort string, result interface{}) error {
+	c := mongoConn.Client.Database("news").Collection(collection)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, query, options.Find().SetSort(bson.D{{Key: sort, Value: 1}}))
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, result)
+}
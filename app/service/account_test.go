@@ -0,0 +1,39 @@
+package service
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+)
+
+// TestAccountExportSecrets tests that the export leaves out the password hash
+func TestAccountExportSecrets(t *testing.T) {
+	export := domain.AccountExport{Profile: &domain.User{Email: "matti@example.com", PasswordHash: "$2a$10$secret"}}
+	body, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(body), "secret") || !strings.Contains(string(body), "matti@example.com") {
+		t.Errorf("Unexpected export %s", body)
+	}
+}
+
+// TestUserCollections tests that the account is deleted from every
+// collection it is exported from
+func TestUserCollections(t *testing.T) {
+	deleted := map[string]bool{}
+	for _, c := range userCollections {
+		deleted[c] = true
+	}
+	for _, c := range exportedCollections {
+		if !deleted[c] {
+			t.Errorf("Collection %s is exported but not deleted with the account", c)
+		}
+		delete(deleted, c)
+	}
+	if len(deleted) != 1 || !deleted["usertokens"] {
+		t.Errorf("Only tokens should be left out of the export, left out %v", deleted)
+	}
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// analyzeBatch is how many items are analyzed at a time.
+const analyzeBatch = 500
+
+// AnalyzeItems stores the search tokens of the titles of items. New items
+// are analyzed by ingestion before the handlers that search them.
+func (m *Mongo) AnalyzeItems(items []domain.RSS) {
+	if len(items) == 0 {
+		return
+	}
+	updates := make([]mongo.WriteModel, len(items))
+	for i := range items {
+		items[i].Tokens = analyze.Tokens(items[i].Language, items[i].RssTitle)
+		updates[i] = mongo.NewUpdateOneModel().
+			SetFilter(M{"_id": items[i].Id}).
+			SetUpdate(M{"$set": M{"tokens": items[i].Tokens}})
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if _, err := c.BulkWrite(ctx, updates, options.BulkWrite().SetOrdered(false)); err != nil {
+		log.Println("storing search tokens failed", err)
+	}
+}
+
+// AnalyzeMissing analyzes the items stored without search tokens, those
+// from before the analyzer or added while ingestion was not running.
+func (m *Mongo) AnalyzeMissing() int {
+	return m.analyzeAll(M{"tokens": M{"$exists": false}})
+}
+
+// Reanalyze analyzes every item again, needed after the analyzer changes.
+func (m *Mongo) Reanalyze() int {
+	return m.analyzeAll(M{})
+}
+
+// analyzeAll analyzes the items matching filter in batches and returns how
+// many there were.
+func (m *Mongo) analyzeAll(filter M) int {
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	count := 0
+	last := primitive.NilObjectID
+	for {
+		items := []domain.RSS{}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		opts := options.Find().
+			SetSort(bson.D{{Key: "_id", Value: 1}}).
+			SetLimit(analyzeBatch).
+			SetProjection(M{"rssTitle": 1, "language": 1})
+		cursor, err := c.Find(ctx, M{"$and": []M{filter, {"_id": M{"$gt": last}}}}, opts)
+		if err == nil {
+			err = cursor.All(ctx, &items)
+		}
+		cancel()
+		if err != nil {
+			log.Println("finding items to analyze failed", err)
+			return count
+		}
+		m.AnalyzeItems(items)
+		count += len(items)
+		if len(items) < analyzeBatch {
+			return count
+		}
+		last = items[len(items)-1].Id
+	}
+}
+
+func (m *Mongo) createAnalyzeIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "language", Value: 1}, {Key: "tokens", Value: 1}},
+	})
+	return err
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	apiKeyPrefix      = "upk_"
+	apiKeyCacheTTL    = 1 * time.Minute
+	apiKeyCacheMaxLen = 10000
+)
+
+type apiKeyCacheEntry struct {
+	key     *domain.APIKey
+	expires time.Time
+}
+
+type apiKeyUsage struct {
+	requests, rejected int64
+	lastUsed           time.Time
+}
+
+// apiKeys caches key lookups and buffers usage counters between flushes.
+type apiKeys struct {
+	mutex sync.Mutex
+	cache map[string]apiKeyCacheEntry
+	usage map[primitive.ObjectID]*apiKeyUsage
+}
+
+func newAPIKeys() apiKeys {
+	return apiKeys{
+		cache: make(map[string]apiKeyCacheEntry),
+		usage: make(map[primitive.ObjectID]*apiKeyUsage),
+	}
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key and returns it. The plain key is returned
+// only here, afterwards it can not be recovered.
+func (m *Mongo) CreateAPIKey(name string, contact string, ratePerMinute int, burst int) (string, *domain.APIKey, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, err
+	}
+	plain := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	key := &domain.APIKey{
+		Id:            primitive.NewObjectID(),
+		Name:          name,
+		Contact:       contact,
+		Prefix:        plain[:len(apiKeyPrefix)+6],
+		Hash:          hashAPIKey(plain),
+		RatePerMinute: ratePerMinute,
+		Burst:         burst,
+		Created:       time.Now(),
+	}
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, key); err != nil {
+		return "", nil, err
+	}
+	return plain, key, nil
+}
+
+// FindAPIKey returns the active key matching plain or nil. Lookups are
+// cached for a minute, so revoking a key takes effect within that time.
+func (m *Mongo) FindAPIKey(plain string) *domain.APIKey {
+	hash := hashAPIKey(plain)
+	m.apiKeys.mutex.Lock()
+	if entry, ok := m.apiKeys.cache[hash]; ok && time.Now().Before(entry.expires) {
+		m.apiKeys.mutex.Unlock()
+		return entry.key
+	}
+	m.apiKeys.mutex.Unlock()
+
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	key := &domain.APIKey{}
+	err := c.FindOne(ctx, M{"hash": hash, "revoked": false}).Decode(key)
+	if err == mongo.ErrNoDocuments {
+		key = nil
+	} else if err != nil {
+		log.Println("api key lookup failed", err)
+		return nil
+	}
+
+	m.apiKeys.mutex.Lock()
+	if len(m.apiKeys.cache) >= apiKeyCacheMaxLen {
+		m.apiKeys.cache = make(map[string]apiKeyCacheEntry)
+	}
+	m.apiKeys.cache[hash] = apiKeyCacheEntry{key: key, expires: time.Now().Add(apiKeyCacheTTL)}
+	m.apiKeys.mutex.Unlock()
+	return key
+}
+
+func (m *Mongo) ListAPIKeys() []domain.APIKey {
+	result := []domain.APIKey{}
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{}, options.Find().SetSort(bson.D{{Key: "created", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+
+	today := []struct {
+		KeyId    primitive.ObjectID `bson:"keyId"`
+		Requests int64              `bson:"requests"`
+		Rejected int64              `bson:"rejected"`
+	}{}
+	usage := mongoConn.Client.Database("news").Collection("apikeyusage")
+	cursor, err = usage.Find(ctx, M{"day": time.Now().UTC().Format("2006-01-02")})
+	if err != nil {
+		log.Println(err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &today); err != nil {
+		log.Println(err)
+	}
+	for i := range result {
+		for _, u := range today {
+			if u.KeyId == result[i].Id {
+				result[i].RequestsToday = u.Requests
+				result[i].RejectedToday = u.Rejected
+			}
+		}
+	}
+	return result
+}
+
+func (m *Mongo) RevokeAPIKey(id string) error {
+	keyId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err = c.UpdateOne(ctx, M{"_id": keyId}, M{"$set": M{"revoked": true}}); err != nil {
+		return err
+	}
+	m.apiKeys.mutex.Lock()
+	m.apiKeys.cache = make(map[string]apiKeyCacheEntry)
+	m.apiKeys.mutex.Unlock()
+	return nil
+}
+
+// RecordAPIKeyUsage counts a request made with a key. Counts are written
+// to the database by FlushAPIKeyUsage.
+func (m *Mongo) RecordAPIKeyUsage(id primitive.ObjectID, allowed bool) {
+	m.apiKeys.mutex.Lock()
+	defer m.apiKeys.mutex.Unlock()
+	u, ok := m.apiKeys.usage[id]
+	if !ok {
+		u = &apiKeyUsage{}
+		m.apiKeys.usage[id] = u
+	}
+	if allowed {
+		u.requests++
+	} else {
+		u.rejected++
+	}
+	u.lastUsed = time.Now()
+}
+
+func (m *Mongo) FlushAPIKeyUsage(now time.Time) {
+	m.apiKeys.mutex.Lock()
+	usage := m.apiKeys.usage
+	m.apiKeys.usage = make(map[primitive.ObjectID]*apiKeyUsage)
+	m.apiKeys.mutex.Unlock()
+	if len(usage) == 0 {
+		return
+	}
+
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	daily := mongoConn.Client.Database("news").Collection("apikeyusage")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	day := now.UTC().Format("2006-01-02")
+	for id, u := range usage {
+		inc := M{"requests": u.requests, "rejected": u.rejected}
+		if _, err := c.UpdateOne(ctx, M{"_id": id}, M{"$inc": inc, "$max": M{"lastUsed": u.lastUsed}}); err != nil {
+			log.Println("saving api key usage failed", id.Hex(), err)
+		}
+		_, err := daily.UpdateOne(ctx, M{"keyId": id, "day": day}, M{"$inc": inc}, options.Update().SetUpsert(true))
+		if err != nil {
+			log.Println("saving daily api key usage failed", id.Hex(), err)
+		}
+	}
+}
+
+func (m *Mongo) createAPIKeyIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("apikeys")
+	_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "hash", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+	usage := mongoConn.Client.Database("news").Collection("apikeyusage")
+	_, err = usage.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "keyId", Value: 1}, {Key: "day", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindItem returns a news item by its hex id, or nil.
+func (m *Mongo) FindItem(id string) *domain.RSS {
+	itemId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := &domain.RSS{}
+	if err := c.FindOne(ctx, M{"_id": itemId}).Decode(item); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("finding item failed", id, err)
+		}
+		return nil
+	}
+	return item
+}
+
+// AddBookmark saves a copy of the item for the user. Bookmarking an item
+// twice keeps the first bookmark.
+func (m *Mongo) AddBookmark(userId primitive.ObjectID, item domain.RSS) error {
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.UpdateOne(ctx,
+		M{"userId": userId, "itemId": item.Id},
+		M{"$setOnInsert": domain.Bookmark{
+			Id:       primitive.NewObjectID(),
+			UserId:   userId,
+			ItemId:   item.Id,
+			Title:    item.RssTitle,
+			Link:     item.RssLink,
+			Source:   item.RssSource,
+			Category: item.Category,
+			Language: item.Language,
+			PubDate:  item.PubDate,
+			Created:  time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (m *Mongo) RemoveBookmark(userId primitive.ObjectID, id string) error {
+	itemId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.DeleteOne(ctx, M{"userId": userId, "itemId": itemId})
+	return err
+}
+
+// Bookmarks returns the bookmarks of the user, latest first. A count of
+// zero returns all of them.
+func (m *Mongo) Bookmarks(userId primitive.ObjectID, from int, count int) []domain.Bookmark {
+	result := []domain.Bookmark{}
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "created", Value: -1}})
+	if count > 0 {
+		opts.SetSkip(int64(from * count)).SetLimit(int64(count))
+	}
+	cursor, err := c.Find(ctx, M{"userId": userId}, opts)
+	if err != nil {
+		log.Println("finding bookmarks failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// CountBookmarks returns the number of bookmarks of the user.
+func (m *Mongo) CountBookmarks(userId primitive.ObjectID) int {
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := c.CountDocuments(ctx, M{"userId": userId})
+	if err != nil {
+		log.Println("counting bookmarks failed", err)
+	}
+	return int(count)
+}
+
+// Bookmarked tells which of the items the user has bookmarked.
+func (m *Mongo) Bookmarked(userId primitive.ObjectID, items []domain.RSS) map[primitive.ObjectID]bool {
+	result := map[primitive.ObjectID]bool{}
+	if len(items) == 0 {
+		return result
+	}
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := options.Find().SetProjection(M{"itemId": 1})
+	cursor, err := c.Find(ctx, M{"userId": userId, "itemId": M{"$in": ids}}, opts)
+	if err != nil {
+		log.Println("finding bookmarked items failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		bookmark := domain.Bookmark{}
+		if err := cursor.Decode(&bookmark); err == nil {
+			result[bookmark.ItemId] = true
+		}
+	}
+	return result
+}
+
+func (m *Mongo) createBookmarkIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("bookmarks")
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "itemId", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "created", Value: -1}}},
+	})
+	return err
+}
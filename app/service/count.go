@@ -0,0 +1,69 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exactCountLimit is how many matches are counted one by one. Larger sets
+// are estimated, counting all of them is too slow for a page view.
+const exactCountLimit = 10000
+
+// countItems returns the number of items matching filter, estimated when
+// there are more than exactCountLimit of them.
+func countItems(filter M) (total int, estimated bool) {
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := c.CountDocuments(ctx, filter, options.Count().SetLimit(exactCountLimit))
+	if err != nil {
+		log.Println("counting items failed", err)
+		return 0, false
+	}
+	if count < exactCountLimit {
+		return int(count), false
+	}
+
+	// the items of the newest exactCountLimit matches and the oldest match
+	// tell the rate at which matches are published
+	pubDate := func(skip int64, order int) (time.Time, bool) {
+		item := struct {
+			PubDate time.Time `bson:"pubDate"`
+		}{}
+		opts := options.FindOne().
+			SetSort(bson.D{{Key: "pubDate", Value: order}}).
+			SetSkip(skip).
+			SetProjection(M{"pubDate": 1})
+		if err := c.FindOne(ctx, filter, opts).Decode(&item); err != nil {
+			log.Println("estimating item count failed", err)
+			return item.PubDate, false
+		}
+		return item.PubDate, true
+	}
+	newest, ok1 := pubDate(0, -1)
+	nth, ok2 := pubDate(exactCountLimit-1, -1)
+	oldest, ok3 := pubDate(0, 1)
+	if !ok1 || !ok2 || !ok3 {
+		return exactCountLimit, true
+	}
+	return estimate(exactCountLimit, newest, nth, oldest), true
+}
+
+// estimate extrapolates the number of matches from the counted newest
+// ones, published between newest and nth, to all of them back to oldest
+// assuming they are published at an even rate. The estimate is rounded to
+// two significant digits and is never less than counted.
+func estimate(counted int, newest time.Time, nth time.Time, oldest time.Time) int {
+	span := newest.Sub(nth)
+	if span <= 0 || !oldest.Before(nth) {
+		return counted
+	}
+	total := float64(counted) * float64(newest.Sub(oldest)) / float64(span)
+	unit := math.Pow(10, math.Floor(math.Log10(total))-1)
+	return max(counted, int(math.Round(total/unit)*unit))
+}
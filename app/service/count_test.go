@@ -0,0 +1,27 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// TestEstimate tests extrapolating the number of matches from the newest
+func TestEstimate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day := 24 * time.Hour
+	tests := []struct {
+		newest, nth, oldest time.Time
+		expected            int
+	}{
+		// 10000 in 10 days, 100 days in all
+		{now, now.Add(-10 * day), now.Add(-100 * day), 100000},
+		{now, now.Add(-7 * day), now.Add(-100 * day), 140000},
+		{now, now.Add(-10 * day), now.Add(-10 * day), 10000},
+		{now, now, now.Add(-10 * day), 10000},
+	}
+	for _, test := range tests {
+		if got := estimate(10000, test.newest, test.nth, test.oldest); got != test.expected {
+			t.Errorf("estimate(%v, %v, %v) = %d, expected %d", test.newest, test.nth, test.oldest, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// digestCandidates limits the clicked items a digest is picked from.
+const digestCandidates = 200
+
+// DigestSubscribers returns the users with a verified email address who
+// get a digest.
+func (m *Mongo) DigestSubscribers() []domain.User {
+	result := []domain.User{}
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{
+		"emailVerified":    true,
+		"digest.frequency": M{"$in": []string{domain.DigestDaily, domain.DigestWeekly}},
+	})
+	if err != nil {
+		log.Println("finding digest subscribers failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// DigestCandidates returns the most clicked items published between since
+// and until on the front page of the preferences.
+func (m *Mongo) DigestCandidates(lang string, p domain.Preferences, since time.Time, until time.Time) []domain.RSS {
+	result := []domain.RSS{}
+	query := FrontPageQuery(lang, p)
+	query["pubDate"] = M{"$gt": since, "$lte": until}
+	query["clicks"] = M{"$gt": 0}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	findOptions := options.Find().
+		SetSort(bson.D{{Key: "clicks", Value: -1}, {Key: "pubDate", Value: -1}}).
+		SetLimit(digestCandidates)
+	cursor, err := c.Find(ctx, query, findOptions)
+	if err != nil {
+		log.Println("finding digest items failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// RecordDigest saves the sent digest and moves the time of the user's next
+// digest forward.
+func (m *Mongo) RecordDigest(record domain.DigestRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if len(record.Items) > 0 {
+		record.Id = primitive.NewObjectID()
+		digests := mongoConn.Client.Database("news").Collection("digests")
+		if _, err := digests.InsertOne(ctx, record); err != nil {
+			return err
+		}
+	}
+	users := mongoConn.Client.Database("news").Collection("users")
+	_, err := users.UpdateOne(ctx, M{"_id": record.UserId}, M{"$set": M{"digest.lastSent": record.Sent}})
+	return err
+}
+
+// Digests returns the digests sent to the user, newest first.
+func (m *Mongo) Digests(userId primitive.ObjectID) []domain.DigestRecord {
+	result := []domain.DigestRecord{}
+	c := mongoConn.Client.Database("news").Collection("digests")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{"userId": userId}, options.Find().SetSort(bson.D{{Key: "sent", Value: -1}}))
+	if err != nil {
+		log.Println("finding digests failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+func (m *Mongo) SaveDigestSettings(userId primitive.ObjectID, frequency string) error {
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{"digest.frequency": frequency}})
+	return err
+}
+
+func (m *Mongo) createDigestIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("digests")
+	_, err := c.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "sent", Value: -1}},
+	})
+	return err
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+)
+
+// Histogram intervals.
+const (
+	IntervalDay  = "day"
+	IntervalHour = "hour"
+)
+
+const (
+	// MaxHistogramBuckets limits the days or hours of a histogram.
+	MaxHistogramBuckets = 750
+	// histogram ranges when none is given
+	defaultHistogramDays  = 30
+	defaultHistogramHours = 48
+)
+
+var ErrHistogramRange = errors.New("histogram range too long")
+
+// HistogramRequest is a histogram of a search from From until To.
+type HistogramRequest struct {
+	Query    string
+	Lang     string
+	Interval string
+	From     time.Time
+	To       time.Time
+}
+
+// WithDefaults fills in the range of a histogram, by default the 30 days
+// or 48 hours before now or To.
+func (req HistogramRequest) WithDefaults(now time.Time) HistogramRequest {
+	if req.Interval != IntervalHour {
+		req.Interval = IntervalDay
+	}
+	if req.To.IsZero() {
+		req.To = now
+	}
+	if req.From.IsZero() {
+		if req.Interval == IntervalHour {
+			req.From = req.To.Add(-defaultHistogramHours * time.Hour)
+		} else {
+			req.From = req.To.AddDate(0, 0, -defaultHistogramDays)
+		}
+	}
+	return req
+}
+
+// buckets returns the starts of the days or hours from the one From is in
+// until To in local time, and the key of each in the format of Mongo.
+func (req HistogramRequest) buckets() ([]time.Time, []string) {
+	from := req.From.In(time.Local)
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	next := func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	format := DayFormat
+	if req.Interval == IntervalHour {
+		start = time.Date(from.Year(), from.Month(), from.Day(), from.Hour(), 0, 0, 0, time.Local)
+		next = func(t time.Time) time.Time { return t.Add(time.Hour) }
+		format = "2006-01-02T15"
+	}
+	starts, keys := []time.Time{}, []string{}
+	for t := start; t.Before(req.To) && len(starts) <= MaxHistogramBuckets; t = next(t) {
+		starts = append(starts, t)
+		keys = append(keys, t.Format(format))
+	}
+	return starts, keys
+}
+
+// Histogram counts the items matching a query of the search language per
+// source and day or hour. Parse errors are returned as *query.Error and
+// too long ranges as ErrHistogramRange.
+func (m *Mongo) Histogram(req HistogramRequest) (domain.Histogram, error) {
+	req = req.WithDefaults(time.Now())
+	starts, keys := req.buckets()
+	if len(starts) > MaxHistogramBuckets {
+		return domain.Histogram{}, ErrHistogramRange
+	}
+	node, err := query.Parse(req.Query)
+	if err != nil {
+		return domain.Histogram{}, err
+	}
+	filter := M{
+		"language": req.Lang,
+		"pubDate":  M{"$gte": req.From, "$lt": req.To},
+	}
+	if node != nil {
+		filter["$and"] = []M{M(node.Filter(req.Lang))}
+	}
+	format := "%Y-%m-%d"
+	if req.Interval == IntervalHour {
+		format = "%Y-%m-%dT%H"
+	}
+	pipeline := []M{
+		{"$match": filter},
+		{"$group": M{
+			"_id": M{
+				"source": "$rssSource",
+				"bucket": M{"$dateToString": M{"format": format, "date": "$pubDate", "timezone": timezone(req.From)}},
+			},
+			"count": M{"$sum": 1},
+		}},
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		return domain.Histogram{}, err
+	}
+	defer cursor.Close(ctx)
+	counts := []bucketCount{}
+	if err := cursor.All(ctx, &counts); err != nil {
+		return domain.Histogram{}, err
+	}
+	h := buildHistogram(keys, counts)
+	h.Query, h.Lang, h.Interval, h.From, h.To, h.Buckets = req.Query, req.Lang, req.Interval, req.From, req.To, starts
+	return h, nil
+}
+
+type bucketCount struct {
+	Id struct {
+		Source string `bson:"source"`
+		Bucket string `bson:"bucket"`
+	} `bson:"_id"`
+	Count int `bson:"count"`
+}
+
+// buildHistogram puts the counts of the sources into the buckets of keys,
+// the sources with most items first.
+func buildHistogram(keys []string, counts []bucketCount) domain.Histogram {
+	index := make(map[string]int, len(keys))
+	for i, k := range keys {
+		index[k] = i
+	}
+	h := domain.Histogram{Sources: []domain.HistogramSeries{}}
+	series := map[string]*domain.HistogramSeries{}
+	for _, c := range counts {
+		i, ok := index[c.Id.Bucket]
+		if !ok {
+			continue
+		}
+		s := series[c.Id.Source]
+		if s == nil {
+			s = &domain.HistogramSeries{Source: c.Id.Source, Counts: make([]int, len(keys))}
+			series[c.Id.Source] = s
+		}
+		s.Counts[i] += c.Count
+		s.Total += c.Count
+		h.Total += c.Count
+	}
+	for _, s := range series {
+		h.Sources = append(h.Sources, *s)
+	}
+	sort.Slice(h.Sources, func(i, j int) bool {
+		if h.Sources[i].Total != h.Sources[j].Total {
+			return h.Sources[i].Total > h.Sources[j].Total
+		}
+		return h.Sources[i].Source < h.Sources[j].Source
+	})
+	return h
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestHistogramBuckets tests the days and hours of a histogram range
+func TestHistogramBuckets(t *testing.T) {
+	from := time.Date(2026, 3, 1, 10, 30, 0, 0, time.Local)
+	req := HistogramRequest{Interval: IntervalDay, From: from, To: time.Date(2026, 3, 4, 0, 0, 0, 0, time.Local)}
+	starts, keys := req.buckets()
+	if !reflect.DeepEqual(keys, []string{"2026-03-01", "2026-03-02", "2026-03-03"}) {
+		t.Errorf("day keys %v", keys)
+	}
+	if !starts[0].Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("first day starts at %v", starts[0])
+	}
+	req = HistogramRequest{Interval: IntervalHour, From: from, To: from.Add(2 * time.Hour)}
+	if _, keys = req.buckets(); !reflect.DeepEqual(keys, []string{"2026-03-01T10", "2026-03-01T11", "2026-03-01T12"}) {
+		t.Errorf("hour keys %v", keys)
+	}
+	req = HistogramRequest{Interval: IntervalHour, From: from.AddDate(-1, 0, 0), To: from}
+	if starts, _ = req.buckets(); len(starts) <= MaxHistogramBuckets {
+		t.Errorf("a year of hours has %d buckets", len(starts))
+	}
+}
+
+// TestHistogramDefaults tests the default interval and range
+func TestHistogramDefaults(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.Local)
+	req := HistogramRequest{}.WithDefaults(now)
+	if req.Interval != IntervalDay || !req.To.Equal(now) || !req.From.Equal(now.AddDate(0, 0, -30)) {
+		t.Errorf("day defaults %+v", req)
+	}
+	req = HistogramRequest{Interval: IntervalHour}.WithDefaults(now)
+	if !req.From.Equal(now.Add(-48 * time.Hour)) {
+		t.Errorf("hour defaults %+v", req)
+	}
+}
+
+// TestBuildHistogram tests counting sources into the buckets
+func TestBuildHistogram(t *testing.T) {
+	count := func(source string, bucket string, n int) bucketCount {
+		c := bucketCount{Count: n}
+		c.Id.Source, c.Id.Bucket = source, bucket
+		return c
+	}
+	h := buildHistogram([]string{"2026-03-01", "2026-03-02"}, []bucketCount{
+		count("Yle", "2026-03-01", 2),
+		count("HS", "2026-03-01", 1),
+		count("HS", "2026-03-02", 4),
+		count("Yle", "2026-02-28", 9),
+	})
+	if h.Total != 7 || len(h.Sources) != 2 {
+		t.Fatalf("histogram %+v", h)
+	}
+	if h.Sources[0].Source != "HS" || !reflect.DeepEqual(h.Sources[0].Counts, []int{1, 4}) || h.Sources[0].Total != 5 {
+		t.Errorf("first source %+v", h.Sources[0])
+	}
+	if h.Sources[1].Source != "Yle" || !reflect.DeepEqual(h.Sources[1].Counts, []int{2, 0}) {
+		t.Errorf("second source %+v", h.Sources[1])
+	}
+}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ItemFilter selects news items for the JSON API. Empty fields match
+// everything.
+type ItemFilter struct {
+	Lang     string
+	Category string
+	Source   string
+	Query    string
+	Sort     string
+	From     time.Time
+	To       time.Time
+	Cursor   string
+	Limit    int
+}
+
+// ItemPage is one page of items with the cursor of the next page.
+type ItemPage struct {
+	Items      []domain.RSS
+	Total      int64
+	NextCursor string
+}
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FetchItems returns items newest first. Paging is keyed on publish date
+// and id, so new items arriving between requests do not shift pages. Items
+// sorted by relevance to the search terms come as a single page.
+func (m *Mongo) FetchItems(filter ItemFilter) (ItemPage, error) {
+	page := ItemPage{Items: []domain.RSS{}}
+	query, err := filter.query()
+	if err != nil {
+		return page, err
+	}
+	pageQuery := query
+	if filter.Cursor != "" {
+		pubDate, id, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		pageQuery = M{"$and": []M{query, {"$or": []M{
+			{"pubDate": M{"$lt": pubDate}},
+			{"pubDate": pubDate, "_id": M{"$lt": id}},
+		}}}}
+	}
+
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	total, err := c.CountDocuments(ctx, query)
+	if err != nil {
+		return page, err
+	}
+	page.Total = total
+
+	if filter.Sort == SortRelevance {
+		page.Items, err = filter.ranked(query)
+		if filter.Lang == "en" {
+			page.Items = util.AddCategoryEnNames(page.Items)
+		}
+		return page, err
+	}
+
+	limit := int64(filter.Limit + 1)
+	findOptions := options.FindOptions{
+		Limit: &limit,
+		Sort:  bson.D{{Key: "pubDate", Value: -1}, {Key: "_id", Value: -1}},
+	}
+	cursor, err := c.Find(ctx, pageQuery, &findOptions)
+	if err != nil {
+		return page, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &page.Items); err != nil {
+		return page, err
+	}
+	if node := filter.node(); node != nil {
+		highlight(node, filter.Lang, page.Items)
+	}
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeCursor(last.PubDate, last.Id)
+	}
+	if filter.Lang == "en" {
+		page.Items = util.AddCategoryEnNames(page.Items)
+	}
+	return page, nil
+}
+
+// ItemFacets counts the items matching filter by category, source and day.
+func (m *Mongo) ItemFacets(filter ItemFilter) (domain.Facets, error) {
+	query, err := filter.query()
+	if err != nil {
+		return domain.Facets{}, err
+	}
+	return facets(query, filter.Lang), nil
+}
+
+func (f ItemFilter) query() (M, error) {
+	query := M{}
+	if f.Lang != "" {
+		query["language"] = f.Lang
+	}
+	if f.Category != "" {
+		query["category.categoryName"] = f.Category
+	}
+	if f.Source != "" {
+		query["rssSource"] = f.Source
+	}
+	if f.Query != "" {
+		filter, err := searchFilter(f.Query, f.Lang)
+		if err != nil {
+			return nil, err
+		}
+		query["$and"] = []M{filter}
+	}
+	pubDate := M{}
+	if !f.From.IsZero() {
+		pubDate["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		pubDate["$lt"] = f.To
+	}
+	if len(pubDate) > 0 {
+		query["pubDate"] = pubDate
+	}
+	return query, nil
+}
+
+// LatestItemId returns the id of the newest item in the collection.
+func (m *Mongo) LatestItemId() primitive.ObjectID {
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	item := domain.RSS{}
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetProjection(M{"_id": 1})
+	if err := c.FindOne(ctx, M{}, opts).Decode(&item); err != nil {
+		log.Println("finding latest item failed", err)
+	}
+	return item.Id
+}
+
+// ItemsAfter returns at most limit items added after the item with id, in
+// the order they were added.
+func (m *Mongo) ItemsAfter(id primitive.ObjectID, limit int) ([]domain.RSS, error) {
+	result := []domain.RSS{}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit))
+	cursor, err := c.Find(ctx, M{"_id": M{"$gt": id}}, opts)
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+	err = cursor.All(ctx, &result)
+	return result, err
+}
+
+// ItemsSince returns the items published since a time.
+func (m *Mongo) ItemsSince(since time.Time) []domain.RSS {
+	result := []domain.RSS{}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{"pubDate": M{"$gte": since}})
+	if err != nil {
+		log.Println("finding recent items failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// ItemsByIds returns the items with ids in the order of ids, leaving out
+// the ones not found.
+func (m *Mongo) ItemsByIds(ids []primitive.ObjectID) []domain.RSS {
+	result := []domain.RSS{}
+	if len(ids) == 0 {
+		return result
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{"_id": M{"$in": ids}})
+	if err != nil {
+		log.Println("finding items failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	found := []domain.RSS{}
+	if err := cursor.All(ctx, &found); err != nil {
+		log.Println(err)
+	}
+	byId := make(map[primitive.ObjectID]domain.RSS, len(found))
+	for _, item := range found {
+		byId[item.Id] = item
+	}
+	for _, id := range ids {
+		if item, ok := byId[id]; ok {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func encodeCursor(pubDate time.Time, id primitive.ObjectID) string {
+	raw := strconv.FormatInt(pubDate.UnixMilli(), 10) + ":" + id.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, primitive.ObjectID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+	millis, hex, found := strings.Cut(string(raw), ":")
+	if !found {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return time.Time{}, primitive.NilObjectID, ErrInvalidCursor
+	}
+	return time.UnixMilli(ms).UTC(), id, nil
+}
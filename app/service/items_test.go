@@ -0,0 +1,73 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestCursorRoundTrip tests that a cursor decodes to the item it was made from
+func TestCursorRoundTrip(t *testing.T) {
+	pubDate := time.Date(2026, 3, 1, 12, 30, 15, 123000000, time.UTC)
+	id := primitive.NewObjectID()
+
+	gotDate, gotId, err := decodeCursor(encodeCursor(pubDate, id))
+	if err != nil {
+		t.Fatalf("Decoding cursor failed: %v", err)
+	}
+	if !gotDate.Equal(pubDate) || gotId != id {
+		t.Errorf("Expected %v %s, got %v %s", pubDate, id.Hex(), gotDate, gotId.Hex())
+	}
+
+	for _, cursor := range []string{"not base64!", "bm9jb2xvbg", "YWJjOmRlZg"} {
+		if _, _, err := decodeCursor(cursor); err != ErrInvalidCursor {
+			t.Errorf("Cursor %q should be invalid, got %v", cursor, err)
+		}
+	}
+}
+
+// TestItemFilterQuery tests that only given filters end up in the query
+func TestItemFilterQuery(t *testing.T) {
+	query, _ := ItemFilter{Lang: "fi"}.query()
+	if len(query) != 1 || query["language"] != "fi" {
+		t.Errorf("Unexpected query %v", query)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, err := ItemFilter{Lang: "en", Category: "Talous", Source: "Yle", Query: "euro", From: from}.query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query["category.categoryName"] != "Talous" || query["rssSource"] != "Yle" {
+		t.Errorf("Category and source missing from %v", query)
+	}
+	if _, ok := query["$and"]; !ok {
+		t.Error("Search terms missing from query")
+	}
+	pubDate, ok := query["pubDate"].(M)
+	if !ok || pubDate["$gte"] != from || pubDate["$lt"] != nil {
+		t.Errorf("Unexpected date range %v", query["pubDate"])
+	}
+	if _, err := (ItemFilter{Query: `"euro`}).query(); err == nil {
+		t.Error("A query with a parse error should fail")
+	}
+}
+
+// TestSearchNode tests how search terms are combined for each mode
+func TestSearchNode(t *testing.T) {
+	terms := []string{"talous", " asunto  laina ", ""}
+	tests := map[string]string{
+		SearchAny:    `talous OR asunto OR laina`,
+		SearchAll:    `talous "asunto laina"`,
+		SearchPhrase: `"talous asunto laina"`,
+	}
+	for mode, expected := range tests {
+		if got := SearchNode(terms, mode); got == nil || got.String() != expected {
+			t.Errorf("Mode %s: expected %s, got %v", mode, expected, got)
+		}
+	}
+	if got := SearchNode([]string{"", " "}, SearchAll); got != nil {
+		t.Errorf("Empty terms should give no query, got %v", got)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/jelinden/newsfeedreader/app/analyze"
 	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
 	"github.com/jelinden/newsfeedreader/app/util"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -25,6 +27,7 @@ type Mongo struct {
 	mostReadCacheTTL      time.Duration
 	indexesCreated        bool
 	indexesMutex          sync.Mutex
+	apiKeys               apiKeys
 }
 
 var mongoConn Mongo
@@ -46,6 +49,7 @@ func NewMongo(mongoAddress string) *Mongo {
 		mostReadCacheExpiry: make(map[string]time.Time),
 		mostReadCacheTTL:    1 * time.Hour,
 		indexesCreated:      false,
+		apiKeys:             newAPIKeys(),
 	}
 	go mongoConn.createIndexes()
 	return &mongoConn
@@ -85,44 +89,83 @@ func (m *Mongo) createIndexes() {
 		m.indexesCreated = true
 		log.Println("indexes created successfully")
 	}
+	if err := m.createAPIKeyIndexes(ctx); err != nil {
+		log.Println("failed to create api key indexes:", err)
+	}
+	if err := m.createUserIndexes(ctx); err != nil {
+		log.Println("failed to create user indexes:", err)
+	}
+	if err := m.createSearchIndexes(ctx); err != nil {
+		log.Println("failed to create saved search indexes:", err)
+	}
+	if err := m.createBookmarkIndexes(ctx); err != nil {
+		log.Println("failed to create bookmark indexes:", err)
+	}
+	if err := m.createReadIndexes(ctx); err != nil {
+		log.Println("failed to create read state indexes:", err)
+	}
+	if err := m.createDigestIndexes(ctx); err != nil {
+		log.Println("failed to create digest indexes:", err)
+	}
+	if err := m.createWebhookIndexes(ctx); err != nil {
+		log.Println("failed to create webhook indexes:", err)
+	}
+	if err := m.createAnalyzeIndexes(ctx); err != nil {
+		log.Println("failed to create search token indexes:", err)
+	}
+	if err := m.createQueryLogIndexes(ctx); err != nil {
+		log.Println("failed to create query log indexes:", err)
+	}
 }
 
-func (m *Mongo) FetchRssItems(lang string, from int, count int) []domain.RSS {
-	query := M{
-		"language":              lang,
-		"category.categoryName": M{"$nin": []string{"Mobiili", "Blogs"}},
-	}
-	result := m.query(query, from, count)
+func (m *Mongo) FetchRssItems(lang string, from int, count int, exclude ...primitive.ObjectID) []domain.RSS {
+	result := m.query(excludeItems(FrontPageQuery(lang, domain.Preferences{}), exclude), from, count)
 	if lang == "en" {
 		result = util.AddCategoryEnNames(result)
 	}
 	return result
 }
 
-func (m *Mongo) FetchRssItemsByCategory(lang string, category string, from int, count int) []domain.RSS {
-	query := M{
-		"language":              lang,
-		"category.categoryName": category,
-	}
-	result := m.query(query, from, count)
+func (m *Mongo) FetchRssItemsByCategory(lang string, category string, from int, count int, exclude ...primitive.ObjectID) []domain.RSS {
+	result := m.query(excludeItems(categoryQuery(lang, category), exclude), from, count)
 	if lang == "en" {
 		result = util.AddCategoryEnNames(result)
 	}
 	return result
 }
 
-func (m *Mongo) FetchRssItemsBySource(lang string, source string, from int, count int) []domain.RSS {
-	query := M{
-		"language":  lang,
-		"rssSource": source,
-	}
-	result := m.query(query, from, count)
+func (m *Mongo) FetchRssItemsBySource(lang string, source string, from int, count int, exclude ...primitive.ObjectID) []domain.RSS {
+	result := m.query(excludeItems(sourceQuery(lang, source), exclude), from, count)
 	if lang == "en" {
 		result = util.AddCategoryEnNames(result)
 	}
 	return result
 }
 
+// CountRssItemsByCategory and CountRssItemsBySource return the number of
+// items of a category or a source page, estimated when there are many.
+func (m *Mongo) CountRssItemsByCategory(lang string, category string, exclude ...primitive.ObjectID) (int, bool) {
+	return countItems(excludeItems(categoryQuery(lang, category), exclude))
+}
+
+func (m *Mongo) CountRssItemsBySource(lang string, source string, exclude ...primitive.ObjectID) (int, bool) {
+	return countItems(excludeItems(sourceQuery(lang, source), exclude))
+}
+
+func categoryQuery(lang string, category string) M {
+	return M{
+		"language":              lang,
+		"category.categoryName": category,
+	}
+}
+
+func sourceQuery(lang string, source string) M {
+	return M{
+		"language":  lang,
+		"rssSource": source,
+	}
+}
+
 func (m *Mongo) MostReadWeekly(lang string, from int, count int) []domain.RSS {
 	cacheKey := lang
 	
@@ -178,42 +221,6 @@ func (m *Mongo) MostReadWeekly(lang string, from int, count int) []domain.RSS {
 	return result
 }
 
-func (m *Mongo) Search(searchString string, lang string, from int, count int) []domain.RSS {
-	query := M{
-		"$text":    M{"$search": "\"" + searchString + "\"", "$language": lang},
-		"language": lang,
-	}
-
-	result := []domain.RSS{}
-	c := mongoConn.Client.Database("news").Collection("newscollection")
-
-	limit := int64(count)
-	skip := int64(from * count)
-	findOptions := options.FindOptions{
-		Limit: &limit,
-		Sort:  bson.D{{Key: "pubDate", Value: -1}},
-		Skip:  &skip,
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	
-	cursor, err := c.Find(ctx, query, &findOptions)
-	if err != nil {
-		log.Println("search failed", err)
-		return result
-	}
-	defer cursor.Close(ctx)
-	if err := cursor.All(ctx, &result); err != nil {
-		log.Println(err)
-	}
-
-	if lang == "en" {
-		result = util.AddCategoryEnNames(result)
-	}
-	return result
-}
-
 func (m *Mongo) query(query map[string]interface{}, from int, count int) []domain.RSS {
 	result := []domain.RSS{}
 	c := mongoConn.Client.Database("news").Collection("newscollection")
@@ -256,29 +263,92 @@ func (m *Mongo) SaveClick(id string) {
 	}
 }
 
-func News(searchString string) []domain.RSS {
+// News searches items of a language with terms combined according to mode
+// and returns at most limit of them with the total count of matches.
+func News(terms []string, mode string, lang string, limit int) ([]domain.RSS, int64) {
 	var result = []domain.RSS{}
+	node := SearchNode(terms, mode)
+	if node == nil {
+		return result, 0
+	}
 	query := M{
-		"$text":    M{"$search": `"` + searchString + `"`, "$language": "en"},
-		"language": "en",
+		"language": lang,
+		"$and":     []M{M(node.Filter(lang))},
 	}
-	limit := int64(20)
+	l := int64(limit)
 	findOptions := options.FindOptions{
-		Limit: &limit,
+		Limit: &l,
 		Sort:  bson.D{{Key: "pubDate", Value: -1}},
 	}
 	c := mongoConn.Client.Database("news").Collection("newscollection")
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	
+
+	total, err := c.CountDocuments(ctx, query)
+	if err != nil {
+		log.Println(err)
+		return result, 0
+	}
 	cursor, err := c.Find(ctx, query, &findOptions)
 	if err != nil {
 		log.Println(err)
-		return result
+		return result, total
 	}
 	defer cursor.Close(ctx)
 	if err := cursor.All(ctx, &result); err != nil {
 		log.Println(err)
 	}
-	return result
+	if lang == "en" {
+		result = util.AddCategoryEnNames(result)
+	}
+	return result, total
+}
+
+// Search modes of News
+const (
+	SearchAny    = "any"
+	SearchAll    = "all"
+	SearchPhrase = "phrase"
+)
+
+// SearchNode combines search terms to a query matched against the analyzed
+// titles. With SearchAny an item matches if it has any of the words, with
+// SearchAll it must contain every term, a term of many words as a phrase,
+// and with SearchPhrase the terms in order. Without terms it returns nil.
+func SearchNode(terms []string, mode string) query.Node {
+	words := [][]string{}
+	for _, term := range terms {
+		if w := analyze.Words(term); len(w) > 0 {
+			words = append(words, w)
+		}
+	}
+	if len(words) == 0 {
+		return nil
+	}
+	switch mode {
+	case SearchAny:
+		or := query.Or{}
+		for _, w := range words {
+			for _, word := range w {
+				or = append(or, query.Term(word))
+			}
+		}
+		return or
+	case SearchPhrase:
+		var phrase query.Phrase
+		for _, w := range words {
+			phrase = append(phrase, w...)
+		}
+		return phrase
+	default:
+		and := query.And{}
+		for _, w := range words {
+			if len(w) == 1 {
+				and = append(and, query.Term(w[0]))
+			} else {
+				and = append(and, query.Phrase(w))
+			}
+		}
+		return and
+	}
 }
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// hiddenCategories are never on the front page.
+var hiddenCategories = []string{"Mobiili", "Blogs"}
+
+// FrontPageQuery is the front page query of a language narrowed down by the
+// reader's preferences: followed categories and sources are combined with
+// or, muted ones are excluded.
+func FrontPageQuery(lang string, p domain.Preferences) M {
+	query := M{
+		"language":              lang,
+		"category.categoryName": M{"$nin": append(append([]string{}, hiddenCategories...), p.MuteCategories...)},
+	}
+	if len(p.MuteSources) > 0 {
+		query["rssSource"] = M{"$nin": p.MuteSources}
+	}
+	var follows []M
+	if len(p.FollowCategories) > 0 {
+		follows = append(follows, M{"category.categoryName": M{"$in": p.FollowCategories}})
+	}
+	if len(p.FollowSources) > 0 {
+		follows = append(follows, M{"rssSource": M{"$in": p.FollowSources}})
+	}
+	if len(follows) > 0 {
+		query["$or"] = follows
+	}
+	return query
+}
+
+func (m *Mongo) FetchPersonalRssItems(lang string, p domain.Preferences, from int, count int, exclude ...primitive.ObjectID) []domain.RSS {
+	result := m.query(excludeItems(FrontPageQuery(lang, p), exclude), from, count)
+	if lang == "en" {
+		result = util.AddCategoryEnNames(result)
+	}
+	return result
+}
+
+func (m *Mongo) SavePreferences(userId primitive.ObjectID, p domain.Preferences) error {
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{"preferences": p}})
+	return err
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+)
+
+// TestFrontPageQuery tests how follows and mutes narrow down the front page
+func TestFrontPageQuery(t *testing.T) {
+	query := FrontPageQuery("fi", domain.Preferences{})
+	if _, ok := query["$or"]; ok || query["rssSource"] != nil {
+		t.Errorf("Without preferences expected the plain front page query, got %v", query)
+	}
+
+	p := domain.Preferences{}
+	p.Set("category", "Talous", "follow")
+	p.Set("source", "Yle", "follow")
+	p.Set("category", "Urheilu", "mute")
+	p.Set("source", "Iltalehti", "mute")
+	query = FrontPageQuery("fi", p)
+	categories := query["category.categoryName"].(M)["$nin"].([]string)
+	if !reflect.DeepEqual(categories, []string{"Mobiili", "Blogs", "Urheilu"}) {
+		t.Errorf("Muted category should be excluded with the hidden ones, got %v", categories)
+	}
+	if !reflect.DeepEqual(query["rssSource"], M{"$nin": []string{"Iltalehti"}}) {
+		t.Errorf("Muted source should be excluded, got %v", query["rssSource"])
+	}
+	follows := query["$or"].([]M)
+	if len(follows) != 2 {
+		t.Fatalf("Followed category and source should be combined with or, got %v", follows)
+	}
+	if !reflect.DeepEqual(hiddenCategories, []string{"Mobiili", "Blogs"}) {
+		t.Errorf("Building the query must not change hidden categories, got %v", hiddenCategories)
+	}
+
+	p.Set("category", "Talous", "mute")
+	if p.FollowsCategory("Talous") || !p.MutesCategory("Talous") {
+		t.Error("Muting a followed category should stop following it")
+	}
+	p.Set("source", "Yle", "clear")
+	if p.FollowsSource("Yle") || p.MutesSource("Yle") {
+		t.Error("Clearing should forget the source")
+	}
+}
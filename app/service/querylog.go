@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// queryLogRetention is how long logged searches are kept.
+	queryLogRetention = 90 * 24 * time.Hour
+	// QueryReportMaxDays is the longest period of a report, half of the
+	// retention as the period is compared to the one before it.
+	QueryReportMaxDays = 45
+	// queryReportRows is the length of each list of a report.
+	queryReportRows = 50
+	// minTrendingCount leaves queries searched only a few times out of the
+	// trending ones.
+	minTrendingCount = 3
+)
+
+// LogQuery stores a search in its normalized form. Invalid queries and
+// queries that look like they contain personal data are not stored.
+func (m *Mongo) LogQuery(entry domain.QueryLog) {
+	if query.Personal(entry.Query) {
+		return
+	}
+	if entry.Query = query.Normalize(entry.Query); entry.Query == "" {
+		return
+	}
+	entry.Id = primitive.NewObjectID()
+	c := mongoConn.Client.Database("news").Collection("querylog")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, entry); err != nil {
+		log.Println("logging search failed", err)
+	}
+}
+
+// QueryReport summarizes the searches of lang, or of both languages when
+// lang is empty, of the days before now.
+func (m *Mongo) QueryReport(lang string, days int, now time.Time) domain.QueryReport {
+	report := domain.QueryReport{Lang: lang, Days: days, From: now.AddDate(0, 0, -days), To: now}
+	previous := now.AddDate(0, 0, -2*days)
+	filter := M{"time": M{"$gte": previous, "$lt": now}}
+	if lang != "" {
+		filter["lang"] = lang
+	}
+	current := M{"$gte": bson.A{"$time", report.From}}
+	countIf := func(condition interface{}) M {
+		return M{"$sum": M{"$cond": bson.A{condition, 1, 0}}}
+	}
+	pipeline := []M{
+		{"$match": filter},
+		{"$group": M{
+			"_id":         "$query",
+			"count":       countIf(current),
+			"previous":    countIf(M{"$lt": bson.A{"$time", report.From}}),
+			"zeroResults": countIf(M{"$and": bson.A{current, M{"$eq": bson.A{"$results", 0}}}}),
+			"results":     M{"$sum": M{"$cond": bson.A{current, "$results", 0}}},
+			"latency":     M{"$sum": M{"$cond": bson.A{current, "$latencyMs", 0}}},
+		}},
+	}
+	c := mongoConn.Client.Database("news").Collection("querylog")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("reporting searches failed", err)
+		return report
+	}
+	defer cursor.Close(ctx)
+	stats := []queryStats{}
+	if err := cursor.All(ctx, &stats); err != nil {
+		log.Println("reporting searches failed", err)
+	}
+	summarize(&report, stats, queryReportRows)
+	return report
+}
+
+type queryStats struct {
+	Query       string `bson:"_id"`
+	Count       int    `bson:"count"`
+	Previous    int    `bson:"previous"`
+	ZeroResults int    `bson:"zeroResults"`
+	Results     int64  `bson:"results"`
+	Latency     int64  `bson:"latency"`
+}
+
+// summarize fills in the totals and the lists of a report from the counts
+// of each query, at most rows queries in each list.
+func summarize(report *domain.QueryReport, stats []queryStats, rows int) {
+	all := []domain.QueryStat{}
+	latency := int64(0)
+	for _, s := range stats {
+		report.Searches += s.Count
+		report.ZeroResults += s.ZeroResults
+		latency += s.Latency
+		if s.Count == 0 {
+			continue
+		}
+		all = append(all, domain.QueryStat{
+			Query:        s.Query,
+			Count:        s.Count,
+			Previous:     s.Previous,
+			ZeroResults:  s.ZeroResults,
+			AvgResults:   int(s.Results / int64(s.Count)),
+			AvgLatencyMs: s.Latency / int64(s.Count),
+		})
+	}
+	if report.Searches > 0 {
+		report.AvgLatencyMs = latency / int64(report.Searches)
+	}
+	top := func(keep func(s domain.QueryStat) bool, less func(a, b domain.QueryStat) bool) []domain.QueryStat {
+		result := []domain.QueryStat{}
+		for _, s := range all {
+			if keep(s) {
+				result = append(result, s)
+			}
+		}
+		sort.Slice(result, func(i, j int) bool {
+			if less(result[i], result[j]) != less(result[j], result[i]) {
+				return less(result[i], result[j])
+			}
+			return result[i].Query < result[j].Query
+		})
+		return result[:min(rows, len(result))]
+	}
+	byCount := func(a, b domain.QueryStat) bool { return a.Count > b.Count }
+	report.Top = top(func(s domain.QueryStat) bool { return true }, byCount)
+	report.Zero = top(func(s domain.QueryStat) bool { return s.ZeroResults > 0 }, func(a, b domain.QueryStat) bool {
+		return a.ZeroResults > b.ZeroResults
+	})
+	// growth is compared with one search added to both periods, so that
+	// new queries rank by their count
+	report.Trending = top(func(s domain.QueryStat) bool { return s.Count >= minTrendingCount && s.Count > s.Previous },
+		func(a, b domain.QueryStat) bool {
+			return float64(a.Count+1)/float64(a.Previous+1) > float64(b.Count+1)/float64(b.Previous+1)
+		})
+}
+
+// PopularQueries returns the queries of lang searched at least minCount
+// times since a time, at most limit of the most searched, with their
+// counts.
+func (m *Mongo) PopularQueries(lang string, since time.Time, minCount int, limit int) map[string]int {
+	c := mongoConn.Client.Database("news").Collection("querylog")
+	return countBy(c, M{"lang": lang, "time": M{"$gte": since}}, "$query", minCount, limit)
+}
+
+// ItemCounts returns how many items of lang published since a time have
+// each value of field, e.g. rssSource.
+func (m *Mongo) ItemCounts(lang string, field string, since time.Time) map[string]int {
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	return countBy(c, M{"language": lang, "pubDate": M{"$gte": since}}, "$"+field, 1, 0)
+}
+
+// countBy groups the documents matching filter by a field expression and
+// returns the counts of at least minCount, at most limit of the largest
+// when limit is positive.
+func countBy(c *mongo.Collection, filter M, field string, minCount int, limit int) map[string]int {
+	result := map[string]int{}
+	pipeline := []M{
+		{"$match": filter},
+		{"$group": M{"_id": field, "count": M{"$sum": 1}}},
+		{"$match": M{"count": M{"$gte": minCount}}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, M{"$limit": limit})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("counting failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		row := struct {
+			Value string `bson:"_id"`
+			Count int    `bson:"count"`
+		}{}
+		if err := cursor.Decode(&row); err == nil && row.Value != "" {
+			result[row.Value] = row.Count
+		}
+	}
+	return result
+}
+
+// RecentTitles returns the titles of the items of lang published since a
+// time.
+func (m *Mongo) RecentTitles(lang string, since time.Time) []string {
+	result := []string{}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	opts := options.Find().SetProjection(M{"rssTitle": 1})
+	cursor, err := c.Find(ctx, M{"language": lang, "pubDate": M{"$gte": since}}, opts)
+	if err != nil {
+		log.Println("finding recent titles failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		item := domain.RSS{}
+		if err := cursor.Decode(&item); err == nil {
+			result = append(result, item.RssTitle)
+		}
+	}
+	return result
+}
+
+func (m *Mongo) createQueryLogIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("querylog")
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "lang", Value: 1}, {Key: "time", Value: -1}}},
+		{Keys: bson.D{{Key: "time", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(queryLogRetention.Seconds()))},
+	})
+	return err
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+)
+
+// TestSummarize tests the totals and the lists of a search report
+func TestSummarize(t *testing.T) {
+	report := domain.QueryReport{}
+	summarize(&report, []queryStats{
+		{Query: "korko", Count: 10, Previous: 10, Results: 500, Latency: 100},
+		{Query: "vaalit", Count: 6, Previous: 1, Results: 60, Latency: 60},
+		{Query: "uusi", Count: 3, Previous: 0, ZeroResults: 3, Latency: 30},
+		{Query: "harvinainen", Count: 1, ZeroResults: 1, Latency: 10},
+		{Query: "vanha", Count: 0, Previous: 8},
+	}, 2)
+	if report.Searches != 20 || report.ZeroResults != 4 || report.AvgLatencyMs != 10 {
+		t.Errorf("totals %d searches, %d zero, %d ms", report.Searches, report.ZeroResults, report.AvgLatencyMs)
+	}
+	queries := func(stats []domain.QueryStat) []string {
+		result := []string{}
+		for _, s := range stats {
+			result = append(result, s.Query)
+		}
+		return result
+	}
+	expected := map[string][]string{
+		"top":      {"korko", "vaalit"},
+		"zero":     {"uusi", "harvinainen"},
+		"trending": {"uusi", "vaalit"},
+	}
+	for name, got := range map[string][]string{"top": queries(report.Top), "zero": queries(report.Zero), "trending": queries(report.Trending)} {
+		if len(got) != len(expected[name]) || got[0] != expected[name][0] || got[1] != expected[name][1] {
+			t.Errorf("%s %v, expected %v", name, got, expected[name])
+		}
+	}
+	if report.Top[0].AvgResults != 50 || report.Top[1].Change() != 500 {
+		t.Errorf("top %+v", report.Top)
+	}
+}
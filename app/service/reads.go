@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ReadRetention is how long the read state of items is remembered.
+const ReadRetention = 30 * 24 * time.Hour
+
+// reads holds the items a user opened during one day. Keeping a document
+// per user and day bounds the state to ReadRetention days per user, and the
+// ttl index drops old days.
+type reads struct {
+	Id      string               `bson:"_id"`
+	UserId  primitive.ObjectID   `bson:"userId"`
+	Items   []primitive.ObjectID `bson:"items"`
+	Expires time.Time            `bson:"expires"`
+}
+
+func readsId(userId primitive.ObjectID, day time.Time) string {
+	return userId.Hex() + ":" + day.UTC().Format("20060102")
+}
+
+// MarkRead records that the user opened the item.
+func (m *Mongo) MarkRead(userId primitive.ObjectID, id string) {
+	itemId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	c := mongoConn.Client.Database("news").Collection("reads")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.UpdateOne(ctx,
+		M{"_id": readsId(userId, now)},
+		M{
+			"$addToSet":    M{"items": itemId},
+			"$setOnInsert": M{"userId": userId, "expires": now.Add(ReadRetention)},
+		},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Println("saving read state failed", err)
+	}
+}
+
+// ReadItems returns the items the user has opened during the retention.
+func (m *Mongo) ReadItems(userId primitive.ObjectID) map[primitive.ObjectID]bool {
+	result := map[primitive.ObjectID]bool{}
+	c := mongoConn.Client.Database("news").Collection("reads")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{"userId": userId, "expires": M{"$gt": time.Now()}})
+	if err != nil {
+		log.Println("finding read items failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		day := reads{}
+		if err := cursor.Decode(&day); err != nil {
+			log.Println(err)
+			continue
+		}
+		for _, id := range day.Items {
+			result[id] = true
+		}
+	}
+	return result
+}
+
+// excludeItems leaves the given items out of a query.
+func excludeItems(query M, exclude []primitive.ObjectID) M {
+	if len(exclude) == 0 {
+		return query
+	}
+	result := M{}
+	for k, v := range query {
+		result[k] = v
+	}
+	result["_id"] = M{"$nin": exclude}
+	return result
+}
+
+func (m *Mongo) createReadIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("reads")
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
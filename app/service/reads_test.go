@@ -0,0 +1,37 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestExcludeItems tests that read items are left out without changing the original query
+func TestExcludeItems(t *testing.T) {
+	query := M{"language": 1}
+	if got := excludeItems(query, nil); !reflect.DeepEqual(got, query) {
+		t.Errorf("Without read items expected the query unchanged, got %v", got)
+	}
+	ids := []primitive.ObjectID{primitive.NewObjectID()}
+	got := excludeItems(query, ids)
+	if !reflect.DeepEqual(got["_id"], M{"$nin": ids}) || got["language"] != 1 {
+		t.Errorf("Expected read items excluded, got %v", got)
+	}
+	if _, ok := query["_id"]; ok {
+		t.Error("The original query should not be modified")
+	}
+}
+
+// TestReadsId tests that read state is kept in one document per user and day
+func TestReadsId(t *testing.T) {
+	userId := primitive.NewObjectID()
+	morning := time.Date(2026, 3, 1, 1, 0, 0, 0, time.UTC)
+	if readsId(userId, morning) != readsId(userId, morning.Add(20*time.Hour)) {
+		t.Error("Reads of the same day should share a document")
+	}
+	if readsId(userId, morning) == readsId(userId, morning.Add(24*time.Hour)) {
+		t.Error("Reads of different days should have their own documents")
+	}
+}
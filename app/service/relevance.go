@@ -0,0 +1,101 @@
+package service
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Search result orders.
+const (
+	SortDate      = "date"
+	SortRelevance = "relevance"
+)
+
+const (
+	// relevanceCandidates is how many of the newest matches are ranked.
+	relevanceCandidates = 1000
+	// recencyHalfLife is the age at which the recency boost halves. A new
+	// item scores double its text score.
+	recencyHalfLife = 24 * time.Hour
+)
+
+// Relevance combines the text score of an item with a boost for new items.
+func Relevance(score float64, age time.Duration) float64 {
+	if age < 0 {
+		age = 0
+	}
+	return score * (1 + math.Exp2(-float64(age)/float64(recencyHalfLife)))
+}
+
+// rank orders items in lang by relevance to node, keeping the order of
+// equals.
+func rank(node query.Node, lang string, items []domain.RSS, now time.Time) {
+	scores := make([]float64, len(items))
+	for i, item := range items {
+		scores[i] = Relevance(query.Score(node, lang, item.RssTitle), now.Sub(item.PubDate))
+	}
+	order := make([]int, len(items))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	ranked := make([]domain.RSS, len(items))
+	for i, o := range order {
+		ranked[i] = items[o]
+	}
+	copy(items, ranked)
+}
+
+// highlight marks the matches of node in the titles of items in lang.
+func highlight(node query.Node, lang string, items []domain.RSS) {
+	for i := range items {
+		items[i].Highlight = query.Highlight(node, lang, items[i].RssTitle)
+	}
+}
+
+// relevant returns count items from skip on of the newest items matching
+// filter, ranked by relevance to node in lang.
+func relevant(node query.Node, lang string, filter M, skip int, count int) ([]domain.RSS, error) {
+	result := []domain.RSS{}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	opts := options.Find().SetSort(bson.D{{Key: "pubDate", Value: -1}}).SetLimit(relevanceCandidates)
+	cursor, err := c.Find(ctx, filter, opts)
+	if err != nil {
+		return result, err
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		return result, err
+	}
+	rank(node, lang, result, time.Now())
+	if skip >= len(result) {
+		return []domain.RSS{}, nil
+	}
+	return result[skip:min(skip+count, len(result))], nil
+}
+
+// node returns the parsed search terms of the filter, nil without any.
+func (f ItemFilter) node() query.Node {
+	node, _ := query.Parse(f.Query)
+	return node
+}
+
+// ranked returns the first page of the items matching filter by relevance.
+func (f ItemFilter) ranked(filter M) ([]domain.RSS, error) {
+	node := f.node()
+	if node == nil {
+		return []domain.RSS{}, nil
+	}
+	items, err := relevant(node, f.Lang, filter, 0, f.Limit)
+	highlight(node, f.Lang, items)
+	return items, err
+}
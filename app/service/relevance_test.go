@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+)
+
+// TestRank tests ordering by text score boosted by recency
+func TestRank(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	node, err := query.Parse(`korko OR "euroopan keskuspankki"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []domain.RSS{
+		{RssTitle: "Korko nousi", PubDate: now.Add(-time.Hour)},
+		{RssTitle: "Euroopan keskuspankki nosti korkoa", PubDate: now.Add(-2 * time.Hour)},
+		{RssTitle: "Euroopan keskuspankki kokoontui", PubDate: now.Add(-30 * 24 * time.Hour)},
+		{RssTitle: "Euroopan keskuspankki ja korko", PubDate: now.Add(-3 * time.Hour)},
+	}
+	rank(node, "fi", items, now)
+	expected := []time.Duration{2 * time.Hour, 3 * time.Hour, time.Hour, 30 * 24 * time.Hour}
+	for i, item := range items {
+		if now.Sub(item.PubDate) != expected[i] {
+			t.Errorf("Position %d: expected the item from %v ago, got %q from %v ago", i, expected[i], item.RssTitle, now.Sub(item.PubDate))
+		}
+	}
+
+	if Relevance(1, 0) != 2 || Relevance(1, recencyHalfLife) != 1.5 || Relevance(0, 0) != 0 {
+		t.Error("A new item should score double and the boost should halve in a half life")
+	}
+	if Relevance(1, -time.Hour) != 2 {
+		t.Error("Items from the future should not get more than the full boost")
+	}
+}
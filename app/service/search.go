@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"github.com/jelinden/newsfeedreader/app/util"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// FacetValues is how many of the most common categories and sources
+	// are counted.
+	FacetValues = 10
+	// FacetDays is how many of the latest days are counted.
+	FacetDays = 14
+	// DayFormat is the format of the day facet.
+	DayFormat = "2006-01-02"
+)
+
+// Searcher finds the items of the search page. Mongo searches the news
+// collection and the index package an inverted index of it.
+type Searcher interface {
+	Search(req SearchRequest) (SearchResult, error)
+}
+
+// SearchRequest is a search of the search page.
+type SearchRequest struct {
+	Query   string
+	Lang    string
+	Order   string
+	Page    int
+	Count   int
+	Exclude []primitive.ObjectID
+	// Category, Source and Day narrow the results to a value of each
+	// facet, an empty value or a zero day to all of them.
+	Category string
+	Source   string
+	Day      time.Time
+	// Facets asks for the facets of the results too.
+	Facets bool
+}
+
+// SearchResult is a page of search results with the number and the facets
+// of all of them. Estimated tells that Total is an estimate.
+type SearchResult struct {
+	Items     []domain.RSS
+	Total     int
+	Estimated bool
+	Facets    domain.Facets
+}
+
+// Node returns the query with the facet filters, nil without search terms.
+// Parse errors are returned as *query.Error.
+func (req SearchRequest) Node() (query.Node, error) {
+	node, err := query.Parse(req.Query)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	and := query.And{node}
+	if req.Category != "" {
+		and = append(and, query.Field{Name: "category", Value: req.Category})
+	}
+	if req.Source != "" {
+		and = append(and, query.Field{Name: "source", Value: req.Source})
+	}
+	if !req.Day.IsZero() {
+		next := req.Day.AddDate(0, 0, 1)
+		and = append(and,
+			query.Field{Name: "after", Value: req.Day.Format(DayFormat), Date: req.Day},
+			query.Field{Name: "before", Value: next.Format(DayFormat), Date: next})
+	}
+	if len(and) == 1 {
+		return node, nil
+	}
+	return and, nil
+}
+
+// Search returns a page of the items a query of the search language finds,
+// newest first or by relevance, with the matches highlighted, and the
+// number and the facets of all the items found. Parse errors are returned
+// as *query.Error.
+func (m *Mongo) Search(req SearchRequest) (SearchResult, error) {
+	result := SearchResult{Items: []domain.RSS{}}
+	node, err := req.Node()
+	if err != nil || node == nil {
+		return result, err
+	}
+	filter := excludeItems(M{"language": req.Lang, "$and": []M{M(node.Filter(req.Lang))}}, req.Exclude)
+
+	result.Total, result.Estimated = countItems(filter)
+	if req.Order == SortRelevance {
+		if result.Items, err = relevant(node, req.Lang, filter, req.Page*req.Count, req.Count); err != nil {
+			log.Println("search failed", err)
+		}
+		// only the newest matches are ranked, the rest cannot be paged to
+		if result.Total > relevanceCandidates {
+			result.Total, result.Estimated = relevanceCandidates, false
+		}
+	} else {
+		result.Items = searchByDate(filter, req.Page, req.Count)
+	}
+	highlight(node, req.Lang, result.Items)
+	if req.Facets {
+		result.Facets = facets(filter, req.Lang)
+	}
+
+	if req.Lang == "en" {
+		result.Items = util.AddCategoryEnNames(result.Items)
+	}
+	return result, nil
+}
+
+func searchByDate(filter M, from int, count int) []domain.RSS {
+	result := []domain.RSS{}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+
+	limit := int64(count)
+	skip := int64(from * count)
+	findOptions := options.FindOptions{
+		Limit: &limit,
+		Sort:  bson.D{{Key: "pubDate", Value: -1}},
+		Skip:  &skip,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := c.Find(ctx, filter, &findOptions)
+	if err != nil {
+		log.Println("search failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+type facetCount struct {
+	Value string `bson:"_id"`
+	Count int    `bson:"count"`
+}
+
+// facets counts the items matching filter by category, source and day in
+// one aggregation.
+func facets(filter M, lang string) domain.Facets {
+	top := func(field string) []M {
+		return []M{
+			{"$group": M{"_id": field, "count": M{"$sum": 1}}},
+			{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+			{"$limit": FacetValues},
+		}
+	}
+	day := M{"$dateToString": M{"format": "%Y-%m-%d", "date": "$pubDate", "timezone": timezone(time.Now())}}
+	pipeline := []M{
+		{"$match": filter},
+		{"$facet": M{
+			"categories": top("$category.categoryName"),
+			"sources":    top("$rssSource"),
+			"days": []M{
+				{"$group": M{"_id": day, "count": M{"$sum": 1}}},
+				{"$sort": M{"_id": -1}},
+				{"$limit": FacetDays},
+			},
+		}},
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result := domain.Facets{}
+	cursor, err := c.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println("counting facets failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	counts := struct {
+		Categories []facetCount `bson:"categories"`
+		Sources    []facetCount `bson:"sources"`
+		Days       []facetCount `bson:"days"`
+	}{}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&counts); err != nil {
+			log.Println("counting facets failed", err)
+		}
+	}
+	result.Categories = facetValues(counts.Categories)
+	result.Sources = facetValues(counts.Sources)
+	result.Days = facetValues(counts.Days)
+	labelCategories(result, lang)
+	return result
+}
+
+// labelCategories gives the categories their English names in English.
+func labelCategories(f domain.Facets, lang string) {
+	if lang == "en" {
+		for i := range f.Categories {
+			f.Categories[i].Label = util.EnCategoryName(f.Categories[i].Value)
+		}
+	}
+}
+
+func facetValues(counts []facetCount) []domain.FacetValue {
+	result := []domain.FacetValue{}
+	for _, c := range counts {
+		if c.Value != "" {
+			result = append(result, domain.FacetValue{Value: c.Value, Count: c.Count})
+		}
+	}
+	return result
+}
+
+// CountedFacets returns facets counted elsewhere than in Mongo the way
+// Mongo searches return them.
+func CountedFacets(categories map[string]int, sources map[string]int, days map[string]int, lang string) domain.Facets {
+	result := domain.Facets{
+		Categories: topFacetValues(categories, false, FacetValues),
+		Sources:    topFacetValues(sources, false, FacetValues),
+		Days:       topFacetValues(days, true, FacetDays),
+	}
+	labelCategories(result, lang)
+	return result
+}
+
+// topFacetValues returns the values of counts, the days newest first and
+// the others most common first, at most limit of them.
+func topFacetValues(counts map[string]int, days bool, limit int) []domain.FacetValue {
+	result := []domain.FacetValue{}
+	for value, count := range counts {
+		if value != "" {
+			result = append(result, domain.FacetValue{Value: value, Count: count})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if days {
+			return result[i].Value > result[j].Value
+		}
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+	return result[:min(limit, len(result))]
+}
+
+// timezone returns the local time zone in a form Mongo accepts, its name
+// or else its offset at t.
+func timezone(t time.Time) string {
+	if name := time.Local.String(); name != "Local" {
+		return name
+	}
+	return t.Format("-07:00")
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+)
+
+// TestSearchRequestNode tests combining the query with the facet filters
+func TestSearchRequestNode(t *testing.T) {
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		req      SearchRequest
+		expected string
+	}{
+		{SearchRequest{Query: "korko"}, "korko"},
+		{SearchRequest{Query: "korko OR laina", Category: "Talous", Source: "Yle"}, "(korko OR laina) category:Talous source:Yle"},
+		{SearchRequest{Query: "korko", Day: day}, "korko after:2026-03-01 before:2026-03-02"},
+		{SearchRequest{Category: "Talous"}, ""},
+	}
+	for _, test := range tests {
+		node, err := test.req.Node()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if node != nil {
+			got = node.String()
+		}
+		if got != test.expected {
+			t.Errorf("Expected %q, got %q", test.expected, got)
+		}
+	}
+}
+
+// TestCountedFacets tests ordering and limiting facet values
+func TestCountedFacets(t *testing.T) {
+	sources := map[string]int{"": 4}
+	for i := 0; i < FacetValues+5; i++ {
+		sources[string(rune('A'+i))] = i % 3
+	}
+	facets := CountedFacets(
+		map[string]int{"Talous": 2, "Kotimaa": 5, "Digi": 2},
+		sources,
+		map[string]int{"2026-03-01": 1, "2026-03-03": 1, "2026-03-02": 9},
+		"en")
+	expected := []domain.FacetValue{{Value: "Kotimaa", Label: "Domestic", Count: 5}, {Value: "Digi", Label: "Digital media", Count: 2}, {Value: "Talous", Label: "Economy", Count: 2}}
+	if !reflect.DeepEqual(facets.Categories, expected) {
+		t.Errorf("Expected categories %v, got %v", expected, facets.Categories)
+	}
+	if len(facets.Sources) != FacetValues || facets.Sources[0].Value != "C" || facets.Sources[0].Count != 2 {
+		t.Errorf("Expected the %d most common sources, got %v", FacetValues, facets.Sources)
+	}
+	if facets.Days[0].Value != "2026-03-03" || facets.Days[2].Value != "2026-03-01" {
+		t.Errorf("Expected the days newest first, got %v", facets.Days)
+	}
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/query"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MaxSavedSearches is how many searches a user can save.
+const MaxSavedSearches = 20
+
+var ErrTooManySearches = errors.New("too many saved searches")
+
+func (m *Mongo) SaveSearch(userId primitive.ObjectID, name string, query string, lang string) (*domain.SavedSearch, error) {
+	c := mongoConn.Client.Database("news").Collection("savedsearches")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := c.CountDocuments(ctx, M{"userId": userId})
+	if err != nil {
+		return nil, err
+	}
+	if count >= MaxSavedSearches {
+		return nil, ErrTooManySearches
+	}
+	search := &domain.SavedSearch{
+		Id:      primitive.NewObjectID(),
+		UserId:  userId,
+		Name:    name,
+		Query:   query,
+		Lang:    lang,
+		Created: time.Now(),
+	}
+	if _, err := c.InsertOne(ctx, search); err != nil {
+		return nil, err
+	}
+	return search, nil
+}
+
+// SavedSearches returns the searches of a user, or of all users with a nil id.
+func (m *Mongo) SavedSearches(userId primitive.ObjectID) []domain.SavedSearch {
+	result := []domain.SavedSearch{}
+	query := M{}
+	if !userId.IsZero() {
+		query["userId"] = userId
+	}
+	c := mongoConn.Client.Database("news").Collection("savedsearches")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "created", Value: 1}}))
+	if err != nil {
+		log.Println("finding saved searches failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// FindSavedSearch returns a search of the user, or nil.
+func (m *Mongo) FindSavedSearch(userId primitive.ObjectID, id string) *domain.SavedSearch {
+	searchId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	c := mongoConn.Client.Database("news").Collection("savedsearches")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	search := &domain.SavedSearch{}
+	if err := c.FindOne(ctx, M{"_id": searchId, "userId": userId}).Decode(search); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("finding saved search failed", err)
+		}
+		return nil
+	}
+	return search
+}
+
+func (m *Mongo) DeleteSavedSearch(userId primitive.ObjectID, id string) error {
+	searchId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := mongoConn.Client.Database("news").Collection("savedsearches")
+	if _, err := c.DeleteOne(ctx, M{"_id": searchId, "userId": userId}); err != nil {
+		return err
+	}
+	queue := mongoConn.Client.Database("news").Collection("alertqueue")
+	_, err = queue.DeleteMany(ctx, M{"searchId": searchId, "userId": userId})
+	return err
+}
+
+// MarkSavedSearchRead zeroes the unread count when the user opens the search.
+func (m *Mongo) MarkSavedSearchRead(userId primitive.ObjectID, id string) {
+	searchId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return
+	}
+	c := mongoConn.Client.Database("news").Collection("savedsearches")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.UpdateOne(ctx, M{"_id": searchId, "userId": userId}, M{"$set": M{"unread": 0}}); err != nil {
+		log.Println("marking saved search read failed", err)
+	}
+}
+
+// searchFilter compiles a query of the search language to a filter on
+// items of lang. An empty query gives a nil filter.
+func searchFilter(searchString string, lang string) (M, error) {
+	node, err := query.Parse(searchString)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	return M(node.Filter(lang)), nil
+}
+
+// MatchItems returns the items among ids that the search query finds, using
+// the same query language as the search page.
+func (m *Mongo) MatchItems(searchString string, lang string, ids []primitive.ObjectID) []domain.RSS {
+	result := []domain.RSS{}
+	filter, err := searchFilter(searchString, lang)
+	if err != nil || filter == nil {
+		log.Println("invalid saved search", searchString, err)
+		return result
+	}
+	c := mongoConn.Client.Database("news").Collection("newscollection")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	query := M{"_id": M{"$in": ids}, "language": lang, "$and": []M{filter}}
+	cursor, err := c.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "pubDate", Value: -1}}))
+	if err != nil {
+		log.Println("matching saved search failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// QueueAlerts adds matched items to the alert queue of the search's owner
+// and to the unread count of the search.
+func (m *Mongo) QueueAlerts(search domain.SavedSearch, items []domain.RSS) error {
+	if len(items) == 0 {
+		return nil
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		docs = append(docs, domain.AlertItem{
+			Id:         primitive.NewObjectID(),
+			UserId:     search.UserId,
+			SearchId:   search.Id,
+			SearchName: search.Name,
+			ItemId:     item.Id,
+			Title:      item.RssTitle,
+			Link:       item.RssLink,
+			Source:     item.RssSource,
+			PubDate:    item.PubDate,
+			Created:    now,
+		})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	searches := mongoConn.Client.Database("news").Collection("savedsearches")
+	if _, err := searches.UpdateOne(ctx, M{"_id": search.Id}, M{"$inc": M{"unread": len(items)}}); err != nil {
+		return err
+	}
+	queue := mongoConn.Client.Database("news").Collection("alertqueue")
+	_, err := queue.InsertMany(ctx, docs)
+	return err
+}
+
+// PendingAlerts returns the queued alert items grouped by user.
+func (m *Mongo) PendingAlerts() map[primitive.ObjectID][]domain.AlertItem {
+	result := map[primitive.ObjectID][]domain.AlertItem{}
+	c := mongoConn.Client.Database("news").Collection("alertqueue")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{}, options.Find().SetSort(bson.D{{Key: "pubDate", Value: -1}}))
+	if err != nil {
+		log.Println("finding pending alerts failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		item := domain.AlertItem{}
+		if err := cursor.Decode(&item); err != nil {
+			log.Println(err)
+			continue
+		}
+		result[item.UserId] = append(result[item.UserId], item)
+	}
+	return result
+}
+
+// AlertsSent removes sent items from the queue and remembers when the user
+// last got alerts, clearing the failures of earlier sends.
+func (m *Mongo) AlertsSent(userId primitive.ObjectID, items []domain.AlertItem, sent time.Time) error {
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.Id)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	queue := mongoConn.Client.Database("news").Collection("alertqueue")
+	if _, err := queue.DeleteMany(ctx, M{"_id": M{"$in": ids}}); err != nil {
+		return err
+	}
+	if sent.IsZero() {
+		return nil
+	}
+	users := mongoConn.Client.Database("news").Collection("users")
+	_, err := users.UpdateOne(ctx, M{"_id": userId}, M{
+		"$set":   M{"alerts.lastSent": sent},
+		"$unset": M{"alerts.failures": "", "alerts.retryAt": ""},
+	})
+	return err
+}
+
+// AlertsFailed remembers how many sends of the alerts of a user have failed
+// in a row and when to try again.
+func (m *Mongo) AlertsFailed(userId primitive.ObjectID, failures int, retryAt time.Time) error {
+	users := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := users.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{
+		"alerts.failures": failures,
+		"alerts.retryAt":  retryAt,
+	}})
+	return err
+}
+
+func (m *Mongo) SaveAlertSettings(userId primitive.ObjectID, settings domain.AlertSettings) error {
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{
+		"alerts.frequency":  settings.Frequency,
+		"alerts.channel":    settings.Channel,
+		"alerts.webhookUrl": settings.WebhookURL,
+	}, "$unset": M{"alerts.failures": "", "alerts.retryAt": ""}})
+	return err
+}
+
+func (m *Mongo) createSearchIndexes(ctx context.Context) error {
+	searches := mongoConn.Client.Database("news").Collection("savedsearches")
+	if _, err := searches.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "userId", Value: 1}, {Key: "created", Value: 1}},
+	}); err != nil {
+		return err
+	}
+	queue := mongoConn.Client.Database("news").Collection("alertqueue")
+	_, err := queue.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "searchId", Value: 1}}},
+	})
+	return err
+}
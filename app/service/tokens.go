@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Purposes of user tokens. A token is only accepted for its own purpose.
+const (
+	TokenVerifyEmail   = "verify"
+	TokenResetPassword = "reset"
+	TokenUnsubscribe   = "unsubscribe"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// userToken is stored by the hash of the token, so that a leaked database
+// does not contain usable links.
+type userToken struct {
+	Id      string             `bson:"_id"`
+	UserId  primitive.ObjectID `bson:"userId"`
+	Purpose string             `bson:"purpose"`
+	Created time.Time          `bson:"created"`
+	Expires time.Time          `bson:"expires"`
+	Used    *time.Time         `bson:"used"`
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUserToken returns a new single use token for the user, valid for ttl.
+func (m *Mongo) CreateUserToken(userId primitive.ObjectID, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	now := time.Now()
+	c := mongoConn.Client.Database("news").Collection("usertokens")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.InsertOne(ctx, userToken{
+		Id:      hashToken(token),
+		UserId:  userId,
+		Purpose: purpose,
+		Created: now,
+		Expires: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken marks an unused and unexpired token as used and returns
+// its user. A token can be consumed only once.
+func (m *Mongo) ConsumeUserToken(token string, purpose string) (primitive.ObjectID, error) {
+	c := mongoConn.Client.Database("news").Collection("usertokens")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	now := time.Now()
+	t := userToken{}
+	err := c.FindOneAndUpdate(ctx,
+		M{"_id": hashToken(token), "purpose": purpose, "used": nil, "expires": M{"$gt": now}},
+		M{"$set": M{"used": now}},
+	).Decode(&t)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrInvalidToken
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return t.UserId, nil
+}
+
+func (m *Mongo) createTokenIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("usertokens")
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
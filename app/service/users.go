@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const SessionTTL = 30 * 24 * time.Hour
+
+var ErrEmailTaken = errors.New("email already registered")
+
+// MaxPasswordLength is the most bytes of a password bcrypt hashes.
+const MaxPasswordLength = 72
+
+// ErrPasswordTooLong is returned for passwords over MaxPasswordLength.
+var ErrPasswordTooLong = bcrypt.ErrPasswordTooLong
+
+// dummyHash is compared against when no user is found, so that a login
+// with an unknown email takes as long as one with a wrong password.
+var (
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+type session struct {
+	Id      string             `bson:"_id"`
+	UserId  primitive.ObjectID `bson:"userId"`
+	Created time.Time          `bson:"created"`
+	Expires time.Time          `bson:"expires"`
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func (m *Mongo) CreateUser(name string, email string, password string, lang string) (*domain.User, error) {
+	if len(password) > MaxPasswordLength {
+		return nil, ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	user := &domain.User{
+		Id:           primitive.NewObjectID(),
+		Email:        normalizeEmail(email),
+		Name:         strings.TrimSpace(name),
+		PasswordHash: string(hash),
+		Lang:         lang,
+		Created:      time.Now(),
+	}
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// CreateLinkedUser creates a user without a password who logs in with the
+// identity. The provider has verified the email address.
+func (m *Mongo) CreateLinkedUser(name string, email string, lang string, identity domain.Identity) (*domain.User, error) {
+	user := &domain.User{
+		Id:            primitive.NewObjectID(),
+		Email:         normalizeEmail(email),
+		EmailVerified: true,
+		Name:          strings.TrimSpace(name),
+		Lang:          lang,
+		Created:       time.Now(),
+		Identities:    []domain.Identity{identity},
+	}
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, user); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrEmailTaken
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+func (m *Mongo) FindUser(id primitive.ObjectID) *domain.User {
+	return m.findUser(M{"_id": id})
+}
+
+func (m *Mongo) FindUserByEmail(email string) *domain.User {
+	return m.findUser(M{"email": normalizeEmail(email)})
+}
+
+func (m *Mongo) FindUserByIdentity(provider string, subject string) *domain.User {
+	return m.findUser(M{"identities": M{"$elemMatch": M{"provider": provider, "subject": subject}}})
+}
+
+// LinkIdentity lets the user log in with the identity, whose provider has
+// verified the email address of the user. If the user had not verified
+// the address, the password was set by someone who never proved owning
+// it, so the password and the sessions are removed.
+func (m *Mongo) LinkIdentity(user *domain.User, identity domain.Identity) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	update := M{
+		"$push": M{"identities": identity},
+		"$set":  M{"emailVerified": true},
+	}
+	if !user.EmailVerified {
+		update["$unset"] = M{"passwordHash": ""}
+		sessions := mongoConn.Client.Database("news").Collection("sessions")
+		if _, err := sessions.DeleteMany(ctx, M{"userId": user.Id}); err != nil {
+			return err
+		}
+	}
+	users := mongoConn.Client.Database("news").Collection("users")
+	_, err := users.UpdateOne(ctx, M{"_id": user.Id}, update)
+	return err
+}
+
+func (m *Mongo) findUser(query M) *domain.User {
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	user := &domain.User{}
+	if err := c.FindOne(ctx, query).Decode(user); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("finding user failed", err)
+		}
+		return nil
+	}
+	return user
+}
+
+// Authenticate returns the user with email if password matches.
+func (m *Mongo) Authenticate(email string, password string) *domain.User {
+	user := m.FindUserByEmail(email)
+	if user == nil || user.PasswordHash == "" {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+		})
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return nil
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil
+	}
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.UpdateOne(ctx, M{"_id": user.Id}, M{"$set": M{"lastLogin": time.Now()}}); err != nil {
+		log.Println("saving last login failed", err)
+	}
+	return user
+}
+
+// CreateSession starts a session for the user and returns its token.
+func (m *Mongo) CreateSession(userId primitive.ObjectID) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	s := session{
+		Id:      base64.RawURLEncoding.EncodeToString(b),
+		UserId:  userId,
+		Created: time.Now(),
+		Expires: time.Now().Add(SessionTTL),
+	}
+	c := mongoConn.Client.Database("news").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, s); err != nil {
+		return "", err
+	}
+	return s.Id, nil
+}
+
+// FindSession returns the user of an unexpired session.
+func (m *Mongo) FindSession(token string) *domain.User {
+	c := mongoConn.Client.Database("news").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s := session{}
+	err := c.FindOne(ctx, M{"_id": token, "expires": M{"$gt": time.Now()}}).Decode(&s)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("finding session failed", err)
+		}
+		return nil
+	}
+	return m.FindUser(s.UserId)
+}
+
+func (m *Mongo) DeleteSession(token string) {
+	c := mongoConn.Client.Database("news").Collection("sessions")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.DeleteOne(ctx, M{"_id": token}); err != nil {
+		log.Println("deleting session failed", err)
+	}
+}
+
+// VerifyEmail marks the email address of the user as confirmed.
+func (m *Mongo) VerifyEmail(userId primitive.ObjectID) error {
+	c := mongoConn.Client.Database("news").Collection("users")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := c.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{"emailVerified": true}})
+	return err
+}
+
+// SetPassword changes the password of the user and ends all sessions.
+func (m *Mongo) SetPassword(userId primitive.ObjectID, password string) error {
+	if len(password) > MaxPasswordLength {
+		return ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	users := mongoConn.Client.Database("news").Collection("users")
+	if _, err := users.UpdateOne(ctx, M{"_id": userId}, M{"$set": M{"passwordHash": string(hash)}}); err != nil {
+		return err
+	}
+	sessions := mongoConn.Client.Database("news").Collection("sessions")
+	_, err = sessions.DeleteMany(ctx, M{"userId": userId})
+	return err
+}
+
+func (m *Mongo) createUserIndexes(ctx context.Context) error {
+	users := mongoConn.Client.Database("news").Collection("users")
+	_, err := users.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{
+			Keys:    bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+			Options: options.Index().SetUnique(true).SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	sessions := mongoConn.Client.Database("news").Collection("sessions")
+	_, err = sessions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "userId", Value: 1}}},
+		{Keys: bson.D{{Key: "expires", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		return err
+	}
+	return m.createTokenIndexes(ctx)
+}
@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"log"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeliveryRetention is how long webhook deliveries, dead ones included,
+// are kept in the delivery log.
+const DeliveryRetention = 30 * 24 * time.Hour
+
+const webhookSecretPrefix = "whsec_"
+
+// CreateWebhook stores the webhook with a new signing secret.
+func (m *Mongo) CreateWebhook(hook domain.Webhook) (*domain.Webhook, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	hook.Id = primitive.NewObjectID()
+	hook.Secret = webhookSecretPrefix + base64.RawURLEncoding.EncodeToString(b)
+	hook.Created = time.Now()
+	c := mongoConn.Client.Database("news").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.InsertOne(ctx, hook); err != nil {
+		return nil, err
+	}
+	return &hook, nil
+}
+
+func (m *Mongo) ListWebhooks() []domain.Webhook {
+	result := []domain.Webhook{}
+	c := mongoConn.Client.Database("news").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, M{}, options.Find().SetSort(bson.D{{Key: "created", Value: -1}}))
+	if err != nil {
+		log.Println("finding webhooks failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+func (m *Mongo) FindWebhook(id string) *domain.Webhook {
+	hookId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil
+	}
+	c := mongoConn.Client.Database("news").Collection("webhooks")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hook := &domain.Webhook{}
+	if err := c.FindOne(ctx, M{"_id": hookId}).Decode(hook); err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println("finding webhook failed", err)
+		}
+		return nil
+	}
+	return hook
+}
+
+// DeleteWebhook removes the webhook and its pending deliveries. The
+// delivery log of the webhook is left to expire.
+func (m *Mongo) DeleteWebhook(id string) error {
+	hookId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	hooks := mongoConn.Client.Database("news").Collection("webhooks")
+	if _, err := hooks.DeleteOne(ctx, M{"_id": hookId}); err != nil {
+		return err
+	}
+	deliveries := mongoConn.Client.Database("news").Collection("webhookdeliveries")
+	_, err = deliveries.DeleteMany(ctx, M{"webhookId": hookId, "status": domain.DeliveryPending})
+	return err
+}
+
+// SaveDelivery inserts a new delivery or saves the outcome of an attempt.
+func (m *Mongo) SaveDelivery(delivery *domain.WebhookDelivery) error {
+	c := mongoConn.Client.Database("news").Collection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if delivery.Id.IsZero() {
+		delivery.Id = primitive.NewObjectID()
+	}
+	_, err := c.ReplaceOne(ctx, M{"_id": delivery.Id}, delivery, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DueDeliveries returns pending deliveries whose next attempt is due.
+func (m *Mongo) DueDeliveries(now time.Time, limit int) []domain.WebhookDelivery {
+	return m.findDeliveries(
+		M{"status": domain.DeliveryPending, "nextAttempt": M{"$lte": now}},
+		options.Find().SetSort(bson.D{{Key: "nextAttempt", Value: 1}}).SetLimit(int64(limit)),
+	)
+}
+
+// WebhookDeliveries returns the latest deliveries in a status, or in any
+// status when it is empty.
+func (m *Mongo) WebhookDeliveries(status string, limit int) []domain.WebhookDelivery {
+	query := M{}
+	if status != "" {
+		query["status"] = status
+	}
+	return m.findDeliveries(query, options.Find().SetSort(bson.D{{Key: "created", Value: -1}}).SetLimit(int64(limit)))
+}
+
+func (m *Mongo) findDeliveries(query M, findOptions *options.FindOptions) []domain.WebhookDelivery {
+	result := []domain.WebhookDelivery{}
+	c := mongoConn.Client.Database("news").Collection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := c.Find(ctx, query, findOptions)
+	if err != nil {
+		log.Println("finding webhook deliveries failed", err)
+		return result
+	}
+	defer cursor.Close(ctx)
+	if err := cursor.All(ctx, &result); err != nil {
+		log.Println(err)
+	}
+	return result
+}
+
+// RetryDelivery moves a dead delivery back to the queue with new attempts.
+func (m *Mongo) RetryDelivery(id string) error {
+	deliveryId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+	c := mongoConn.Client.Database("news").Collection("webhookdeliveries")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c.UpdateOne(ctx,
+		M{"_id": deliveryId, "status": domain.DeliveryDead},
+		M{"$set": M{"status": domain.DeliveryPending, "attempts": 0, "nextAttempt": time.Now()}},
+	)
+	return err
+}
+
+func (m *Mongo) createWebhookIndexes(ctx context.Context) error {
+	c := mongoConn.Client.Database("news").Collection("webhookdeliveries")
+	_, err := c.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "nextAttempt", Value: 1}}},
+		{Keys: bson.D{{Key: "created", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(int32(DeliveryRetention.Seconds()))},
+	})
+	return err
+}
@@ -0,0 +1,199 @@
+package socketio
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// engine.io packet types
+const (
+	packetOpen    = '0'
+	packetClose   = '1'
+	packetPing    = '2'
+	packetPong    = '3'
+	packetMessage = '4'
+	packetUpgrade = '5'
+	packetNoop    = '6'
+)
+
+// socket.io packet types
+const (
+	packetConnect      = '0'
+	packetDisconnect   = '1'
+	packetEvent        = '2'
+	packetConnectError = '4'
+)
+
+const recordSeparator = "\x1e"
+
+// encodePayload joins packets for a polling response. EIO=4 separates
+// packets with a record separator, EIO=3 prefixes each with its length
+// counted in UTF-16 code units like the JavaScript parser does.
+func encodePayload(eio int, packets []string) string {
+	if eio == 4 {
+		return strings.Join(packets, recordSeparator)
+	}
+	var buf strings.Builder
+	for _, p := range packets {
+		buf.WriteString(strconv.Itoa(utf16Len(p)))
+		buf.WriteByte(':')
+		buf.WriteString(p)
+	}
+	return buf.String()
+}
+
+// decodePayload splits a polling request body into packets. EIO=3 clients
+// may send either the text or the binary payload format.
+func decodePayload(eio int, body []byte) ([]string, error) {
+	if len(body) == 0 {
+		return nil, nil
+	}
+	if eio == 4 {
+		return strings.Split(string(body), recordSeparator), nil
+	}
+	if body[0] == 0 || body[0] == 1 {
+		return decodeBinaryPayload(body)
+	}
+	packets := []string{}
+	rest := string(body)
+	for rest != "" {
+		colon := strings.IndexByte(rest, ':')
+		if colon < 1 {
+			return nil, fmt.Errorf("invalid payload length")
+		}
+		n, err := strconv.Atoi(rest[:colon])
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload length %q", rest[:colon])
+		}
+		rest = rest[colon+1:]
+		end := byteOffset(rest, n)
+		if end < 0 {
+			return nil, fmt.Errorf("payload shorter than declared length %d", n)
+		}
+		packets = append(packets, rest[:end])
+		rest = rest[end:]
+	}
+	return packets, nil
+}
+
+func decodeBinaryPayload(body []byte) ([]string, error) {
+	packets := []string{}
+	for len(body) > 0 {
+		isString := body[0] == 0
+		end := bytes.IndexByte(body, 0xff)
+		if end < 2 {
+			return nil, fmt.Errorf("invalid binary payload")
+		}
+		n := 0
+		for _, d := range body[1:end] {
+			if d > 9 {
+				return nil, fmt.Errorf("invalid binary payload length")
+			}
+			n = n*10 + int(d)
+		}
+		body = body[end+1:]
+		if n > len(body) {
+			return nil, fmt.Errorf("binary payload shorter than declared length %d", n)
+		}
+		if isString {
+			packets = append(packets, string(body[:n]))
+		}
+		body = body[n:]
+	}
+	return packets, nil
+}
+
+func utf16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += len(utf16.Encode([]rune{r}))
+	}
+	return n
+}
+
+// byteOffset returns the byte offset in s after n UTF-16 code units,
+// or -1 if s is shorter than that.
+func byteOffset(s string, n int) int {
+	i := 0
+	for n > 0 {
+		if i >= len(s) {
+			return -1
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		n -= len(utf16.Encode([]rune{r}))
+		i += size
+	}
+	return i
+}
+
+// sioPacket is a decoded socket.io packet.
+type sioPacket struct {
+	Type      byte
+	Namespace string
+	Data      string
+}
+
+func decodeSioPacket(s string) (sioPacket, error) {
+	if s == "" {
+		return sioPacket{}, fmt.Errorf("empty socket.io packet")
+	}
+	p := sioPacket{Type: s[0], Namespace: "/"}
+	rest := s[1:]
+	if strings.HasPrefix(rest, "/") {
+		end := strings.IndexByte(rest, ',')
+		if end < 0 {
+			end = len(rest)
+		}
+		p.Namespace = rest[:end]
+		if q := strings.IndexByte(p.Namespace, '?'); q >= 0 {
+			p.Namespace = p.Namespace[:q]
+		}
+		if end < len(rest) {
+			end++
+		}
+		rest = rest[end:]
+	}
+	p.Data = rest
+	return p, nil
+}
+
+// encodeSioPacket returns the engine.io message carrying a socket.io packet.
+func encodeSioPacket(packetType byte, namespace string, data string) string {
+	var buf strings.Builder
+	buf.WriteByte(packetMessage)
+	buf.WriteByte(packetType)
+	if namespace != "/" {
+		buf.WriteString(namespace)
+		if data != "" {
+			buf.WriteByte(',')
+		}
+	}
+	buf.WriteString(data)
+	return buf.String()
+}
+
+// marshalASCII encodes v as JSON with every non-ASCII character escaped,
+// so that byte, character and UTF-16 lengths of the result agree. Old
+// clients count payload lengths in bytes and newer ones in code units.
+func marshalASCII(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	var buf strings.Builder
+	for _, r := range string(raw) {
+		if r < utf8.RuneSelf {
+			buf.WriteRune(r)
+			continue
+		}
+		for _, unit := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&buf, `\u%04x`, unit)
+		}
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,80 @@
+package socketio
+
+import (
+	"testing"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	packets := []string{"2", `42/fi,["message","ä"]`, "40/en"}
+	for _, eio := range []int{3, 4} {
+		decoded, err := decodePayload(eio, []byte(encodePayload(eio, packets)))
+		if err != nil {
+			t.Fatalf("EIO=%d decoding failed: %v", eio, err)
+		}
+		if len(decoded) != len(packets) {
+			t.Fatalf("EIO=%d expected %d packets, got %d", eio, len(packets), len(decoded))
+		}
+		for i := range packets {
+			if decoded[i] != packets[i] {
+				t.Errorf("EIO=%d packet %d: expected %q, got %q", eio, i, packets[i], decoded[i])
+			}
+		}
+	}
+}
+
+func TestDecodePayloadCountsUTF16(t *testing.T) {
+	// "ä" is one UTF-16 code unit but two bytes, "𝄞" is two code units
+	packets, err := decodePayload(3, []byte("2:4ä3:4𝄞1:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 3 || packets[0] != "4ä" || packets[1] != "4𝄞" || packets[2] != "2" {
+		t.Errorf("unexpected packets %q", packets)
+	}
+}
+
+func TestDecodeBinaryPayload(t *testing.T) {
+	body := []byte{0, 1, 0xff, '2', 0, 5, 0xff, '4', '0', '/', 'f', 'i'}
+	packets, err := decodePayload(3, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 2 || packets[0] != "2" || packets[1] != "40/fi" {
+		t.Errorf("unexpected packets %q", packets)
+	}
+}
+
+func TestDecodeSioPacket(t *testing.T) {
+	tests := []struct {
+		in        string
+		namespace string
+		data      string
+	}{
+		{"0", "/", ""},
+		{"0/fi", "/fi", ""},
+		{"0/fi,", "/fi", ""},
+		{"0/fi?token=abc", "/fi", ""},
+		{`0/en,{"token":"abc"}`, "/en", `{"token":"abc"}`},
+		{`2["message","x"]`, "/", `["message","x"]`},
+	}
+	for _, test := range tests {
+		p, err := decodeSioPacket(test.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Namespace != test.namespace || p.Data != test.data {
+			t.Errorf("%q: expected namespace %q data %q, got %q %q", test.in, test.namespace, test.data, p.Namespace, p.Data)
+		}
+	}
+}
+
+func TestMarshalASCII(t *testing.T) {
+	out, err := marshalASCII([]interface{}{"message", "Hyvää päivää 𝄞"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `["message","Hyv\u00e4\u00e4 p\u00e4iv\u00e4\u00e4 \ud834\udd1e"]`
+	if out != expected {
+		t.Errorf("expected %s, got %s", expected, out)
+	}
+}
@@ -0,0 +1,381 @@
+// Package socketio is a small broadcast-only socket.io server. It speaks
+// engine.io protocol 3 for the socket.io 1.x and 2.x clients and protocol 4
+// for socket.io 3.x and 4.x clients, over both polling and websocket.
+package socketio
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+const maxPayload = 1000000
+
+type Server struct {
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// OnConnect is called when a client joins a namespace, emit sends an
+	// event to that client only.
+	OnConnect  func(namespace string, emit func(event string, data interface{}))
+	mutex      sync.RWMutex
+	sessions   map[string]*session
+	namespaces map[string]bool
+}
+
+// engine.io error codes returned to clients with a 400 status
+var (
+	errTransportUnknown    = engineError{0, "Transport unknown"}
+	errSessionUnknown      = engineError{1, "Session ID unknown"}
+	errBadHandshakeMethod  = engineError{2, "Bad handshake method"}
+	errBadRequest          = engineError{3, "Bad request"}
+	errUnsupportedProtocol = engineError{5, "Unsupported protocol version"}
+)
+
+type engineError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func NewServer(namespaces ...string) *Server {
+	s := &Server{
+		PingInterval: 25 * time.Second,
+		PingTimeout:  20 * time.Second,
+		sessions:     make(map[string]*session),
+		namespaces:   map[string]bool{"/": true},
+	}
+	for _, ns := range namespaces {
+		s.namespaces[normalizeNamespace(ns)] = true
+	}
+	go s.heartbeat()
+	return s
+}
+
+func normalizeNamespace(ns string) string {
+	if ns == "" || ns[0] != '/' {
+		return "/" + ns
+	}
+	return ns
+}
+
+// BroadcastToNamespace emits event with data to every client connected
+// to the namespace.
+func (s *Server) BroadcastToNamespace(namespace string, event string, data interface{}) {
+	namespace = normalizeNamespace(namespace)
+	args, err := marshalASCII([]interface{}{event, data})
+	if err != nil {
+		log.Println("socket.io broadcast failed", err)
+		return
+	}
+	packet := encodeSioPacket(packetEvent, namespace, args)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, sess := range s.sessions {
+		if sess.joined(namespace) {
+			sess.send(packet)
+		}
+	}
+}
+
+// Count returns the number of open engine.io sessions.
+func (s *Server) Count() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.sessions)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	eio, err := strconv.Atoi(query.Get("EIO"))
+	if err != nil || (eio != 3 && eio != 4) {
+		writeError(w, errUnsupportedProtocol)
+		return
+	}
+	sid := query.Get("sid")
+	switch query.Get("transport") {
+	case "polling":
+		if sid == "" {
+			s.handshakePolling(w, r, eio)
+			return
+		}
+		sess := s.session(sid)
+		if sess == nil || sess.eio != eio {
+			writeError(w, errSessionUnknown)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			s.poll(w, r, sess)
+		case http.MethodPost:
+			s.receive(w, r, sess)
+		default:
+			writeError(w, errBadRequest)
+		}
+	case "websocket":
+		var sess *session
+		if sid != "" {
+			if sess = s.session(sid); sess == nil || sess.eio != eio {
+				writeError(w, errSessionUnknown)
+				return
+			}
+		}
+		websocket.Server{Handler: func(ws *websocket.Conn) {
+			s.serveWebsocket(ws, eio, sess)
+		}}.ServeHTTP(w, r)
+	default:
+		writeError(w, errTransportUnknown)
+	}
+}
+
+func (s *Server) handshakePolling(w http.ResponseWriter, r *http.Request, eio int) {
+	if r.Method != http.MethodGet {
+		writeError(w, errBadHandshakeMethod)
+		return
+	}
+	sess := s.open(eio)
+	writePayload(w, eio, sess.drain())
+}
+
+// open registers a new session and queues its open packet.
+func (s *Server) open(eio int) *session {
+	sess := newSession(newID(), eio)
+	handshake := map[string]interface{}{
+		"sid":          sess.id,
+		"upgrades":     []string{"websocket"},
+		"pingInterval": s.PingInterval.Milliseconds(),
+		"pingTimeout":  s.PingTimeout.Milliseconds(),
+	}
+	if eio == 4 {
+		handshake["maxPayload"] = maxPayload
+	}
+	data, _ := marshalASCII(handshake)
+	sess.send(string(packetOpen) + data)
+	if eio == 3 {
+		// socket.io 1.x and 2.x clients expect the default namespace to be
+		// connected by the server
+		sess.join("/")
+		sess.send(encodeSioPacket(packetConnect, "/", ""))
+	}
+	s.mutex.Lock()
+	s.sessions[sess.id] = sess
+	s.mutex.Unlock()
+	return sess
+}
+
+func (s *Server) session(sid string) *session {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.sessions[sid]
+}
+
+func (s *Server) remove(sess *session) {
+	sess.close()
+	s.mutex.Lock()
+	delete(s.sessions, sess.id)
+	s.mutex.Unlock()
+}
+
+func (s *Server) poll(w http.ResponseWriter, r *http.Request, sess *session) {
+	if !sess.startPoll() {
+		writeError(w, errBadRequest)
+		return
+	}
+	defer sess.endPoll()
+	packets := sess.wait(r.Context().Done())
+	if packets == nil {
+		select {
+		case <-sess.closed:
+			packets = []string{string(packetClose)}
+		default:
+			packets = []string{string(packetNoop)}
+		}
+	}
+	writePayload(w, sess.eio, packets)
+}
+
+func (s *Server) receive(w http.ResponseWriter, r *http.Request, sess *session) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPayload))
+	if err != nil {
+		writeError(w, errBadRequest)
+		return
+	}
+	packets, err := decodePayload(sess.eio, body)
+	if err != nil {
+		log.Println("socket.io payload decoding failed", err)
+		writeError(w, errBadRequest)
+		return
+	}
+	for _, p := range packets {
+		s.handlePacket(sess, p)
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte("ok"))
+}
+
+func (s *Server) serveWebsocket(ws *websocket.Conn, eio int, sess *session) {
+	defer ws.Close()
+	if sess == nil {
+		sess = s.open(eio)
+		sess.upgrade()
+	} else if !s.probe(ws, sess) {
+		return
+	}
+	defer s.remove(sess)
+	go s.writeWebsocket(ws, sess)
+	for {
+		var msg string
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return
+		}
+		if !s.handlePacket(sess, msg) {
+			return
+		}
+	}
+}
+
+// probe runs the upgrade handshake of a polling session over the websocket.
+func (s *Server) probe(ws *websocket.Conn, sess *session) bool {
+	for {
+		var msg string
+		ws.SetReadDeadline(time.Now().Add(s.PingTimeout))
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			return false
+		}
+		switch msg {
+		case string(packetPing) + "probe":
+			ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if websocket.Message.Send(ws, string(packetPong)+"probe") != nil {
+				return false
+			}
+			// release the pending poll so that the client can pause polling
+			sess.send(string(packetNoop))
+		case string(packetUpgrade):
+			ws.SetReadDeadline(time.Time{})
+			sess.touch()
+			return sess.upgrade()
+		default:
+			return false
+		}
+	}
+}
+
+func (s *Server) writeWebsocket(ws *websocket.Conn, sess *session) {
+	defer ws.Close()
+	for {
+		packets := sess.wait(nil)
+		if packets == nil {
+			return
+		}
+		for _, p := range packets {
+			ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := websocket.Message.Send(ws, p); err != nil {
+				sess.close()
+				return
+			}
+		}
+	}
+}
+
+// handlePacket processes one engine.io packet from a client and reports
+// whether the session is still open.
+func (s *Server) handlePacket(sess *session, packet string) bool {
+	if packet == "" {
+		return true
+	}
+	sess.touch()
+	switch packet[0] {
+	case packetClose:
+		s.remove(sess)
+		return false
+	case packetPing:
+		if sess.eio == 3 {
+			sess.send(string(packetPong) + packet[1:])
+		}
+	case packetMessage:
+		s.handleSioPacket(sess, packet[1:])
+	}
+	return true
+}
+
+func (s *Server) handleSioPacket(sess *session, data string) {
+	p, err := decodeSioPacket(data)
+	if err != nil {
+		return
+	}
+	switch p.Type {
+	case packetConnect:
+		if !s.namespaces[p.Namespace] {
+			var reason interface{} = "Invalid namespace"
+			if sess.eio == 4 {
+				reason = map[string]string{"message": "Invalid namespace"}
+			}
+			msg, _ := marshalASCII(reason)
+			sess.send(encodeSioPacket(packetConnectError, p.Namespace, msg))
+			return
+		}
+		sess.join(p.Namespace)
+		if sess.eio == 4 {
+			msg, _ := marshalASCII(map[string]string{"sid": newID()})
+			sess.send(encodeSioPacket(packetConnect, p.Namespace, msg))
+		} else {
+			sess.send(encodeSioPacket(packetConnect, p.Namespace, ""))
+		}
+		if s.OnConnect != nil {
+			s.OnConnect(p.Namespace, func(event string, data interface{}) {
+				if args, err := marshalASCII([]interface{}{event, data}); err == nil {
+					sess.send(encodeSioPacket(packetEvent, p.Namespace, args))
+				}
+			})
+		}
+	case packetDisconnect:
+		sess.leave(p.Namespace)
+	}
+}
+
+// heartbeat pings protocol 4 clients and closes sessions that have gone
+// quiet. Protocol 3 clients ping the server themselves.
+func (s *Server) heartbeat() {
+	for range time.Tick(s.PingInterval) {
+		deadline := time.Now().Add(-(s.PingInterval + s.PingTimeout))
+		s.mutex.RLock()
+		sessions := make([]*session, 0, len(s.sessions))
+		for _, sess := range s.sessions {
+			sessions = append(sessions, sess)
+		}
+		s.mutex.RUnlock()
+		for _, sess := range sessions {
+			if sess.idleSince().Before(deadline) {
+				s.remove(sess)
+			} else if sess.eio == 4 {
+				sess.send(string(packetPing))
+			}
+		}
+	}
+}
+
+func writePayload(w http.ResponseWriter, eio int, packets []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=UTF-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(encodePayload(eio, packets)))
+}
+
+func writeError(w http.ResponseWriter, e engineError) {
+	msg, _ := marshalASCII(e)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write([]byte(msg))
+}
+
+func newID() string {
+	b := make([]byte, 15)
+	if _, err := rand.Read(b); err != nil {
+		log.Println("generating socket.io id failed", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,150 @@
+package socketio
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/websocket"
+)
+
+func get(t *testing.T, url string) string {
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s returned %d: %s", url, res.StatusCode, body)
+	}
+	return string(body)
+}
+
+func post(t *testing.T, url string, body string) {
+	res, err := http.Post(url, "text/plain;charset=UTF-8", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s returned %d", url, res.StatusCode)
+	}
+}
+
+func handshake(t *testing.T, base string, eio int) (string, []string) {
+	packets, err := decodePayload(eio, []byte(get(t, base)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) == 0 || packets[0][0] != packetOpen {
+		t.Fatalf("expected open packet, got %q", packets)
+	}
+	var open struct {
+		Sid string `json:"sid"`
+	}
+	if err := json.Unmarshal([]byte(packets[0][1:]), &open); err != nil || open.Sid == "" {
+		t.Fatalf("invalid open packet %q", packets[0])
+	}
+	return open.Sid, packets[1:]
+}
+
+func TestPollingEIO3(t *testing.T) {
+	server := NewServer("fi", "en")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	base := ts.URL + "/socket.io/?EIO=3&transport=polling"
+	sid, rest := handshake(t, base, 3)
+	if len(rest) != 1 || rest[0] != "40" {
+		t.Fatalf("expected default namespace connect, got %q", rest)
+	}
+	url := base + "&sid=" + sid
+	post(t, url, encodePayload(3, []string{"40/fi", "2"}))
+	packets, _ := decodePayload(3, []byte(get(t, url)))
+	if len(packets) != 2 || packets[0] != "40/fi" || packets[1] != "3" {
+		t.Fatalf("expected namespace connect and pong, got %q", packets)
+	}
+
+	server.BroadcastToNamespace("en", "message", "ignored")
+	server.BroadcastToNamespace("fi", "message", "Hyvää")
+	packets, _ = decodePayload(3, []byte(get(t, url)))
+	if len(packets) != 1 || packets[0] != `42/fi,["message","Hyv\u00e4\u00e4"]` {
+		t.Fatalf("unexpected broadcast %q", packets)
+	}
+}
+
+func TestPollingEIO4(t *testing.T) {
+	server := NewServer("fi", "en")
+	server.OnConnect = func(namespace string, emit func(event string, data interface{})) {
+		emit("message", "latest "+namespace)
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	base := ts.URL + "/socket.io/?EIO=4&transport=polling"
+	sid, rest := handshake(t, base, 4)
+	if len(rest) != 0 {
+		t.Fatalf("protocol 4 must not connect namespaces implicitly, got %q", rest)
+	}
+	url := base + "&sid=" + sid
+	post(t, url, encodePayload(4, []string{"40/en,", "40/sv,"}))
+	packets, _ := decodePayload(4, []byte(get(t, url)))
+	if len(packets) != 3 {
+		t.Fatalf("expected three packets, got %q", packets)
+	}
+	if !strings.HasPrefix(packets[0], `40/en,{"sid":"`) {
+		t.Errorf("expected namespace connect with sid, got %q", packets[0])
+	}
+	if packets[1] != `42/en,["message","latest /en"]` {
+		t.Errorf("expected latest news on connect, got %q", packets[1])
+	}
+	if packets[2] != `44/sv,{"message":"Invalid namespace"}` {
+		t.Errorf("expected connect error, got %q", packets[2])
+	}
+}
+
+func TestWebsocketUpgrade(t *testing.T) {
+	server := NewServer("fi")
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	base := ts.URL + "/socket.io/?EIO=4&transport=polling"
+	sid, _ := handshake(t, base, 4)
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/socket.io/?EIO=4&transport=websocket&sid=" + sid
+	ws, err := websocket.Dial(wsURL, "", ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	var msg string
+	websocket.Message.Send(ws, "2probe")
+	if websocket.Message.Receive(ws, &msg); msg != "3probe" {
+		t.Fatalf("expected 3probe, got %q", msg)
+	}
+	websocket.Message.Send(ws, "5")
+	websocket.Message.Send(ws, "40/fi,")
+	for msg = ""; !strings.HasPrefix(msg, "40/fi,"); {
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	server.BroadcastToNamespace("fi", "message", "news")
+	if websocket.Message.Receive(ws, &msg); msg != `42/fi,["message","news"]` {
+		t.Fatalf("unexpected broadcast %q", msg)
+	}
+
+	res, err := http.Get(base + "&sid=" + sid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("polling after upgrade should fail, got %d", res.StatusCode)
+	}
+}
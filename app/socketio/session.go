@@ -0,0 +1,129 @@
+package socketio
+
+import (
+	"sync"
+	"time"
+)
+
+type session struct {
+	id         string
+	eio        int
+	mutex      sync.Mutex
+	queue      []string
+	notify     chan struct{}
+	closed     chan struct{}
+	closeOnce  sync.Once
+	lastSeen   time.Time
+	upgraded   bool
+	polling    bool
+	namespaces map[string]bool
+}
+
+func newSession(id string, eio int) *session {
+	return &session{
+		id:         id,
+		eio:        eio,
+		notify:     make(chan struct{}, 1),
+		closed:     make(chan struct{}),
+		lastSeen:   time.Now(),
+		namespaces: make(map[string]bool),
+	}
+}
+
+func (s *session) send(packets ...string) {
+	s.mutex.Lock()
+	s.queue = append(s.queue, packets...)
+	s.mutex.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *session) drain() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	packets := s.queue
+	s.queue = nil
+	return packets
+}
+
+// wait blocks until there is something to send or the session is closed.
+func (s *session) wait(done <-chan struct{}) []string {
+	for {
+		if packets := s.drain(); len(packets) > 0 {
+			return packets
+		}
+		select {
+		case <-s.notify:
+		case <-s.closed:
+			return nil
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func (s *session) touch() {
+	s.mutex.Lock()
+	s.lastSeen = time.Now()
+	s.mutex.Unlock()
+}
+
+func (s *session) idleSince() time.Time {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.lastSeen
+}
+
+func (s *session) join(namespace string) {
+	s.mutex.Lock()
+	s.namespaces[namespace] = true
+	s.mutex.Unlock()
+}
+
+func (s *session) leave(namespace string) {
+	s.mutex.Lock()
+	delete(s.namespaces, namespace)
+	s.mutex.Unlock()
+}
+
+func (s *session) joined(namespace string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.namespaces[namespace]
+}
+
+// startPoll marks a polling request active. Only one may wait at a time and
+// none after the session has moved to a websocket.
+func (s *session) startPoll() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.polling || s.upgraded {
+		return false
+	}
+	s.polling = true
+	return true
+}
+
+func (s *session) endPoll() {
+	s.mutex.Lock()
+	s.polling = false
+	s.mutex.Unlock()
+}
+
+func (s *session) upgrade() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.upgraded {
+		return false
+	}
+	s.upgraded = true
+	return true
+}
+
+func (s *session) close() {
+	s.closeOnce.Do(func() {
+		close(s.closed)
+	})
+}
@@ -0,0 +1,177 @@
+// Package suggest completes what is typed into the search box from popular
+// searches, sources, categories and words of recent headlines. The
+// completions of each language are ranked by how often they occur in it.
+package suggest
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jelinden/newsfeedreader/app/analyze"
+	"github.com/jelinden/newsfeedreader/app/service"
+)
+
+// Types of suggestions.
+const (
+	TypeQuery    = "query"
+	TypeSource   = "source"
+	TypeCategory = "category"
+	TypeTerm     = "term"
+)
+
+const (
+	// termWindow is how far back headlines are taken words from.
+	termWindow = 7 * 24 * time.Hour
+	// window is how far back searches, sources and categories are counted.
+	window = 30 * 24 * time.Hour
+	// minQueryCount keeps searches made only once, and so possibly by one
+	// person, out of the suggestions.
+	minQueryCount = 2
+	maxQueries    = 5000
+	// minTermCount and minTermLength leave out rare and short words.
+	minTermCount  = 2
+	minTermLength = 4
+)
+
+// weights of the types, a popular search is the best completion
+var weights = map[string]float64{
+	TypeQuery:    1,
+	TypeSource:   0.8,
+	TypeCategory: 0.8,
+	TypeTerm:     0.6,
+}
+
+// stopWords are frequent words that are poor searches.
+var stopWords = map[string]bool{
+	"että": true, "mutta": true, "joka": true, "jotka": true, "kuin": true,
+	"ovat": true, "olla": true, "oli": true, "olivat": true, "sekä": true,
+	"myös": true, "vain": true, "nyt": true, "jälkeen": true, "mukaan": true,
+	"this": true, "that": true, "with": true, "from": true, "have": true,
+	"will": true, "what": true, "after": true, "about": true, "into": true,
+	"over": true, "their": true, "says": true, "they": true, "were": true,
+}
+
+// Suggestion is a completion of the search box.
+type Suggestion struct {
+	Text string `json:"text"`
+	Type string `json:"type"`
+}
+
+type entry struct {
+	Suggestion
+	lower string
+	score float64
+}
+
+// dictionary is the completions of a language sorted by their lower case
+// text.
+type dictionary []entry
+
+type Suggester struct {
+	Mongo *service.Mongo
+	mutex sync.RWMutex
+	langs map[string]dictionary
+}
+
+func New(mongo *service.Mongo) *Suggester {
+	return &Suggester{Mongo: mongo, langs: map[string]dictionary{}}
+}
+
+// Refresh rebuilds the completions from the searches and items in the
+// database.
+func (s *Suggester) Refresh(now time.Time) {
+	for _, lang := range []string{"fi", "en"} {
+		category := "category.categoryName"
+		if lang == "en" {
+			category = "category.enName"
+		}
+		d := build(map[string]map[string]int{
+			TypeQuery:    s.Mongo.PopularQueries(lang, now.Add(-window), minQueryCount, maxQueries),
+			TypeSource:   s.Mongo.ItemCounts(lang, "rssSource", now.Add(-window)),
+			TypeCategory: s.Mongo.ItemCounts(lang, category, now.Add(-window)),
+			TypeTerm:     termCounts(s.Mongo.RecentTitles(lang, now.Add(-termWindow))),
+		})
+		s.mutex.Lock()
+		s.langs[lang] = d
+		s.mutex.Unlock()
+	}
+}
+
+// Suggest returns at most limit completions of prefix in lang, best first.
+func (s *Suggester) Suggest(lang string, prefix string, limit int) []Suggestion {
+	s.mutex.RLock()
+	d := s.langs[lang]
+	s.mutex.RUnlock()
+	return d.complete(prefix, limit)
+}
+
+// termCounts counts the words of titles, leaving out numbers, short words,
+// stop words and words seen only once.
+func termCounts(titles []string) map[string]int {
+	counts := map[string]int{}
+	for _, title := range titles {
+		for _, word := range analyze.Words(title) {
+			if len([]rune(word)) >= minTermLength && !stopWords[word] && strings.IndexFunc(word, unicode.IsLetter) >= 0 {
+				counts[word]++
+			}
+		}
+	}
+	for word, n := range counts {
+		if n < minTermCount {
+			delete(counts, word)
+		}
+	}
+	return counts
+}
+
+// build ranks the completions of each type by their counts relative to
+// the most frequent of the type, weighted by the type. A text found as
+// several types is suggested once, as the best of them.
+func build(counts map[string]map[string]int) dictionary {
+	best := map[string]entry{}
+	for typ, texts := range counts {
+		top := 0
+		for _, n := range texts {
+			top = max(top, n)
+		}
+		for text, n := range texts {
+			lower := strings.ToLower(strings.Join(strings.Fields(text), " "))
+			if lower == "" {
+				continue
+			}
+			score := weights[typ] * math.Log1p(float64(n)) / math.Log1p(float64(top))
+			if e, ok := best[lower]; !ok || score > e.score {
+				best[lower] = entry{Suggestion: Suggestion{Text: text, Type: typ}, lower: lower, score: score}
+			}
+		}
+	}
+	d := make(dictionary, 0, len(best))
+	for _, e := range best {
+		d = append(d, e)
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i].lower < d[j].lower })
+	return d
+}
+
+// complete returns the best completions starting with prefix.
+func (d dictionary) complete(prefix string, limit int) []Suggestion {
+	prefix = strings.ToLower(strings.Join(strings.Fields(prefix), " "))
+	result := []Suggestion{}
+	if prefix == "" {
+		return result
+	}
+	start := sort.Search(len(d), func(i int) bool { return d[i].lower >= prefix })
+	matches := []entry{}
+	for i := start; i < len(d) && strings.HasPrefix(d[i].lower, prefix); i++ {
+		matches = append(matches, d[i])
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	for i := 0; i < len(matches) && i < limit; i++ {
+		result = append(result, matches[i].Suggestion)
+	}
+	return result
+}
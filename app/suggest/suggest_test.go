@@ -0,0 +1,50 @@
+package suggest
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestComplete tests ranking completions of several types
+func TestComplete(t *testing.T) {
+	d := build(map[string]map[string]int{
+		TypeQuery:    {"korko": 40, "korona": 2, "kotimaa -urheilu": 5},
+		TypeSource:   {"Kauppalehti": 300, "Yle": 900},
+		TypeCategory: {"Kotimaa": 1000, "Talous": 800},
+		TypeTerm:     {"korkotuki": 3, "kotimaa": 12, "korkojen": 30},
+	})
+	got := d.complete(" KO", 10)
+	expected := []Suggestion{
+		{"korko", TypeQuery},
+		{"Kotimaa", TypeCategory},
+		{"korkojen", TypeTerm},
+		{"kotimaa -urheilu", TypeQuery},
+		{"korona", TypeQuery},
+		{"korkotuki", TypeTerm},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+	if got := d.complete("ko", 2); len(got) != 2 {
+		t.Errorf("Expected two completions, got %v", got)
+	}
+	if got := d.complete("kauppa", 5); !reflect.DeepEqual(got, []Suggestion{{"Kauppalehti", TypeSource}}) {
+		t.Errorf("Unexpected source completion %v", got)
+	}
+	if got := d.complete(" ", 5); len(got) != 0 {
+		t.Errorf("An empty prefix should not complete, got %v", got)
+	}
+}
+
+// TestTermCounts tests picking the words of headlines
+func TestTermCounts(t *testing.T) {
+	got := termCounts([]string{
+		"Hallitus kaatui, mutta puolue jatkaa",
+		"Hallitus ja puolue neuvottelevat 2026",
+		"Mutta 2026 hallitus",
+	})
+	expected := map[string]int{"hallitus": 3, "puolue": 2}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
@@ -3,20 +3,24 @@ package tick
 import (
 	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
-	socketio "github.com/googollee/go-socket.io"
 	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/socketio"
 )
 
 type Tick struct {
 	Mongo          *service.Mongo
 	NewsFi, NewsEn string
+	mutex          sync.RWMutex
+	subscribers    map[chan string]string
 }
 
 func NewTick(mongo *service.Mongo) *Tick {
 	tick := &Tick{}
 	tick.Mongo = mongo
+	tick.subscribers = make(map[chan string]string)
 	return tick
 }
 
@@ -33,11 +37,7 @@ func (t *Tick) TickNews(lang string) {
 				newsStr := string(news)
 				if newsStr != lastNews {
 					lastNews = newsStr
-					if lang == "fi" {
-						t.NewsFi = newsStr
-					} else {
-						t.NewsEn = newsStr
-					}
+					t.publish(lang, newsStr)
 				}
 			}
 		} else {
@@ -46,9 +46,62 @@ func (t *Tick) TickNews(lang string) {
 	}
 }
 
+// Latest returns the latest news json for the language.
+func (t *Tick) Latest(lang string) string {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	if lang == "fi" {
+		return t.NewsFi
+	}
+	return t.NewsEn
+}
+
+// Subscribe returns a channel receiving the news json of the language
+// every time it changes. Slow subscribers miss intermediate updates.
+func (t *Tick) Subscribe(lang string) chan string {
+	ch := make(chan string, 1)
+	t.mutex.Lock()
+	t.subscribers[ch] = lang
+	t.mutex.Unlock()
+	return ch
+}
+
+func (t *Tick) Unsubscribe(ch chan string) {
+	t.mutex.Lock()
+	delete(t.subscribers, ch)
+	t.mutex.Unlock()
+}
+
+func (t *Tick) publish(lang string, news string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if lang == "fi" {
+		t.NewsFi = news
+	} else {
+		t.NewsEn = news
+	}
+	for ch, l := range t.subscribers {
+		if l != lang {
+			continue
+		}
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- news
+	}
+}
+
+// TickEmit forwards news updates to the socket.io namespaces of both languages.
 func (t *Tick) TickEmit(server *socketio.Server) {
-	for _ = range time.Tick(10 * time.Second) {
-		server.BroadcastToNamespace("en", "message", t.NewsEn)
-		server.BroadcastToNamespace("fi", "message", t.NewsFi)
+	fi := t.Subscribe("fi")
+	en := t.Subscribe("en")
+	for {
+		select {
+		case news := <-fi:
+			server.BroadcastToNamespace("fi", "message", news)
+		case news := <-en:
+			server.BroadcastToNamespace("en", "message", news)
+		}
 	}
 }
@@ -296,3 +296,27 @@ func contains(s, substr string) bool {
 	}
 	return false
 }
+
+// TestSubscribe tests that published news reaches subscribers of the language
+func TestSubscribe(t *testing.T) {
+	tick := NewTick(nil)
+	fi := tick.Subscribe("fi")
+	en := tick.Subscribe("en")
+	defer tick.Unsubscribe(fi)
+	defer tick.Unsubscribe(en)
+
+	tick.publish("fi", "first")
+	tick.publish("fi", "second")
+
+	if news := <-fi; news != "second" {
+		t.Errorf("Expected only the latest news, got %s", news)
+	}
+	select {
+	case news := <-en:
+		t.Errorf("English subscriber should not receive Finnish news, got %s", news)
+	default:
+	}
+	if tick.Latest("fi") != "second" || tick.Latest("en") != "" {
+		t.Error("Latest news not tracked per language")
+	}
+}
@@ -1,17 +1,34 @@
 package util
 
 import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 type CookieUtil struct {
+	secret []byte
 }
 
-func NewCookieUtil() *CookieUtil {
-	return &CookieUtil{}
+// NewCookieUtil returns a CookieUtil signing cookies with secret. Without a
+// secret a random one is used and signed cookies do not survive restarts.
+func NewCookieUtil(secret string) *CookieUtil {
+	key := []byte(secret)
+	if secret == "" {
+		log.Println("COOKIE_SECRET not set, using a random cookie secret")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("generating cookie secret failed ", err)
+		}
+	}
+	return &CookieUtil{secret: key}
 }
 
 func (c *CookieUtil) SetCookie(name string, value string, context echo.Context) {
@@ -33,3 +50,56 @@ func (c *CookieUtil) SetCookie(name string, value string, context echo.Context)
 	}
 	context.Response().Header().Add("Set-Cookie", cookie.String())
 }
+
+// SetSignedCookie sets an http only cookie whose value is signed with the
+// secret, so that SignedCookie can tell if it has been tampered with.
+func (c *CookieUtil) SetSignedCookie(name string, value string, maxAge time.Duration, context echo.Context) {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(value))
+	cookie := http.Cookie{
+		Name:     name,
+		Value:    encoded + "." + c.sign(name, encoded),
+		Path:     "/",
+		Expires:  time.Now().Add(maxAge),
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   context.Scheme() == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+	context.Response().Header().Add("Set-Cookie", cookie.String())
+}
+
+// SignedCookie returns the value of a cookie set with SetSignedCookie if
+// the signature is valid.
+func (c *CookieUtil) SignedCookie(name string, context echo.Context) (string, bool) {
+	cookie, err := context.Cookie(name)
+	if err != nil {
+		return "", false
+	}
+	encoded, signature, found := strings.Cut(cookie.Value, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(c.sign(name, encoded))) {
+		return "", false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(value), true
+}
+
+func (c *CookieUtil) DeleteCookie(name string, context echo.Context) {
+	cookie := http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+		HttpOnly: true,
+	}
+	context.Response().Header().Add("Set-Cookie", cookie.String())
+}
+
+func (c *CookieUtil) sign(name string, value string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(name + "=" + value))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -7,6 +7,9 @@ import (
 	"github.com/jelinden/newsfeedreader/app/domain"
 )
 
+// SiteURL is the public address of the site, used in feeds and emails.
+const SiteURL = "https://www.uutispuro.fi"
+
 func DoEvery(d time.Duration, f func(time.Time)) {
 	for x := range time.Tick(d) {
 		f(x)
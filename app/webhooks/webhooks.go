@@ -0,0 +1,234 @@
+// Package webhooks posts new items to partner webhooks. Deliveries are
+// signed with the secret of the webhook and retried with exponential
+// backoff until they are delivered or given up as dead letters.
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/alerts"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/service"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// Events of deliveries.
+	EventItems = "items"
+	EventTest  = "test"
+
+	// MaxAttempts is the number of attempts before a delivery is dead.
+	MaxAttempts = 8
+	// batchSize limits the items posted in one delivery.
+	batchSize = 100
+	// deliverLimit limits the deliveries attempted on one round.
+	deliverLimit = 100
+
+	SignatureHeader = "X-Uutispuro-Signature"
+	EventHeader     = "X-Uutispuro-Event"
+	DeliveryHeader  = "X-Uutispuro-Delivery"
+)
+
+type Webhooks struct {
+	Mongo  *service.Mongo
+	Client *http.Client
+}
+
+func New(mongo *service.Mongo) *Webhooks {
+	return &Webhooks{Mongo: mongo, Client: alerts.NewWebhookClient(10 * time.Second)}
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event   string       `json:"event"`
+	Webhook string       `json:"webhook"`
+	Created time.Time    `json:"created"`
+	Items   []domain.RSS `json:"items"`
+}
+
+// Match is an ingest handler queueing the new items every webhook wants.
+func (w *Webhooks) Match(items []domain.RSS) {
+	for _, hook := range w.Mongo.ListWebhooks() {
+		matches := w.filter(hook, items)
+		for start := 0; start < len(matches); start += batchSize {
+			end := start + batchSize
+			if end > len(matches) {
+				end = len(matches)
+			}
+			if _, err := w.queue(hook, EventItems, matches[start:end]); err != nil {
+				log.Println("queueing webhook delivery failed", hook.Id.Hex(), err)
+			}
+		}
+	}
+}
+
+// filter returns the items of the language and category of the webhook
+// that match its query.
+func (w *Webhooks) filter(hook domain.Webhook, items []domain.RSS) []domain.RSS {
+	var result []domain.RSS
+	var ids []primitive.ObjectID
+	for _, item := range items {
+		if item.Language != hook.Lang {
+			continue
+		}
+		if hook.Category != "" && !strings.EqualFold(item.Category.CategoryName, hook.Category) {
+			continue
+		}
+		result = append(result, item)
+		ids = append(ids, item.Id)
+	}
+	if hook.Query == "" || len(ids) == 0 {
+		return result
+	}
+	return w.Mongo.MatchItems(hook.Query, hook.Lang, ids)
+}
+
+func (w *Webhooks) queue(hook domain.Webhook, event string, items []domain.RSS) (*domain.WebhookDelivery, error) {
+	now := time.Now()
+	body, err := json.Marshal(Payload{Event: event, Webhook: hook.Id.Hex(), Created: now, Items: items})
+	if err != nil {
+		return nil, err
+	}
+	delivery := &domain.WebhookDelivery{
+		WebhookId:   hook.Id,
+		Event:       event,
+		Payload:     string(body),
+		Status:      domain.DeliveryPending,
+		NextAttempt: now,
+		Created:     now,
+	}
+	return delivery, w.Mongo.SaveDelivery(delivery)
+}
+
+// Deliver attempts the deliveries that are due.
+func (w *Webhooks) Deliver(now time.Time) {
+	hooks := map[primitive.ObjectID]*domain.Webhook{}
+	for _, hook := range w.Mongo.ListWebhooks() {
+		hook := hook
+		hooks[hook.Id] = &hook
+	}
+	for _, delivery := range w.Mongo.DueDeliveries(now, deliverLimit) {
+		delivery := delivery
+		w.attempt(hooks[delivery.WebhookId], &delivery, now)
+	}
+}
+
+// Test sends a test event to the webhook right away and returns the
+// delivery. A failed test is not retried.
+func (w *Webhooks) Test(hook *domain.Webhook) (*domain.WebhookDelivery, error) {
+	delivery, err := w.queue(*hook, EventTest, []domain.RSS{})
+	if err != nil {
+		return nil, err
+	}
+	delivery.Attempts = MaxAttempts - 1
+	w.attempt(hook, delivery, time.Now())
+	return delivery, nil
+}
+
+// attempt posts the delivery once and saves the outcome.
+func (w *Webhooks) attempt(hook *domain.Webhook, delivery *domain.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	var err error
+	if hook == nil {
+		err = fmt.Errorf("webhook has been removed")
+		delivery.Attempts = MaxAttempts
+	} else {
+		delivery.LastStatus, err = w.post(hook, delivery, now)
+	}
+	switch {
+	case err == nil:
+		delivery.Status = domain.DeliveryDelivered
+		delivery.Delivered = now
+		delivery.LastError = ""
+	case delivery.Attempts >= MaxAttempts:
+		delivery.Status = domain.DeliveryDead
+		delivery.LastError = err.Error()
+	default:
+		delivery.NextAttempt = now.Add(Backoff(delivery.Attempts))
+		delivery.LastError = err.Error()
+	}
+	if err := w.Mongo.SaveDelivery(delivery); err != nil {
+		log.Println("saving webhook delivery failed", delivery.Id.Hex(), err)
+	}
+}
+
+func (w *Webhooks) post(hook *domain.Webhook, delivery *domain.WebhookDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "uutispuro-webhooks")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.Id.Hex())
+	req.Header.Set(SignatureHeader, Signature(hook.Secret, now, []byte(delivery.Payload)))
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Backoff is the wait before the attempt following the given number of
+// failed ones: 30 seconds doubling up to six hours.
+func Backoff(attempts int) time.Duration {
+	wait := 30 * time.Second
+	for i := 1; i < attempts && wait < 6*time.Hour; i++ {
+		wait *= 2
+	}
+	if wait > 6*time.Hour {
+		wait = 6 * time.Hour
+	}
+	return wait
+}
+
+// Signature signs the body sent at t as "t=<unix time>,v1=<hex hmac>",
+// where the hmac is the SHA-256 HMAC of "<unix time>.<body>" with the
+// secret. Receivers should recompute it and reject old timestamps.
+func Signature(secret string, t time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature made with Signature no longer than tolerance
+// before now.
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) bool {
+	var timestamp, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signature = value
+		}
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	t := time.Unix(unix, 0)
+	if now.Sub(t) > tolerance || t.Sub(now) > tolerance {
+		return false
+	}
+	_, expected, _ := strings.Cut(Signature(secret, t, body), ",v1=")
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
@@ -0,0 +1,115 @@
+package webhooks
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestSignature tests that signatures verify with the right secret and a fresh timestamp only
+func TestSignature(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"event":"test"}`)
+	header := Signature("whsec_a", now, body)
+	if !Verify("whsec_a", header, body, now.Add(time.Minute), 5*time.Minute) {
+		t.Errorf("Expected %q to verify", header)
+	}
+	if Verify("whsec_b", header, body, now, 5*time.Minute) {
+		t.Error("Signature should not verify with another secret")
+	}
+	if Verify("whsec_a", header, []byte(`{"event":"items"}`), now, 5*time.Minute) {
+		t.Error("Signature should not verify for another body")
+	}
+	if Verify("whsec_a", header, body, now.Add(time.Hour), 5*time.Minute) {
+		t.Error("Old signature should not verify")
+	}
+}
+
+// TestBackoff tests that the wait doubles from 30 seconds up to six hours
+func TestBackoff(t *testing.T) {
+	expected := map[int]time.Duration{1: 30 * time.Second, 2: time.Minute, 3: 2 * time.Minute, 20: 6 * time.Hour}
+	for attempts, wait := range expected {
+		if got := Backoff(attempts); got != wait {
+			t.Errorf("After %d attempts expected to wait %v, got %v", attempts, wait, got)
+		}
+	}
+}
+
+// TestFilter tests the language and category filters of a webhook
+func TestFilter(t *testing.T) {
+	items := []domain.RSS{
+		{Id: primitive.NewObjectID(), Language: "fi", Category: domain.Category{CategoryName: "Talous"}},
+		{Id: primitive.NewObjectID(), Language: "fi", Category: domain.Category{CategoryName: "Urheilu"}},
+		{Id: primitive.NewObjectID(), Language: "en", Category: domain.Category{CategoryName: "Talous"}},
+	}
+	w := &Webhooks{}
+	if got := w.filter(domain.Webhook{Lang: "fi"}, items); len(got) != 2 {
+		t.Errorf("Expected the items of the language, got %d", len(got))
+	}
+	got := w.filter(domain.Webhook{Lang: "fi", Category: "talous"}, items)
+	if len(got) != 1 || got[0].Id != items[0].Id {
+		t.Errorf("Expected the item of the category, got %+v", got)
+	}
+}
+
+// TestPost tests the signed request and that error responses fail the delivery
+func TestPost(t *testing.T) {
+	hook := &domain.Webhook{Secret: "whsec_a"}
+	delivery := &domain.WebhookDelivery{Id: primitive.NewObjectID(), Event: EventTest, Payload: `{"event":"test"}`}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(hook.Secret, r.Header.Get(SignatureHeader), body, time.Now(), time.Minute) {
+			t.Errorf("Invalid signature %q", r.Header.Get(SignatureHeader))
+		}
+		if r.Header.Get(EventHeader) != EventTest || r.Header.Get(DeliveryHeader) != delivery.Id.Hex() {
+			t.Errorf("Unexpected event headers %v", r.Header)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	hook.URL = server.URL
+
+	w := &Webhooks{Client: &http.Client{Timeout: time.Second}}
+	if code, err := w.post(hook, delivery, time.Now()); err != nil || code != http.StatusOK {
+		t.Errorf("Expected delivery to succeed, got %d %v", code, err)
+	}
+	status = http.StatusInternalServerError
+	if code, err := w.post(hook, delivery, time.Now()); err == nil || code != http.StatusInternalServerError {
+		t.Errorf("Expected delivery to fail, got %d %v", code, err)
+	}
+}
+
+// TestPostInternal tests that deliveries reach neither internal addresses
+// nor redirect targets
+func TestPostInternal(t *testing.T) {
+	hook := &domain.Webhook{Secret: "whsec_a"}
+	delivery := &domain.WebhookDelivery{Id: primitive.NewObjectID(), Event: EventTest, Payload: `{"event":"test"}`}
+	reached := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer target.Close()
+	hook.URL = target.URL
+	w := New(nil)
+	if _, err := w.post(hook, delivery, time.Now()); err == nil || reached {
+		t.Error("Posting to an internal address should fail when dialing")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer server.Close()
+	hook.URL = server.URL
+	// the redirecting server is local too, let the client reach it
+	w.Client.Transport.(*http.Transport).DialContext = (&net.Dialer{}).DialContext
+	if code, err := w.post(hook, delivery, time.Now()); err == nil || code != http.StatusTemporaryRedirect || reached {
+		t.Errorf("Redirects should not be followed, got %d %v", code, err)
+	}
+}
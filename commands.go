@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jelinden/newsfeedreader/app/index"
+)
+
+const usage = `usage: newsfeedreader [command]
+
+Without a command the web server is started.
+
+commands:
+  digest-preview [-format text|html] [-at time] email
+        print the digest the user would get now, or at an RFC 3339 time
+  analyze
+        store the search tokens of all items again, after the analyzer changes
+  reindex
+        rebuild the search index from the store into SEARCH_INDEX_FILE
+`
+
+// command runs a command line command and returns the exit code.
+func command(args []string) int {
+	switch args[0] {
+	case "digest-preview":
+		return digestPreview(args[1:])
+	case "reindex":
+		if len(args) == 1 {
+			return reindex()
+		}
+	case "analyze":
+		if len(args) == 1 {
+			fmt.Println("analyzed", app.Mongo.Reanalyze(), "items")
+			return 0
+		}
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+func digestPreview(args []string) int {
+	flags := flag.NewFlagSet("digest-preview", flag.ContinueOnError)
+	format := flags.String("format", "text", "text or html")
+	at := flags.String("at", "", "time of the digest, RFC 3339")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 || (*format != "text" && *format != "html") {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	now := time.Now()
+	if *at != "" {
+		t, err := time.Parse(time.RFC3339, *at)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid time:", err)
+			return 2
+		}
+		now = t
+	}
+	user := app.Mongo.FindUserByEmail(flags.Arg(0))
+	if user == nil {
+		fmt.Fprintln(os.Stderr, "no user with email", flags.Arg(0))
+		return 1
+	}
+	msg, err := app.Digest.Preview(user, now)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rendering digest failed:", err)
+		return 1
+	}
+	fmt.Println("To:", msg.To)
+	fmt.Println("Subject:", msg.Subject)
+	fmt.Println()
+	if *format == "html" {
+		fmt.Println(msg.HTML)
+	} else {
+		fmt.Print(msg.Text)
+	}
+	return 0
+}
+
+func reindex() int {
+	file := os.Getenv("SEARCH_INDEX_FILE")
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "SEARCH_INDEX_FILE is not set")
+		return 2
+	}
+	n, err := index.NewSearcher(app.Mongo, file).Rebuild()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "saving the index failed:", err)
+		return 1
+	}
+	fmt.Println("indexed", n, "items")
+	return 0
+}
@@ -3,19 +3,16 @@ module github.com/jelinden/newsfeedreader
 go 1.24.0
 
 require (
-	github.com/googollee/go-socket.io v1.7.0
 	github.com/labstack/echo/v4 v4.13.4
 	github.com/pquerna/ffjson v0.0.0-20190930134022-aa0246cd15f7
 	github.com/rsniezynski/go-asset-helper v0.0.0-20150405181857-38e753e5e853
 	go.mongodb.org/mongo-driver v1.17.4
+	golang.org/x/crypto v0.45.0
 	golang.org/x/net v0.47.0
 )
 
 require (
-	github.com/gofrs/uuid v4.4.0+incompatible // indirect
 	github.com/golang/snappy v1.0.0 // indirect
-	github.com/gomodule/redigo v1.9.2 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
 	github.com/klauspost/compress v1.18.0 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
@@ -27,7 +24,6 @@ require (
 	github.com/xdg-go/scram v1.1.2 // indirect
 	github.com/xdg-go/stringprep v1.0.4 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78 // indirect
-	golang.org/x/crypto v0.45.0 // indirect
 	golang.org/x/sync v0.18.0 // indirect
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/text v0.31.0 // indirect
@@ -6,14 +6,26 @@ import (
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"time"
 
+	"github.com/jelinden/newsfeedreader/app/alerts"
+	"github.com/jelinden/newsfeedreader/app/digest"
+	"github.com/jelinden/newsfeedreader/app/domain"
+	"github.com/jelinden/newsfeedreader/app/index"
+	"github.com/jelinden/newsfeedreader/app/ingest"
+	"github.com/jelinden/newsfeedreader/app/mail"
 	"github.com/jelinden/newsfeedreader/app/middleware"
+	"github.com/jelinden/newsfeedreader/app/oidc"
+	"github.com/jelinden/newsfeedreader/app/related"
 	"github.com/jelinden/newsfeedreader/app/render"
 	"github.com/jelinden/newsfeedreader/app/routes"
 	"github.com/jelinden/newsfeedreader/app/service"
+	"github.com/jelinden/newsfeedreader/app/socketio"
+	"github.com/jelinden/newsfeedreader/app/suggest"
 	"github.com/jelinden/newsfeedreader/app/tick"
 	"github.com/jelinden/newsfeedreader/app/util"
+	"github.com/jelinden/newsfeedreader/app/webhooks"
 	"github.com/labstack/echo/v4"
 	mw "github.com/labstack/echo/v4/middleware"
 	"golang.org/x/net/websocket"
@@ -24,6 +36,17 @@ type Application struct {
 	CookieUtil *util.CookieUtil
 	Tick       *tick.Tick
 	Render     *render.Render
+	SocketIO   *socketio.Server
+	Mail       *mail.Sender
+	Ingest     *ingest.Watcher
+	Alerts     *alerts.Alerts
+	Digest     *digest.Digest
+	Webhooks   *webhooks.Webhooks
+	OIDC       []*oidc.Client
+	Suggest    *suggest.Suggester
+	// Index is the search index, nil when Mongo answers searches.
+	Index   *index.Searcher
+	Related *related.Index
 }
 
 var app *Application
@@ -32,13 +55,43 @@ const secondsInAYear = 365 * 24 * 60 * 60
 
 func (a *Application) Start() {
 	a.Mongo = service.NewMongo(os.Getenv("MONGO_URL"))
-	a.CookieUtil = util.NewCookieUtil()
+	a.CookieUtil = util.NewCookieUtil(os.Getenv("COOKIE_SECRET"))
 	a.Tick = tick.NewTick(a.Mongo)
 	a.Render = render.NewRender(a.Mongo)
+	a.OIDC = oidc.NewClients(util.SiteURL)
+	for _, client := range a.OIDC {
+		a.Render.LoginProviders = append(a.Render.LoginProviders, domain.LoginProvider{ID: client.ID, Name: client.Name})
+	}
+	a.Mail = mail.NewSender(mail.NewMailer(), "public/mail/*.tmpl")
+	a.Alerts = alerts.New(a.Mongo, a.Mail)
+	a.Digest = digest.New(a.Mongo, a.Mail)
+	a.Ingest = ingest.NewWatcher(a.Mongo)
+	a.Webhooks = webhooks.New(a.Mongo)
+	a.Suggest = suggest.New(a.Mongo)
+	a.Ingest.Handle(a.Mongo.AnalyzeItems)
+	if os.Getenv("SEARCH_BACKEND") == "index" {
+		a.Index = index.NewSearcher(a.Mongo, os.Getenv("SEARCH_INDEX_FILE"))
+		a.Render.Searcher = a.Index
+		a.Ingest.Handle(a.Index.Add)
+	}
+	a.Related = related.New(a.Mongo)
+	a.Render.Related = a.Related
+	a.Ingest.Handle(a.Related.Add)
+	a.Ingest.Handle(a.Alerts.Match)
+	a.Ingest.Handle(a.Webhooks.Match)
+	a.SocketIO = socketio.NewServer("fi", "en")
+	a.SocketIO.OnConnect = func(namespace string, emit func(event string, data interface{})) {
+		if news := a.Tick.Latest(strings.TrimPrefix(namespace, "/")); news != "" {
+			emit("message", news)
+		}
+	}
 }
 
 func (a *Application) Close() {
 	log.Println("closing up")
+	if a.Index != nil {
+		a.Index.Save(time.Now())
+	}
 	a.Mongo.Close()
 }
 
@@ -46,25 +99,87 @@ func main() {
 	app = &Application{}
 	app.Start()
 	defer app.Close()
+	if len(os.Args) > 1 {
+		code := command(os.Args[1:])
+		app.Close()
+		os.Exit(code)
+	}
 
 	e := echo.New()
 	e.Use(mw.RemoveTrailingSlashWithConfig(mw.TrailingSlashConfig{
 		RedirectCode: http.StatusMovedPermanently,
+		Skipper: func(c echo.Context) bool {
+			return strings.HasPrefix(c.Request().URL.Path, "/socket.io/")
+		},
 	}))
 
 	e.Use(mw.Recover())
 
 	go app.Tick.TickNews("fi")
 	go app.Tick.TickNews("en")
+	go app.Tick.TickEmit(app.SocketIO)
+	go util.DoEvery(30*time.Second, app.Mongo.FlushAPIKeyUsage)
+	go util.DoEvery(30*time.Second, app.Ingest.Poll)
+	go func() {
+		if n := app.Mongo.AnalyzeMissing(); n > 0 {
+			log.Println("analyzed", n, "items for search")
+		}
+	}()
+	go func() {
+		app.Suggest.Refresh(time.Now())
+		util.DoEvery(10*time.Minute, app.Suggest.Refresh)
+	}()
+	if app.Index != nil {
+		go app.Index.Load()
+		go util.DoEvery(10*time.Minute, app.Index.Save)
+	}
+	go app.Related.Load()
+	go util.DoEvery(time.Hour, app.Related.Prune)
+	go util.DoEvery(time.Minute, app.Alerts.Dispatch)
+	go util.DoEvery(10*time.Minute, app.Digest.Dispatch)
+	go util.DoEvery(15*time.Second, app.Webhooks.Deliver)
 
 	paths := e.Group("/")
 	paths.Use(mw.Gzip())
 	paths.Use(middleware.Logger())
+	paths.Use(middleware.Session(app.Mongo, app.CookieUtil))
+	paths.Use(middleware.Preferences(app.CookieUtil))
+	paths.Use(middleware.CSRF())
 	paths.GET("", routes.Root)
 	paths.GET("fi", routes.FiRoot(app.Render))
 	paths.GET("en", routes.EnRoot(app.Render))
 	paths.GET("fi/login", routes.Login(app.Render, "fi"))
 	paths.GET("en/login", routes.Login(app.Render, "en"))
+	paths.POST("login", routes.PostLogin(app.Render, app.Mongo, app.CookieUtil))
+	paths.GET("login/:provider", routes.OIDCLogin(app.Render, app.OIDC, app.CookieUtil))
+	paths.GET("login/:provider/callback", routes.OIDCCallback(app.Render, app.Mongo, app.OIDC, app.CookieUtil))
+	paths.POST("signup", routes.Signup(app.Render, app.Mongo, app.CookieUtil, app.Mail))
+	paths.POST("logout", routes.Logout(app.Mongo, app.CookieUtil))
+	paths.POST("verify", routes.ResendVerification(app.Render, app.Mongo, app.Mail))
+	paths.POST("forgot", routes.PostForgotPassword(app.Render, app.Mongo, app.Mail))
+	paths.POST("reset", routes.PostResetPassword(app.Render, app.Mongo))
+	paths.POST("preferences", routes.UpdatePreferences(app.Mongo, app.CookieUtil))
+	paths.POST("searches", routes.SaveSearch(app.Render, app.Mongo))
+	paths.POST("searches/alerts", routes.SaveAlertSettings(app.Render, app.Mongo))
+	paths.POST("searches/:id/delete", routes.DeleteSavedSearch(app.Mongo))
+	paths.POST("digest", routes.SaveDigestSettings(app.Render, app.Mongo))
+	paths.POST("bookmarks/:id", routes.AddBookmark(app.Mongo))
+	paths.POST("bookmarks/:id/delete", routes.RemoveBookmark(app.Mongo))
+	paths.GET("bookmarks/export.:format", routes.ExportBookmarks(app.Mongo))
+	paths.GET("account/export", routes.ExportAccount(app.Mongo))
+	paths.POST("account/delete", routes.DeleteAccount(app.Render, app.Mongo, app.CookieUtil))
+	for _, lang := range []string{"fi", "en"} {
+		paths.GET(lang+"/verify", routes.VerifyEmail(app.Render, app.Mongo, lang))
+		paths.GET(lang+"/forgot", routes.ForgotPassword(app.Render, lang))
+		paths.GET(lang+"/reset", routes.ResetPassword(app.Render, lang))
+		paths.GET(lang+"/searches", routes.SavedSearches(app.Render, lang))
+		paths.GET(lang+"/bookmarks", routes.Bookmarks(app.Render, lang))
+		paths.GET(lang+"/bookmarks/:page", routes.Bookmarks(app.Render, lang))
+		paths.GET(lang+"/unsubscribe", routes.Unsubscribe(app.Render, lang))
+		paths.GET(lang+"/account", routes.Account(app.Render, lang))
+		// one click unsubscribe requests of mail clients have no csrf token
+		e.POST("/"+lang+"/unsubscribe", routes.PostUnsubscribe(app.Render, app.Mongo, lang))
+	}
 	paths.GET("fi/:page", routes.FiRootPaged(app.Render))
 	paths.GET("en/:page", routes.EnRootPaged(app.Render))
 	paths.GET("fi/search", routes.FiSearch(app.Render))
@@ -76,6 +191,14 @@ func main() {
 	paths.GET("en/category/:category/:page", routes.EnCategory(app.Render))
 	paths.GET("fi/source/:source/:page", routes.FiSource(app.Render))
 	paths.GET("en/source/:source/:page", routes.EnSource(app.Render))
+	for _, lang := range []string{"fi", "en"} {
+		paths.GET(lang+"/feed.:format", routes.Feed(app.Render, lang))
+		paths.GET(lang+"/category/:category/feed.:format", routes.Feed(app.Render, lang))
+		paths.GET(lang+"/source/:source/feed.:format", routes.Feed(app.Render, lang))
+		paths.GET(lang+"/search/feed.:format", routes.SearchFeed(app.Render, lang))
+		paths.GET(lang+"/search/histogram.:format", routes.SearchHistogram(app.Render, lang))
+		paths.GET(lang+"/item/:id", routes.Item(app.Render, lang))
+	}
 	paths.GET("fi/category/:category", redirect)
 	paths.GET("en/category/:category", redirect)
 	paths.GET("fi/source/:source", redirect)
@@ -104,7 +227,26 @@ func main() {
 	})
 
 	paths.GET("api/news", routes.News)
+	paths.File("api/v1/openapi.json", "public/openapi.json")
+	paths.Any("api/v1/*", routes.APINotFound)
+	v1 := paths.Group("api/v1", middleware.APIKey(app.Mongo))
+	v1.GET("/items", routes.Items(app.Mongo))
+	v1.GET("/items/:id/related", routes.RelatedItems(app.Mongo, app.Related))
+	v1.GET("/suggest", routes.Suggest(app.Suggest))
+	v1.GET("/histogram", routes.Histogram(app.Mongo))
+
+	admin := paths.Group("admin", middleware.Admin())
+	admin.GET("/apikeys", routes.AdminAPIKeys(app.Render, app.Mongo))
+	admin.POST("/apikeys", routes.CreateAPIKey(app.Render, app.Mongo))
+	admin.POST("/apikeys/:id/revoke", routes.RevokeAPIKey(app.Mongo))
+	admin.GET("/webhooks", routes.AdminWebhooks(app.Render, app.Mongo))
+	admin.POST("/webhooks", routes.CreateWebhook(app.Render, app.Mongo))
+	admin.POST("/webhooks/:id/delete", routes.DeleteWebhook(app.Mongo))
+	admin.POST("/webhooks/:id/test", routes.TestWebhook(app.Render, app.Mongo, app.Webhooks))
+	admin.POST("/webhooks/deliveries/:id/retry", routes.RetryDelivery(app.Mongo))
+	admin.GET("/queries", routes.AdminQueries(app.Render, app.Mongo))
 	paths.GET("ws/:channel", ws)
+	e.Any("/socket.io/", echo.WrapHandler(app.SocketIO))
 
 	log.Fatal(e.Start(":1300"))
 }
@@ -127,17 +269,23 @@ func static(c echo.Context) error {
 
 func ws(c echo.Context) error {
 	channel := c.Param("channel")
+	if channel != "fi" && channel != "en" {
+		return c.NoContent(http.StatusNotFound)
+	}
 	websocket.Handler(func(ws *websocket.Conn) {
 		defer ws.Close()
+		updates := app.Tick.Subscribe(channel)
+		defer app.Tick.Unsubscribe(updates)
+		news := app.Tick.Latest(channel)
 		for {
 			ws.SetWriteDeadline(time.Now().Add(5 * time.Second))
-			if channel == "fi" {
-				websocket.Message.Send(ws, app.Tick.NewsFi)
+			if err := websocket.Message.Send(ws, news); err != nil {
+				return
 			}
-			if channel == "en" {
-				websocket.Message.Send(ws, app.Tick.NewsEn)
+			select {
+			case news = <-updates:
+			case <-time.After(15 * time.Second):
 			}
-			time.Sleep(15 * time.Second)
 		}
 	}).ServeHTTP(c.Response(), c.Request())
 	return nil
@@ -5,6 +5,11 @@ window.onload = function() {
 const wsProtocol = window.location.protocol === "https:" ? "wss" : "ws";
 
 function startWS() {
+    var container = document.getElementById("news-container");
+    // a personalized front page is not updated with the unfiltered live news
+    if (container && container.dataset.personalized) {
+        return;
+    }
     if (location.pathname === "/fi" || location.pathname === "/en") {
         var lang = location.pathname === "/fi" ? "fi" : "en";
         var wsURL = wsProtocol + "://" + window.location.hostname + ":" + window.location.port + "/ws/";
@@ -111,6 +116,13 @@ document.addEventListener("DOMContentLoaded", function() {
     for (var i = 0; i < item.length; i++) {
         item[i].addEventListener("click", function() {
             saveClick(this.id);
+            var parent = this.parentNode;
+            while (parent && parent.className.split(/\s+/).indexOf("item") < 0) {
+                parent = parent.parentNode;
+            }
+            if (parent && parent.className.split(/\s+/).indexOf("read") < 0) {
+                parent.className += " read";
+            }
         });
     }
 });